@@ -16,8 +16,10 @@ package agent_logs
 
 import (
 	"encoding/json"
+	"github.com/astaxie/beego"
 	"net/http"
 	"rasp-cloud/controllers"
+	"rasp-cloud/models"
 	"rasp-cloud/models/logs"
 	"time"
 )
@@ -33,8 +35,22 @@ func (o *AttackAlarmController) Post() {
 	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &alarms); err != nil {
 		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
 	}
-	count := 0
+	// the alarm_ingest token can only report the alarms of its app
+	ingestAppId, isToken := o.Ctx.Input.GetData(models.IngestAppIdKey).(string)
+	accepted := make([]map[string]interface{}, 0, len(alarms))
 	for _, alarm := range alarms {
+		if isToken && alarm["app_id"] != ingestAppId {
+			continue
+		}
+		// the incidents are grouped by the stack_md5, so it is set before the incident status
+		logs.SetAlarmStackMd5(alarm)
+		accepted = append(accepted, alarm)
+	}
+	if err := models.SetAlarmIncidentStatus(accepted); err != nil {
+		beego.Error("failed to get the incidents of attack alarms: " + err.Error())
+	}
+	count := 0
+	for _, alarm := range accepted {
 		alarm["@timestamp"] = time.Now().UnixNano() / 1000000
 		err := logs.AddAttackAlarm(alarm)
 		if err == nil {
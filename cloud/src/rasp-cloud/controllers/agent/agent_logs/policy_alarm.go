@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"rasp-cloud/controllers"
+	"rasp-cloud/models"
 	"rasp-cloud/models/logs"
 	"time"
 )
@@ -33,8 +34,13 @@ func (o *PolicyAlarmController) Post() {
 	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &alarms); err != nil {
 		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
 	}
+	// the alarm_ingest token can only report the alarms of its app
+	ingestAppId, isToken := o.Ctx.Input.GetData(models.IngestAppIdKey).(string)
 	count := 0
 	for _, alarm := range alarms {
+		if isToken && alarm["app_id"] != ingestAppId {
+			continue
+		}
 		alarm["@timestamp"] = time.Now().UnixNano() / 1000000
 		err := logs.AddPolicyAlarm(alarm)
 		if err == nil {
@@ -47,8 +47,10 @@ func (o *HeartbeatController) Post() {
 		o.ServeError(http.StatusBadRequest, "failed to get rasp", err)
 	}
 	rasp.LastHeartbeatTime = time.Now().Unix()
-	rasp.PluginVersion = heartbeat.PluginVersion
-	err = models.UpsertRaspById(heartbeat.RaspId, rasp)
+	if heartbeat.PluginVersion != "" {
+		rasp.PluginVersion = heartbeat.PluginVersion
+	}
+	err = models.UpdateRaspHeartbeat(heartbeat.RaspId, heartbeat.PluginVersion, rasp.LastHeartbeatTime)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to update rasp", err)
 	}
@@ -66,7 +68,7 @@ func (o *HeartbeatController) Post() {
 	result := make(map[string]interface{})
 	isUpdate := false
 	// handle plugin
-	selectedPlugin, err := models.GetSelectedPlugin(appId, true)
+	selectedPlugin, err := models.GetPluginForRasp(appId, heartbeat.RaspId, true)
 	if err != nil && err != mgo.ErrNotFound {
 		o.ServeError(http.StatusBadRequest, "failed to get selected plugin", err)
 	}
@@ -79,8 +81,13 @@ func (o *HeartbeatController) Post() {
 		}
 	}
 	if isUpdate {
+		// the config of the app is overridden by the groups of the rasp
+		generalConfig, whitelist, _, err := models.GetRaspEffectiveConfig(app, rasp)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get the config of rasp groups", err)
+		}
 		whitelistConfig := make(map[string]interface{})
-		for _, configItem := range app.WhitelistConfig {
+		for _, configItem := range whitelist {
 			whiteHookTypes := make([]string, 0, len(configItem.Hook))
 			for hookType, isWhite := range configItem.Hook {
 				if isWhite {
@@ -90,10 +97,10 @@ func (o *HeartbeatController) Post() {
 			whitelistConfig[configItem.Url] = whiteHookTypes
 		}
 		//app.GeneralConfig["algorithm.config"] = selectedPlugin.AlgorithmConfig
-		app.GeneralConfig["hook.white"] = whitelistConfig
+		generalConfig["hook.white"] = whitelistConfig
 		result["plugin"] = selectedPlugin
 		result["config_time"] = app.ConfigTime
-		result["config"] = app.GeneralConfig
+		result["config"] = generalConfig
 	}
 	o.Serve(result)
 }
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"rasp-cloud/controllers"
 	"rasp-cloud/models"
+	"strconv"
 	"time"
 )
 
@@ -81,13 +82,39 @@ func (o *RaspController) Post() {
 	if rasp.HeartbeatInterval <= 0 {
 		o.ServeError(http.StatusBadRequest, "heartbeat_interval must be greater than 0")
 	}
+	if len(rasp.Labels) > models.MaxRaspTagCount {
+		o.ServeError(http.StatusBadRequest,
+			"the count of rasp labels can not be greater than "+strconv.Itoa(models.MaxRaspTagCount))
+	}
+	for _, label := range rasp.Labels {
+		if label == "" || len(label) > models.MaxRaspTagLength {
+			o.ServeError(http.StatusBadRequest,
+				"the length of rasp label must be between [1,"+strconv.Itoa(models.MaxRaspTagLength)+"]")
+		}
+	}
 
+	// the tags are managed by the api, the agent can only send labels
+	rasp.Tags = nil
+	// keep the offline alarm state, so that the recovery of a re-registered rasp can be notified
+	oldRasp, err := models.GetRaspById(rasp.Id)
+	if err == nil {
+		rasp.OfflineNotified = oldRasp.OfflineNotified
+		if oldRasp.AppId == rasp.AppId {
+			rasp.Tags = oldRasp.Tags
+		}
+	}
 	rasp.LastHeartbeatTime = time.Now().Unix()
 	rasp.RegisterTime = time.Now().Unix()
 	err = models.UpsertRaspById(rasp.Id, rasp)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to add rasp", err)
 	}
+	// the groups of the agent change with its labels
+	if oldRasp != nil && oldRasp.AppId == rasp.AppId {
+		if err = models.TouchRaspLabels(rasp.AppId, oldRasp.Labels, rasp.Labels); err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to update the config time of app", err)
+		}
+	}
 	models.AddOperation(rasp.AppId, models.OperationTypeRegisterRasp, o.Ctx.Input.IP(),
 		"New RASP agent registered from "+rasp.HostName+": "+rasp.Id, "")
 	o.Serve(rasp)
@@ -0,0 +1,179 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"rasp-cloud/models"
+)
+
+var interceptStates = []string{"block", "log", "ignore"}
+
+// @router /alarm/rule/get [post]
+func (o *AppController) GetAlarmRules() {
+	var param pageParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	if param.Page <= 0 {
+		o.ServeError(http.StatusBadRequest, "page must be greater than 0")
+	}
+	if param.Perpage <= 0 {
+		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
+	}
+	o.CheckAppRole(param.AppId, models.RoleReadOnly)
+	total, rules, err := models.GetAlarmRulesByApp(param.AppId, param.Page, param.Perpage)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get alarm rules", err)
+	}
+	var result = make(map[string]interface{})
+	result["total"] = total
+	result["total_page"] = math.Ceil(float64(total) / float64(param.Perpage))
+	result["page"] = param.Page
+	result["perpage"] = param.Perpage
+	result["data"] = rules
+	o.Serve(result)
+}
+
+// @router /alarm/rule [post]
+func (o *AppController) AddAlarmRule() {
+	var rule = &models.AlarmRule{}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, rule)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if rule.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(rule.AppId, models.RoleOperator)
+	if _, err = models.GetAppById(rule.AppId); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get app", err)
+	}
+	o.validAlarmRule(rule)
+	rule, err = models.AddAlarmRule(rule)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to add alarm rule", err)
+	}
+	models.AddOperation(rule.AppId, models.OperationTypeAddAlarmRule, o.Ctx.Input.IP(),
+		"New alarm rule added for "+rule.AppId+": "+rule.Name, o.GetLoginUser().Name)
+	o.Serve(rule)
+}
+
+// @router /alarm/rule/update [post]
+func (o *AppController) UpdateAlarmRule() {
+	var rule = &models.AlarmRule{}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, rule)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if rule.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	oldRule, err := models.GetAlarmRuleById(rule.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get alarm rule", err)
+	}
+	o.CheckAppRole(oldRule.AppId, models.RoleOperator)
+	rule.AppId = oldRule.AppId
+	o.validAlarmRule(rule)
+	rule, err = models.UpdateAlarmRule(rule)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to update alarm rule", err)
+	}
+	operationData, err := json.Marshal(rule)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to encode alarm rule", err)
+	}
+	models.AddOperation(rule.AppId, models.OperationTypeUpdateAlarmRule, o.Ctx.Input.IP(),
+		"Updated alarm rule for "+rule.AppId+": "+string(operationData), o.GetLoginUser().Name)
+	o.Serve(rule)
+}
+
+// @router /alarm/rule/delete [post]
+func (o *AppController) DeleteAlarmRule() {
+	var param map[string]string
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	id := param["id"]
+	if id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	rule, err := models.GetAlarmRuleById(id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get alarm rule", err)
+	}
+	o.CheckAppRole(rule.AppId, models.RoleOperator)
+	_, err = models.RemoveAlarmRuleById(id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove alarm rule", err)
+	}
+	models.AddOperation(rule.AppId, models.OperationTypeDeleteAlarmRule, o.Ctx.Input.IP(),
+		"Deleted alarm rule for "+rule.AppId+": "+rule.Name, o.GetLoginUser().Name)
+	o.ServeWithEmptyData()
+}
+
+func (o *AppController) validAlarmRule(rule *models.AlarmRule) {
+	if rule.Name == "" {
+		o.ServeError(http.StatusBadRequest, "the name of alarm rule cannot be empty")
+	}
+	if len(rule.Name) > 128 {
+		o.ServeError(http.StatusBadRequest, "the length of alarm rule name cannot be greater than 128")
+	}
+	rule.AttackTypes = o.validAppArrayParam(rule.AttackTypes, "attack_type", nil)
+	rule.InterceptStates = o.validAppArrayParam(rule.InterceptStates, "intercept_state", nil)
+	for _, state := range rule.InterceptStates {
+		if !isInStringArray(interceptStates, state) {
+			o.ServeError(http.StatusBadRequest, "invalid intercept_state: "+state)
+		}
+	}
+	if rule.MinConfidence < 0 || rule.MinConfidence > 100 {
+		o.ServeError(http.StatusBadRequest, "min_plugin_confidence must be between [0, 100]")
+	}
+	if len(rule.ServerHostname) > 256 {
+		o.ServeError(http.StatusBadRequest, "the length of server_hostname cannot be greater than 256")
+	}
+	if len(rule.Url) > 256 {
+		o.ServeError(http.StatusBadRequest, "the length of url cannot be greater than 256")
+	}
+	if rule.Threshold < 0 {
+		o.ServeError(http.StatusBadRequest, "threshold cannot be less than 0")
+	}
+	if rule.Threshold > 1 && (rule.Period <= 0 || rule.Period > 7*24*60) {
+		o.ServeError(http.StatusBadRequest, "period must be between [1, 10080] when threshold is greater than 1")
+	}
+	rule.Channels = o.validAppArrayParam(rule.Channels, "channels", nil)
+	for _, channel := range rule.Channels {
+		if _, ok := models.GetNotifier(channel); !ok {
+			o.ServeError(http.StatusBadRequest, "unknown alarm channel: "+channel)
+		}
+	}
+}
+
+func isInStringArray(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/astaxie/beego/validation"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -23,7 +24,9 @@ import (
 	"net/http"
 	"rasp-cloud/controllers"
 	"rasp-cloud/models"
+	"rasp-cloud/models/logs"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -59,7 +62,14 @@ func (o *AppController) GetApp() {
 			o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
 		}
 		var result = make(map[string]interface{})
-		total, apps, err := models.GetAllApp(data.Page, data.Perpage, true)
+		var total int
+		var apps []*models.App
+		user := o.GetLoginUser()
+		if user.HasRole(models.RoleReadOnly) {
+			total, apps, err = models.GetAllApp(data.Page, data.Perpage, true)
+		} else {
+			total, apps, err = models.GetAppsByIds(user.GetAppIds(), data.Page, data.Perpage, true)
+		}
 		if err != nil {
 			o.ServeError(http.StatusBadRequest, "failed to get apps", err)
 		}
@@ -73,6 +83,7 @@ func (o *AppController) GetApp() {
 		result["data"] = apps
 		o.Serve(result)
 	} else {
+		o.CheckAppRole(data.AppId, models.RoleReadOnly)
 		app, err := models.GetAppById(data.AppId)
 		if err != nil {
 			o.ServeError(http.StatusBadRequest, "failed to get app", err)
@@ -94,6 +105,7 @@ func (o *AppController) GetRasps() {
 	if param.Perpage <= 0 {
 		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
 	}
+	o.CheckAppRole(param.AppId, models.RoleReadOnly)
 
 	app, err := models.GetAppById(param.AppId)
 	if err != nil {
@@ -127,6 +139,7 @@ func (o *AppController) GetAppSecret() {
 	if param.AppId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
 	}
+	o.CheckAppRole(param.AppId, models.RoleOperator)
 	secret, err := models.GetSecretByAppId(param.AppId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get secret", err)
@@ -148,12 +161,13 @@ func (o *AppController) RegenerateAppSecret() {
 	if param.AppId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
 	}
+	o.CheckAppRole(param.AppId, models.RoleOperator)
 	secret, err := models.RegenerateSecret(param.AppId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get secret", err)
 	}
 	models.AddOperation(param.AppId, models.OperationTypeRegenerateSecret,
-		o.Ctx.Input.IP(), "Reset AppSecret of "+param.AppId)
+		o.Ctx.Input.IP(), "Reset AppSecret of "+param.AppId, o.GetLoginUser().Name)
 	o.Serve(map[string]string{
 		"secret": secret,
 	})
@@ -162,8 +176,9 @@ func (o *AppController) RegenerateAppSecret() {
 // @router /general/config [post]
 func (o *AppController) UpdateAppGeneralConfig() {
 	var param struct {
-		AppId  string                 `json:"app_id"`
-		Config map[string]interface{} `json:"config"`
+		AppId            string                 `json:"app_id"`
+		Config           map[string]interface{} `json:"config"`
+		AllowUnknownKeys bool                   `json:"allow_unknown_keys"`
 	}
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
 	if err != nil {
@@ -175,16 +190,39 @@ func (o *AppController) UpdateAppGeneralConfig() {
 	if param.Config == nil {
 		o.ServeError(http.StatusBadRequest, "config can not be empty")
 	}
-	o.validateAppConfig(param.Config)
-	app, err := models.UpdateGeneralConfig(param.AppId, param.Config)
+	o.CheckAppRole(param.AppId, models.RoleOperator)
+	o.validateAppConfig(param.Config, param.AllowUnknownKeys)
+	app, err := models.UpdateGeneralConfig(param.AppId, param.Config, o.GetLoginUser().Name)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to update app general config", err)
 	}
 	models.AddOperation(param.AppId, models.OperationTypeUpdateGenerateConfig,
-		o.Ctx.Input.IP(), "Updated general config of "+param.AppId)
+		o.Ctx.Input.IP(), "Updated general config of "+param.AppId, o.GetLoginUser().Name)
 	o.Serve(app)
 }
 
+// @router /general/schema [post]
+func (o *AppController) GetGeneralConfigSchema() {
+	var param struct {
+		AppId    string `json:"app_id"`
+		Language string `json:"language"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	// the keys are filtered by the language of app if app_id is set
+	if param.AppId != "" {
+		o.CheckAppRole(param.AppId, models.RoleReadOnly)
+		app, err := models.GetAppById(param.AppId)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get app", err)
+		}
+		param.Language = app.Language
+	}
+	o.Serve(models.GetGeneralConfigFields(param.Language))
+}
+
 // @router /whitelist/config [post]
 func (o *AppController) UpdateAppWhiteListConfig() {
 	var param struct {
@@ -201,52 +239,103 @@ func (o *AppController) UpdateAppWhiteListConfig() {
 	if param.Config == nil {
 		o.ServeError(http.StatusBadRequest, "config can not be empty")
 	}
+	o.CheckAppRole(param.AppId, models.RoleOperator)
 	o.validateWhiteListConfig(param.Config)
-	app, err := models.UpdateWhiteListConfig(param.AppId, param.Config)
+	app, err := models.UpdateWhiteListConfig(param.AppId, param.Config, o.GetLoginUser().Name)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to update app whitelist config", err)
 	}
 	models.AddOperation(param.AppId, models.OperationTypeUpdateWhitelistConfig,
-		o.Ctx.Input.IP(), "Updated whitelist config of "+param.AppId)
+		o.Ctx.Input.IP(), "Updated whitelist config of "+param.AppId, o.GetLoginUser().Name)
 	o.Serve(app)
 }
 
-// @router / [post]
-func (o *AppController) Post() {
-	var app = &models.App{}
-
-	err := json.Unmarshal(o.Ctx.Input.RequestBody, app)
+// @router /whitelist/alarm [post]
+func (o *AppController) AddWhiteListFromAlarm() {
+	var param struct {
+		AppId   string `json:"app_id"`
+		AlarmId string `json:"alarm_id"`
+		Preview bool   `json:"preview"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
 	}
-	if app.Name == "" {
-		o.ServeError(http.StatusBadRequest, "app name cannot be empty")
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
 	}
-	if len(app.Name) > 64 {
-		o.ServeError(http.StatusBadRequest, "the length of app name cannot be greater than 64")
+	if param.AlarmId == "" {
+		o.ServeError(http.StatusBadRequest, "alarm_id can not be empty")
 	}
-	if app.Language == "" {
-		o.ServeError(http.StatusBadRequest, "app programming language cannot be empty")
+	if param.Preview {
+		o.CheckAppRole(param.AppId, models.RoleReadOnly)
+	} else {
+		o.CheckAppRole(param.AppId, models.RoleOperator)
 	}
-	if len(app.Language) > 64 {
-		o.ServeError(http.StatusBadRequest, "the length of app language name cannot be greater than 64")
+	app, err := models.GetAppById(param.AppId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get app", err)
 	}
-	languageSupported := false
-	for _, language := range supportLanguages {
-		if app.Language == language {
-			languageSupported = true
-			break
-		}
+	alarm, err := logs.GetAttackAlarmById(param.AppId, param.AlarmId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get the alarm", err)
 	}
-	if !languageSupported {
-		o.ServeError(http.StatusBadRequest, "Unsupported programming language: "+app.Language)
+	if alarm == nil {
+		o.ServeError(http.StatusBadRequest, "the alarm does not exist: "+param.AlarmId)
 	}
-	if len(app.Description) > 1024 {
-		o.ServeError(http.StatusBadRequest, "the length of the app description can not be greater than 1024")
+	item, err := models.NewWhitelistItemFromAlarm(alarm)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to generate whitelist from the alarm", err)
 	}
-	if len(app.SelectedPluginId) > 1024 {
-		o.ServeError(http.StatusBadRequest, "the length of the app selected_plugin_id can not be greater than 1024")
+	config, changed := models.MergeWhitelistConfig(app.WhitelistConfig, item)
+	o.validateWhiteListConfig(config)
+	result := map[string]interface{}{
+		"item":    item,
+		"changed": changed,
+		"config":  config,
+	}
+	if param.Preview {
+		o.Serve(result)
+		return
+	}
+	if changed {
+		app, err = models.UpdateWhiteListConfig(param.AppId, config, o.GetLoginUser().Name)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to update app whitelist config", err)
+		}
+		hooks := make([]string, 0, len(item.Hook))
+		for hook := range item.Hook {
+			hooks = append(hooks, hook)
+		}
+		models.AddOperation(param.AppId, models.OperationTypeUpdateWhitelistConfig, o.Ctx.Input.IP(),
+			"Added whitelist of "+item.Url+" for "+strings.Join(hooks, ",")+" from the false positive alarm "+
+				param.AlarmId, o.GetLoginUser().Name)
+		result["config"] = app.WhitelistConfig
+	}
+	// the incident of the request is marked as false positive as well
+	if requestId, ok := alarm["request_id"].(string); ok && requestId != "" {
+		incident, err := models.GetIncident(param.AppId, models.IncidentGroupByRequest, requestId)
+		if err == nil && incident.Status != models.IncidentStatusFalsePositive {
+			_, err = models.UpdateIncidentStatus(param.AppId, models.IncidentGroupByRequest, requestId,
+				models.IncidentStatusFalsePositive, "", o.GetLoginUser().Name)
+		}
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to mark the incident as false positive", err)
+		}
 	}
+	o.Serve(result)
+}
+
+// @router / [post]
+func (o *AppController) Post() {
+	o.CheckRole(models.RoleAdmin)
+	var app = &models.App{}
+
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, app)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	o.validNewApp(app)
 	if app.EmailAlarmConf.Enable {
 		o.validEmailConf(&app.EmailAlarmConf)
 	}
@@ -257,7 +346,7 @@ func (o *AppController) Post() {
 		o.validDingConf(&app.DingAlarmConf)
 	}
 	if app.GeneralConfig != nil {
-		o.validateAppConfig(app.GeneralConfig)
+		o.validateAppConfig(app.GeneralConfig, false)
 		configTime := time.Now().UnixNano()
 		app.ConfigTime = configTime
 	}
@@ -273,10 +362,42 @@ func (o *AppController) Post() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "create app failed", err)
 	}
-	models.AddOperation(app.Id, models.OperationTypeAddApp, o.Ctx.Input.IP(), "New app created with name "+app.Name)
+	models.AddOperation(app.Id, models.OperationTypeAddApp, o.Ctx.Input.IP(),
+		"New app created with name "+app.Name, o.GetLoginUser().Name)
 	o.Serve(app)
 }
 
+func (o *AppController) validNewApp(app *models.App) {
+	if app.Name == "" {
+		o.ServeError(http.StatusBadRequest, "app name cannot be empty")
+	}
+	if len(app.Name) > 64 {
+		o.ServeError(http.StatusBadRequest, "the length of app name cannot be greater than 64")
+	}
+	if app.Language == "" {
+		o.ServeError(http.StatusBadRequest, "app programming language cannot be empty")
+	}
+	if len(app.Language) > 64 {
+		o.ServeError(http.StatusBadRequest, "the length of app language name cannot be greater than 64")
+	}
+	languageSupported := false
+	for _, language := range supportLanguages {
+		if app.Language == language {
+			languageSupported = true
+			break
+		}
+	}
+	if !languageSupported {
+		o.ServeError(http.StatusBadRequest, "Unsupported programming language: "+app.Language)
+	}
+	if len(app.Description) > 1024 {
+		o.ServeError(http.StatusBadRequest, "the length of the app description can not be greater than 1024")
+	}
+	if len(app.SelectedPluginId) > 1024 {
+		o.ServeError(http.StatusBadRequest, "the length of the app selected_plugin_id can not be greater than 1024")
+	}
+}
+
 // @router /config [post]
 func (o *AppController) ConfigApp() {
 	var param struct {
@@ -292,6 +413,7 @@ func (o *AppController) ConfigApp() {
 	if param.AppId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
 	}
+	o.CheckAppRole(param.AppId, models.RoleOperator)
 	_, err = models.GetAppById(param.AppId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get app", err)
@@ -327,7 +449,8 @@ func (o *AppController) ConfigApp() {
 		o.ServeError(http.StatusBadRequest, "failed to update app config", err)
 	}
 	operationData, err := json.Marshal(updateData)
-	models.AddOperation(app.Id, models.OperationTypeEditApp, o.Ctx.Input.IP(), "Updated app info for "+param.AppId+": "+string(operationData))
+	models.AddOperation(app.Id, models.OperationTypeEditApp, o.Ctx.Input.IP(),
+		"Updated app info for "+param.AppId+": "+string(operationData), o.GetLoginUser().Name)
 	o.Serve(app)
 }
 
@@ -401,6 +524,7 @@ func (o *AppController) validHttpAlarm(conf *models.HttpAlarmConf) {
 
 // @router /delete [post]
 func (o *AppController) Delete() {
+	o.CheckRole(models.RoleAdmin)
 	var app = &models.App{}
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, app)
 	if err != nil {
@@ -430,7 +554,36 @@ func (o *AppController) Delete() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to remove plugin by app_id", err)
 	}
-	models.AddOperation(app.Id, models.OperationTypeDeleteApp, o.Ctx.Input.IP(), "Deleted app with name "+app.Name)
+	err = models.RemoveAppRoles(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove user roles by app_id", err)
+	}
+	err = models.RemoveAlarmRuleByAppId(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove alarm rules by app_id", err)
+	}
+	err = models.RemoveAlarmCursor(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove alarm cursor by app_id", err)
+	}
+	err = models.RemoveIncidentByAppId(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove incidents by app_id", err)
+	}
+	err = models.RemovePluginRolloutByAppId(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove plugin rollouts by app_id", err)
+	}
+	err = models.RemoveRaspGroupByAppId(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove rasp groups by app_id", err)
+	}
+	err = models.RemoveConfigRevisionByAppId(app.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove config revisions by app_id", err)
+	}
+	models.AddOperation(app.Id, models.OperationTypeDeleteApp, o.Ctx.Input.IP(),
+		"Deleted app with name "+app.Name, o.GetLoginUser().Name)
 	o.ServeWithEmptyData()
 }
 
@@ -459,52 +612,50 @@ func (o *AppController) validAppArrayParam(param []string, paramName string,
 	return param
 }
 
-func (o *AppController) validateAppConfig(config map[string]interface{}) {
-	if config == nil {
-		o.ServeError(http.StatusBadRequest, "the config cannot be nil")
-	}
-	for key, value := range config {
-		if value == nil {
-			o.ServeError(http.StatusBadRequest, "the value of "+key+" config cannot be nil")
-		}
-		if v, ok := value.(string); ok {
-			if len(v) >= 512 {
-				o.ServeError(http.StatusBadRequest,
-					"the length of config key "+key+" must less tha 1024")
-			}
-		}
+func (o *AppController) validateAppConfig(config map[string]interface{}, allowUnknownKeys bool) {
+	if err := checkGeneralConfig(config, allowUnknownKeys); err != nil {
+		o.ServeError(http.StatusBadRequest, err.Error())
 	}
 }
 
 func (o *AppController) validateWhiteListConfig(config []models.WhitelistConfigItem) {
+	if err := checkWhitelistConfig(config); err != nil {
+		o.ServeError(http.StatusBadRequest, err.Error())
+	}
+}
+
+func checkGeneralConfig(config map[string]interface{}, allowUnknownKeys bool) error {
+	return models.ValidateGeneralConfig(config, allowUnknownKeys)
+}
+
+func checkWhitelistConfig(config []models.WhitelistConfigItem) error {
 	if config == nil {
-		o.ServeError(http.StatusBadRequest, "the config cannot be nil")
+		return errors.New("the config cannot be nil")
 	}
 	if len(config) > 200 {
-		o.ServeError(http.StatusBadRequest,
-			"the count of whitelist config items must be between (0,200]")
+		return errors.New("the count of whitelist config items must be between (0,200]")
 	}
 	for _, value := range config {
 		if len(value.Url) > 200 || len(value.Url) == 0 {
-			o.ServeError(http.StatusBadRequest,
-				"the length of whitelist config url must be between [1,200]")
+			return errors.New("the length of whitelist config url must be between [1,200]")
 		}
 		for key := range value.Hook {
 			if len(key) > 128 {
-				o.ServeError(http.StatusBadRequest,
-					"the length of hook's type can not be greater 128")
+				return errors.New("the length of hook's type can not be greater 128")
 			}
 		}
 	}
+	return nil
 }
 
 // @router /alarm/config [post]
 func (o *AppController) ConfigAlarm() {
 	var param struct {
-		AppId          string                 `json:"app_id"`
-		EmailAlarmConf *models.EmailAlarmConf `json:"email_alarm_conf,omitempty"`
-		DingAlarmConf  *models.DingAlarmConf  `json:"ding_alarm_conf,omitempty"`
-		HttpAlarmConf  *models.HttpAlarmConf  `json:"http_alarm_conf,omitempty"`
+		AppId            string                  `json:"app_id"`
+		EmailAlarmConf   *models.EmailAlarmConf  `json:"email_alarm_conf,omitempty"`
+		DingAlarmConf    *models.DingAlarmConf   `json:"ding_alarm_conf,omitempty"`
+		HttpAlarmConf    *models.HttpAlarmConf   `json:"http_alarm_conf,omitempty"`
+		ChannelAlarmConf models.ChannelAlarmConf `json:"channel_alarm_conf,omitempty"`
 	}
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
 	if err != nil {
@@ -513,6 +664,7 @@ func (o *AppController) ConfigAlarm() {
 	if param.AppId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
 	}
+	o.CheckAppRole(param.AppId, models.RoleOperator)
 	app, err := models.GetAppByIdWithoutMask(param.AppId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get app", err)
@@ -533,6 +685,8 @@ func (o *AppController) ConfigAlarm() {
 		}
 		o.validDingConf(param.DingAlarmConf)
 	}
+	channelConf := param.ChannelAlarmConf
+	param.ChannelAlarmConf = nil
 	content, err := json.Marshal(param)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to encode param to json", err)
@@ -541,12 +695,24 @@ func (o *AppController) ConfigAlarm() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to decode param json", err)
 	}
-	app, err = models.UpdateAppById(param.AppId, updateData)
+	// only the channels in the request are updated
+	for name, conf := range channelConf {
+		notifier, ok := models.GetConfigurableNotifier(name)
+		if !ok {
+			o.ServeError(http.StatusBadRequest, "unknown alarm channel: "+name)
+		}
+		app.ChannelAlarmConf.RestoreSecret(name, conf)
+		if err := notifier.ValidateConf(conf); err != nil {
+			o.ServeError(http.StatusBadRequest, "invalid "+name+" alarm config: "+err.Error())
+		}
+		updateData["channel_alarm_conf."+name] = conf
+	}
+	app, err = models.UpdateAlarmConfig(param.AppId, updateData, o.GetLoginUser().Name)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to update alarm config", err)
 	}
 	models.AddOperation(app.Id, models.OperationTypeUpdateAlarmConfig, o.Ctx.Input.IP(),
-		"Alarm configuration updated for "+param.AppId)
+		"Alarm configuration updated for "+param.AppId, o.GetLoginUser().Name)
 	o.Serve(app)
 }
 
@@ -563,6 +729,7 @@ func (o *AppController) GetPlugins() {
 	if param.Perpage <= 0 {
 		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
 	}
+	o.CheckAppRole(param.AppId, models.RoleReadOnly)
 
 	app, err := models.GetAppById(param.AppId)
 	if err != nil {
@@ -595,6 +762,7 @@ func (o *AppController) GetSelectedPlugin() {
 	if appId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id cannot be empty")
 	}
+	o.CheckAppRole(appId, models.RoleReadOnly)
 	plugin, err := models.GetSelectedPlugin(appId, false)
 	if mgo.ErrNotFound == err || plugin == nil {
 		o.ServeWithEmptyData()
@@ -621,15 +789,43 @@ func (o *AppController) SetSelectedPlugin() {
 	if pluginId == "" {
 		o.ServeError(http.StatusBadRequest, "plugin_id cannot be empty")
 	}
+	o.CheckAppRole(appId, models.RoleOperator)
 	err = models.SetSelectedPlugin(appId, pluginId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to set selected plugin", err)
 	}
 	models.AddOperation(appId, models.OperationTypeSetSelectedPlugin, o.Ctx.Input.IP(),
-		"Deployed plugin for "+appId+": "+pluginId)
+		"Deployed plugin for "+appId+": "+pluginId, o.GetLoginUser().Name)
 	o.ServeWithEmptyData()
 }
 
+// @router /plugin/signature/config [post]
+func (o *AppController) ConfigPluginSignature() {
+	var param struct {
+		AppId                  string `json:"app_id"`
+		RequirePluginSignature *bool  `json:"require_plugin_signature"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id cannot be empty")
+	}
+	if param.RequirePluginSignature == nil {
+		o.ServeError(http.StatusBadRequest, "require_plugin_signature cannot be empty")
+	}
+	o.CheckAppRole(param.AppId, models.RoleAdmin)
+	app, err := models.UpdatePluginSignatureConfig(param.AppId, *param.RequirePluginSignature)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to update plugin signature config", err)
+	}
+	models.AddOperation(app.Id, models.OperationTypeUpdatePluginSignature, o.Ctx.Input.IP(),
+		"Updated plugin signature config for "+app.Id+", require signed plugins: "+
+			strconv.FormatBool(app.RequirePluginSignature), o.GetLoginUser().Name)
+	o.Serve(app)
+}
+
 // @router /email/test [post]
 func (o *AppController) TestEmail() {
 	var param map[string]string
@@ -641,6 +837,7 @@ func (o *AppController) TestEmail() {
 	if appId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id cannot be empty")
 	}
+	o.CheckAppRole(appId, models.RoleOperator)
 	app, err := models.GetAppByIdWithoutMask(appId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "can not find the app", err)
@@ -666,6 +863,7 @@ func (o *AppController) TestDing(config map[string]interface{}) {
 	if appId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id cannot be empty")
 	}
+	o.CheckAppRole(appId, models.RoleOperator)
 	app, err := models.GetAppByIdWithoutMask(appId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "can not find the app", err)
@@ -691,6 +889,7 @@ func (o *AppController) TestHttp(config map[string]interface{}) {
 	if appId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id cannot be empty")
 	}
+	o.CheckAppRole(appId, models.RoleOperator)
 	app, err := models.GetAppByIdWithoutMask(appId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "can not find the app", err)
@@ -704,3 +903,45 @@ func (o *AppController) TestHttp(config map[string]interface{}) {
 	}
 	o.ServeWithEmptyData()
 }
+
+// @router /slack/test [post]
+func (o *AppController) TestSlack() {
+	o.testChannelAlarm("slack")
+}
+
+// @router /teams/test [post]
+func (o *AppController) TestTeams() {
+	o.testChannelAlarm("teams")
+}
+
+// @router /wecom/test [post]
+func (o *AppController) TestWecom() {
+	o.testChannelAlarm("wecom")
+}
+
+// @router /feishu/test [post]
+func (o *AppController) TestFeishu() {
+	o.testChannelAlarm("feishu")
+}
+
+func (o *AppController) testChannelAlarm(name string) {
+	var param map[string]string
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	appId := param["app_id"]
+	if appId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id cannot be empty")
+	}
+	o.CheckAppRole(appId, models.RoleOperator)
+	app, err := models.GetAppByIdWithoutMask(appId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "can not find the app", err)
+	}
+	err = models.TestNotifier(app, name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to test "+name+" alarm", err)
+	}
+	o.ServeWithEmptyData()
+}
@@ -0,0 +1,170 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"rasp-cloud/models"
+	"rasp-cloud/tools/codec"
+	"time"
+)
+
+const (
+	// the max size of the bundle, which includes the plugin
+	maxAppBundleSize = 20 * 1024 * 1024
+)
+
+// @router /export [get]
+func (o *AppController) Export() {
+	appId := o.GetString("app_id")
+	if appId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	format := o.GetString("format", codec.FormatJson)
+	if format != codec.FormatJson && format != codec.FormatYaml {
+		o.ServeError(http.StatusBadRequest, "format must be json or yaml")
+	}
+	includeSecrets, err := o.GetBool("include_secrets", false)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "include_secrets must be a boolean", err)
+	}
+	// the secrets of alarm config are only exported to the admin
+	if includeSecrets {
+		o.CheckAppRole(appId, models.RoleAdmin)
+	} else {
+		o.CheckAppRole(appId, models.RoleReadOnly)
+	}
+	bundle, err := models.ExportAppBundle(appId, includeSecrets)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to export app", err)
+	}
+	content, err := models.EncodeAppBundle(bundle, format)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to encode app bundle", err)
+	}
+	if includeSecrets {
+		models.AddOperation(appId, models.OperationTypeExportApp, o.Ctx.Input.IP(),
+			"Exported app "+appId+" with secrets", o.GetLoginUser().Name)
+	}
+	o.Ctx.Output.Header("Content-Type", "text/plain")
+	o.Ctx.Output.Header("Content-Disposition", "attachment;filename="+bundle.Name+"-"+
+		time.Now().Format("20060102150405")+"."+format)
+	o.Ctx.Output.Body(content)
+}
+
+// @router /import [post]
+func (o *AppController) Import() {
+	appId := o.GetString("app_id")
+	var content []byte
+	uploadFile, _, err := o.GetFile("bundle")
+	if err == nil {
+		defer uploadFile.Close()
+		content, err = ioutil.ReadAll(io.LimitReader(uploadFile, maxAppBundleSize+1))
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to read upload bundle", err)
+		}
+	} else {
+		content = o.Ctx.Input.RequestBody
+	}
+	if len(content) == 0 {
+		o.ServeError(http.StatusBadRequest, "the bundle can not be empty")
+	}
+	if len(content) > maxAppBundleSize {
+		o.ServeError(http.StatusBadRequest, "the size of bundle can not be greater than 20MB")
+	}
+	bundle, err := models.ParseAppBundle(content)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to parse app bundle", err)
+	}
+	if bundle.GeneralConfig != nil {
+		if err := checkGeneralConfig(bundle.GeneralConfig, true); err != nil {
+			o.ServeError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if bundle.WhitelistConfig != nil {
+		o.validateWhiteListConfig(bundle.WhitelistConfig)
+	}
+	if bundle.AlarmConfig != nil {
+		o.validBundleAlarmConfig(bundle.AlarmConfig)
+	}
+	if bundle.Plugin != nil && bundle.Plugin.Content == "" {
+		o.ServeError(http.StatusBadRequest, "the content of plugin can not be empty")
+	}
+
+	// a new app is created with the name and language of bundle if app_id is empty
+	if appId == "" {
+		o.CheckRole(models.RoleAdmin)
+		if name := o.GetString("name"); name != "" {
+			bundle.Name = name
+		}
+		app := &models.App{
+			Name:            bundle.Name,
+			Language:        bundle.Language,
+			Description:     bundle.Description,
+			WhitelistConfig: make([]models.WhitelistConfigItem, 0),
+		}
+		o.validNewApp(app)
+		app, err = models.AddApp(app)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "create app failed", err)
+		}
+		models.AddOperation(app.Id, models.OperationTypeAddApp, o.Ctx.Input.IP(),
+			"New app created with name "+app.Name, o.GetLoginUser().Name)
+		appId = app.Id
+	} else {
+		o.CheckAppRole(appId, models.RoleOperator)
+		app, err := models.GetAppById(appId)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get app", err)
+		}
+		if bundle.Language != "" && bundle.Language != app.Language {
+			o.ServeError(http.StatusBadRequest, "the bundle of "+bundle.Language+
+				" app can not be imported to the "+app.Language+" app")
+		}
+	}
+	app, warnings, err := models.ImportAppBundle(appId, bundle, o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to import app bundle", err)
+	}
+	models.AddOperation(app.Id, models.OperationTypeImportApp, o.Ctx.Input.IP(),
+		"Imported app bundle of "+bundle.Name+" to "+app.Id, o.GetLoginUser().Name)
+	o.Serve(map[string]interface{}{
+		"app":      app,
+		"warnings": warnings,
+	})
+}
+
+func (o *AppController) validBundleAlarmConfig(config *models.AlarmConfig) {
+	if config.EmailAlarmConf.Enable {
+		o.validEmailConf(&config.EmailAlarmConf)
+	}
+	if config.HttpAlarmConf.Enable {
+		o.validHttpAlarm(&config.HttpAlarmConf)
+	}
+	if config.DingAlarmConf.Enable {
+		o.validDingConf(&config.DingAlarmConf)
+	}
+	for name, conf := range config.ChannelAlarmConf {
+		notifier, ok := models.GetConfigurableNotifier(name)
+		if !ok {
+			o.ServeError(http.StatusBadRequest, "unknown alarm channel: "+name)
+		}
+		if err := notifier.ValidateConf(conf); err != nil {
+			o.ServeError(http.StatusBadRequest, "invalid "+name+" alarm config: "+err.Error())
+		}
+	}
+}
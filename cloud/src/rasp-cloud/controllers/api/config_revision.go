@@ -0,0 +1,130 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"rasp-cloud/models"
+	"strconv"
+)
+
+// @router /config/revision/get [post]
+func (o *AppController) GetConfigRevisions() {
+	var param struct {
+		AppId    string `json:"app_id"`
+		Type     string `json:"type"`
+		PluginId string `json:"plugin_id"`
+		Page     int    `json:"page"`
+		Perpage  int    `json:"perpage"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	if param.Type != "" {
+		o.validConfigType(param.Type)
+	}
+	if param.Page <= 0 {
+		o.ServeError(http.StatusBadRequest, "page must be greater than 0")
+	}
+	if param.Perpage <= 0 || param.Perpage > 100 {
+		o.ServeError(http.StatusBadRequest, "perpage must be between (0,100]")
+	}
+	o.CheckAppRole(param.AppId, models.RoleReadOnly)
+	total, revisions, err := models.GetConfigRevisions(param.AppId, param.Type, param.PluginId,
+		param.Page, param.Perpage)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get config revisions", err)
+	}
+	o.Serve(map[string]interface{}{
+		"total":      total,
+		"total_page": math.Ceil(float64(total) / float64(param.Perpage)),
+		"page":       param.Page,
+		"perpage":    param.Perpage,
+		"data":       revisions,
+	})
+}
+
+// @router /config/revision/diff [post]
+func (o *AppController) DiffConfigRevision() {
+	var param struct {
+		RevisionId     string `json:"revision_id"`
+		BaseRevisionId string `json:"base_revision_id"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.RevisionId == "" {
+		o.ServeError(http.StatusBadRequest, "revision_id can not be empty")
+	}
+	if param.BaseRevisionId == "" {
+		o.ServeError(http.StatusBadRequest, "base_revision_id can not be empty")
+	}
+	revision := o.getConfigRevision(param.RevisionId, models.RoleReadOnly)
+	baseRevision := o.getConfigRevision(param.BaseRevisionId, models.RoleReadOnly)
+	result, err := models.DiffConfigRevision(baseRevision, revision)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to diff config revisions", err)
+	}
+	o.Serve(result)
+}
+
+// @router /config/revision/rollback [post]
+func (o *AppController) RollbackConfigRevision() {
+	var param struct {
+		RevisionId       string `json:"revision_id"`
+		AllowUnknownKeys bool   `json:"allow_unknown_keys"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.RevisionId == "" {
+		o.ServeError(http.StatusBadRequest, "revision_id can not be empty")
+	}
+	revision := o.getConfigRevision(param.RevisionId, models.RoleOperator)
+	app, err := models.RollbackConfigRevision(revision, param.AllowUnknownKeys, o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to roll back config", err)
+	}
+	models.AddOperation(revision.AppId, models.OperationTypeRollbackConfig, o.Ctx.Input.IP(),
+		"Rolled back "+revision.Type+" config of "+revision.AppId+" to version "+
+			strconv.Itoa(revision.Version), o.GetLoginUser().Name)
+	o.Serve(app)
+}
+
+func (o *AppController) getConfigRevision(revisionId string, role string) *models.ConfigRevision {
+	revision, err := models.GetConfigRevisionById(revisionId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get config revision", err)
+	}
+	o.CheckAppRole(revision.AppId, role)
+	return revision
+}
+
+func (o *AppController) validConfigType(configType string) {
+	for _, item := range models.ConfigTypes {
+		if item == configType {
+			return
+		}
+	}
+	o.ServeError(http.StatusBadRequest, "unknown config type: "+configType)
+}
@@ -22,6 +22,7 @@ import (
 	"rasp-cloud/models/logs"
 	"math"
 	"time"
+	"github.com/olivere/elastic"
 )
 
 // Operations about attack alarm message
@@ -37,11 +38,13 @@ func (o *AttackAlarmController) AggregationWithTime() {
 		o.ServeError(http.StatusBadRequest, "json decode error", err)
 	}
 	if param.AppId != "" {
+		o.CheckAppRole(param.AppId, models.RoleReadOnly)
 		_, err = models.GetAppById(param.AppId)
 		if err != nil {
 			o.ServeError(http.StatusBadRequest, "failed to get the app: "+param.AppId)
 		}
 	} else {
+		o.CheckRole(models.RoleReadOnly)
 		param.AppId = "*"
 	}
 	if param.StartTime <= 0 {
@@ -120,11 +123,13 @@ func (o *AttackAlarmController) Search() {
 		o.ServeError(http.StatusBadRequest, "search data can not be empty")
 	}
 	if param.Data.AppId != "" {
+		o.CheckAppRole(param.Data.AppId, models.RoleReadOnly)
 		_, err := models.GetAppById(param.Data.AppId)
 		if err != nil {
 			o.ServeError(http.StatusBadRequest, "cannot get the app: "+param.Data.AppId, err)
 		}
 	} else {
+		o.CheckRole(models.RoleReadOnly)
 		param.Data.AppId = "*"
 	}
 	if param.Data.StartTime <= 0 {
@@ -142,6 +147,13 @@ func (o *AttackAlarmController) Search() {
 	if param.Perpage <= 0 {
 		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
 	}
+	var incidentQuery elastic.Query
+	if param.Data.Status != "" {
+		if !isValidIncidentStatus(param.Data.Status) {
+			o.ServeError(http.StatusBadRequest, "invalid incident status: "+param.Data.Status)
+		}
+		incidentQuery = models.GetIncidentQuery(param.Data.Status)
+	}
 	content, err := json.Marshal(param.Data)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to encode search data", err)
@@ -154,11 +166,17 @@ func (o *AttackAlarmController) Search() {
 	delete(searchData, "start_time")
 	delete(searchData, "end_time")
 	delete(searchData, "app_id")
-	total, result, err := logs.SearchLogs(param.Data.StartTime, param.Data.EndTime, searchData, "event_time",
-		param.Page, param.Perpage, false, logs.AliasAttackIndexName+"-"+param.Data.AppId)
+	delete(searchData, "status")
+	total, result, err := logs.SearchLogsWithFilter(param.Data.StartTime, param.Data.EndTime, searchData,
+		incidentQuery, "event_time", param.Page, param.Perpage, false,
+		logs.AliasAttackIndexName+"-"+param.Data.AppId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to search data from es", err)
 	}
+	err = models.SetAlarmIncidents(result)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get incidents of alarms", err)
+	}
 	o.Serve(map[string]interface{}{
 		"total":      total,
 		"total_page": math.Ceil(float64(total) / float64(param.Perpage)),
@@ -170,11 +188,13 @@ func (o *AttackAlarmController) Search() {
 
 func (o *AttackAlarmController) validFieldAggrParam(param *logs.AggrFieldParam) {
 	if param.AppId != "" {
+		o.CheckAppRole(param.AppId, models.RoleReadOnly)
 		_, err := models.GetAppById(param.AppId)
 		if err != nil {
 			o.ServeError(http.StatusBadRequest, "cannot get the app: "+param.AppId, err)
 		}
 	} else {
+		o.CheckRole(models.RoleReadOnly)
 		param.AppId = "*"
 	}
 	if param.StartTime <= 0 {
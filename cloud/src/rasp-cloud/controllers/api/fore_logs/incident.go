@@ -0,0 +1,169 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package fore_logs
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"rasp-cloud/models"
+)
+
+type incidentParam struct {
+	AppId    string `json:"app_id"`
+	GroupBy  string `json:"group_by"`
+	GroupKey string `json:"group_key"`
+	Status   string `json:"status"`
+	Assignee string `json:"assignee"`
+	Content  string `json:"content"`
+	Page     int    `json:"page"`
+	Perpage  int    `json:"perpage"`
+}
+
+// @router /incident/get [post]
+func (o *AttackAlarmController) GetIncident() {
+	param := o.getIncidentParam(models.RoleReadOnly)
+	incident, err := models.GetIncident(param.AppId, param.GroupBy, param.GroupKey)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get incident", err)
+	}
+	o.Serve(incident)
+}
+
+// @router /incident/search [post]
+func (o *AttackAlarmController) SearchIncident() {
+	var param incidentParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "json decode error", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(param.AppId, models.RoleReadOnly)
+	if param.Status != "" && !isValidIncidentStatus(param.Status) {
+		o.ServeError(http.StatusBadRequest, "invalid incident status: "+param.Status)
+	}
+	if param.Page <= 0 {
+		o.ServeError(http.StatusBadRequest, "page must be greater than 0")
+	}
+	if param.Perpage <= 0 {
+		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
+	}
+	total, incidents, err := models.SearchIncidents(param.AppId, param.Status, param.Assignee,
+		param.Page, param.Perpage)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to search incidents", err)
+	}
+	o.Serve(map[string]interface{}{
+		"total":      total,
+		"total_page": math.Ceil(float64(total) / float64(param.Perpage)),
+		"page":       param.Page,
+		"perpage":    param.Perpage,
+		"data":       incidents,
+	})
+}
+
+// @router /incident/status [post]
+func (o *AttackAlarmController) UpdateIncidentStatus() {
+	param := o.getIncidentParam(models.RoleOperator)
+	if !isValidIncidentStatus(param.Status) {
+		o.ServeError(http.StatusBadRequest, "invalid incident status: "+param.Status)
+	}
+	// the reason of the status change is optional
+	o.validIncidentComment(param.Content)
+	incident, err := models.UpdateIncidentStatus(param.AppId, param.GroupBy, param.GroupKey, param.Status,
+		param.Content, o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to update incident status", err)
+	}
+	o.Serve(incident)
+}
+
+// @router /incident/assign [post]
+func (o *AttackAlarmController) AssignIncident() {
+	param := o.getIncidentParam(models.RoleOperator)
+	// the empty assignee unassigns the incident
+	if param.Assignee != "" {
+		assignee, err := models.GetUserByName(param.Assignee)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get the assignee: "+param.Assignee, err)
+		}
+		if !assignee.HasAppRole(param.AppId, models.RoleReadOnly) {
+			o.ServeError(http.StatusBadRequest, "the assignee has no permission on the app")
+		}
+	}
+	incident, err := models.UpdateIncidentAssignee(param.AppId, param.GroupBy, param.GroupKey, param.Assignee,
+		o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to assign incident", err)
+	}
+	o.Serve(incident)
+}
+
+// @router /incident/comment [post]
+func (o *AttackAlarmController) CommentIncident() {
+	param := o.getIncidentParam(models.RoleOperator)
+	if param.Content == "" {
+		o.ServeError(http.StatusBadRequest, "content can not be empty")
+	}
+	o.validIncidentComment(param.Content)
+	incident, err := models.AddIncidentComment(param.AppId, param.GroupBy, param.GroupKey, param.Content,
+		o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to add incident comment", err)
+	}
+	o.Serve(incident)
+}
+
+func (o *AttackAlarmController) getIncidentParam(role string) *incidentParam {
+	var param incidentParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "json decode error", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(param.AppId, role)
+	if _, err = models.GetAppById(param.AppId); err != nil {
+		o.ServeError(http.StatusBadRequest, "cannot get the app: "+param.AppId, err)
+	}
+	if param.GroupBy != models.IncidentGroupByRequest && param.GroupBy != models.IncidentGroupByStack {
+		o.ServeError(http.StatusBadRequest, "group_by must be request_id or stack_md5")
+	}
+	if param.GroupKey == "" {
+		o.ServeError(http.StatusBadRequest, "group_key can not be empty")
+	}
+	if len(param.GroupKey) > 256 {
+		o.ServeError(http.StatusBadRequest, "the length of group_key can not be greater than 256")
+	}
+	return &param
+}
+
+func (o *AttackAlarmController) validIncidentComment(content string) {
+	if len(content) > 4096 {
+		o.ServeError(http.StatusBadRequest, "the length of content can not be greater than 4096")
+	}
+}
+
+func isValidIncidentStatus(status string) bool {
+	for _, item := range models.IncidentStatuses {
+		if item == status {
+			return true
+		}
+	}
+	return false
+}
@@ -39,11 +39,13 @@ func (o *PolicyAlarmController) Search() {
 		o.ServeError(http.StatusBadRequest, "search data can not be empty")
 	}
 	if param.Data.AppId != "" {
+		o.CheckAppRole(param.Data.AppId, models.RoleReadOnly)
 		_, err := models.GetAppById(param.Data.AppId)
 		if err != nil {
 			o.ServeError(http.StatusBadRequest, "cannot get the app: "+param.Data.AppId, err)
 		}
 	} else {
+		o.CheckRole(models.RoleReadOnly)
 		param.Data.AppId = "*"
 	}
 	if param.Data.StartTime <= 0 {
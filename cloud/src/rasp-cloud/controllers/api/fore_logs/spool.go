@@ -0,0 +1,46 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package fore_logs
+
+import (
+	"fmt"
+	"net/http"
+	"rasp-cloud/controllers"
+	"rasp-cloud/models"
+	"rasp-cloud/models/logs"
+)
+
+// Operations about the disk spool of alarms
+type SpoolController struct {
+	controllers.BaseController
+}
+
+// @router /stats [get,post]
+func (o *SpoolController) Stats() {
+	o.CheckRole(models.RoleReadOnly)
+	o.Serve(logs.GetSpoolStats())
+}
+
+// @router /replay [post]
+func (o *SpoolController) Replay() {
+	o.CheckRole(models.RoleAdmin)
+	result, err := logs.ReplaySpoolQuarantine()
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to replay the quarantined alarms", err)
+	}
+	models.AddOperation("", models.OperationTypeReplayAlarmSpool, o.Ctx.Input.IP(),
+		"Replayed the quarantined alarms: "+fmt.Sprintf("%v", result), o.GetLoginUser().Name)
+	o.Serve(result)
+}
@@ -57,6 +57,11 @@ func (o *OperationController) Search() {
 	if param.StartTime > param.EndTime {
 		o.ServeError(http.StatusBadRequest, "start_time cannot be greater than end_time")
 	}
+	if param.Data.AppId == "" {
+		o.CheckRole(models.RoleReadOnly)
+	} else {
+		o.CheckAppRole(param.Data.AppId, models.RoleReadOnly)
+	}
 
 	var result = make(map[string]interface{})
 	total, operations, err := models.FindOperation(param.Data, param.StartTime, param.EndTime, param.Page, param.Perpage)
@@ -18,11 +18,13 @@ import (
 	"encoding/json"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"rasp-cloud/controllers"
 	"rasp-cloud/models"
 	"rasp-cloud/mongo"
+	"strings"
 )
 
 // Operations about plugin
@@ -36,6 +38,7 @@ func (o *PluginController) Upload() {
 	if appId == "" {
 		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
 	}
+	o.CheckAppRole(appId, models.RoleOperator)
 	_, err := models.GetAppById(appId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get app", err)
@@ -56,12 +59,22 @@ func (o *PluginController) Upload() {
 		o.ServeError(http.StatusBadRequest, "failed to read upload plugin", err)
 	}
 
-	latestPlugin, err := models.AddPlugin(pluginContent, appId)
+	// the detached signature is uploaded as the signature file or parameter
+	pluginSignature := o.GetString("signature")
+	if signatureFile, _, err := o.GetFile("signature"); err == nil {
+		defer signatureFile.Close()
+		content, err := ioutil.ReadAll(io.LimitReader(signatureFile, 1024))
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to read upload signature", err)
+		}
+		pluginSignature = strings.TrimSpace(string(content))
+	}
+	latestPlugin, err := models.AddPlugin(pluginContent, pluginSignature, appId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to add plugin", err)
 	}
 	models.AddOperation(appId, models.OperationTypeUploadPlugin, o.Ctx.Input.IP(),
-		"New plugin uploaded: "+latestPlugin.Id)
+		"New plugin uploaded: "+latestPlugin.Id, o.GetLoginUser().Name)
 	o.Serve(latestPlugin)
 }
 
@@ -80,6 +93,7 @@ func (o *PluginController) Get() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get plugin", err)
 	}
+	o.CheckAppRole(plugin.AppId, models.RoleReadOnly)
 	o.Serve(plugin)
 }
 
@@ -90,6 +104,7 @@ func (o *PluginController) Download() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get plugin", err)
 	}
+	o.CheckAppRole(plugin.AppId, models.RoleReadOnly)
 	o.Ctx.Output.Header("Content-Type", "text/plain")
 	if plugin.Name == "" {
 		plugin.Name = "plugin"
@@ -101,8 +116,9 @@ func (o *PluginController) Download() {
 // @router /algorithm/config [post]
 func (o *PluginController) UpdateAppAlgorithmConfig() {
 	var param struct {
-		PluginId string                 `json:"id"`
-		Config   map[string]interface{} `json:"config"`
+		PluginId         string                 `json:"id"`
+		Config           map[string]interface{} `json:"config"`
+		AllowUnknownKeys bool                   `json:"allow_unknown_keys"`
 	}
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
 	if err != nil {
@@ -114,12 +130,14 @@ func (o *PluginController) UpdateAppAlgorithmConfig() {
 	if param.Config == nil {
 		o.ServeError(http.StatusBadRequest, "config can not be empty")
 	}
-	appId, err := models.UpdateAlgorithmConfig(param.PluginId, param.Config)
+	o.checkPluginRole(param.PluginId, models.RoleOperator)
+	appId, err := models.UpdateAlgorithmConfig(param.PluginId, param.Config, param.AllowUnknownKeys,
+		o.GetLoginUser().Name)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to update algorithm config", err)
 	}
 	models.AddOperation(appId, models.OperationTypeUpdateAlgorithmConfig,
-		o.Ctx.Input.IP(), "Algorithm config updated for plugin: "+param.PluginId)
+		o.Ctx.Input.IP(), "Algorithm config updated for plugin: "+param.PluginId, o.GetLoginUser().Name)
 	o.ServeWithEmptyData()
 }
 
@@ -134,15 +152,60 @@ func (o *PluginController) RestoreAlgorithmConfig() {
 	if pluginId == "" {
 		o.ServeError(http.StatusBadRequest, "plugin_id cannot be empty")
 	}
-	appId, err := models.RestoreDefaultConfiguration(pluginId)
+	o.checkPluginRole(pluginId, models.RoleOperator)
+	appId, err := models.RestoreDefaultConfiguration(pluginId, o.GetLoginUser().Name)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to restore the default algorithm config", err)
 	}
 	models.AddOperation(appId, models.OperationTypeRestorePlugin, o.Ctx.Input.IP(),
-		"Restored algorithm config for plugin: "+pluginId)
+		"Restored algorithm config for plugin: "+pluginId, o.GetLoginUser().Name)
 	o.ServeWithEmptyData()
 }
 
+// @router /diff [post]
+func (o *PluginController) Diff() {
+	var param struct {
+		PluginId     string `json:"plugin_id"`
+		BasePluginId string `json:"base_plugin_id"`
+		Context      *int   `json:"context"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.PluginId == "" {
+		o.ServeError(http.StatusBadRequest, "plugin_id can not be empty")
+	}
+	if param.BasePluginId == "" {
+		o.ServeError(http.StatusBadRequest, "base_plugin_id can not be empty")
+	}
+	context := 3
+	if param.Context != nil {
+		if *param.Context < 0 || *param.Context > 100 {
+			o.ServeError(http.StatusBadRequest, "context must be between [0,100]")
+		}
+		context = *param.Context
+	}
+	plugin, err := models.GetPluginById(param.PluginId, true)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin", err)
+	}
+	o.CheckAppRole(plugin.AppId, models.RoleReadOnly)
+	basePlugin, err := models.GetPluginById(param.BasePluginId, true)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get base plugin", err)
+	}
+	if basePlugin.AppId != plugin.AppId {
+		o.ServeError(http.StatusBadRequest, "the base plugin does not belong to the app of plugin")
+	}
+	o.Serve(models.DiffPlugin(basePlugin, plugin, context))
+}
+
+// @router /trusted_keys/get [get]
+func (o *PluginController) GetTrustedKeys() {
+	o.Serve(models.GetPluginTrustedKeys())
+}
+
 // @router /delete [post]
 func (o *PluginController) Delete() {
 	var param map[string]string
@@ -158,6 +221,7 @@ func (o *PluginController) Delete() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "can not get the plugin", err)
 	}
+	o.CheckAppRole(plugin.AppId, models.RoleOperator)
 	var app *models.App
 	err = mongo.FindOne("app", bson.M{"selected_plugin_id": pluginId}, &app)
 	if err != nil && err != mgo.ErrNotFound {
@@ -166,11 +230,26 @@ func (o *PluginController) Delete() {
 	if app != nil {
 		o.ServeError(http.StatusBadRequest, "Unable to delete a plugin in use. Plugin is used by appid: "+app.Id)
 	}
+	rollout, err := models.GetRunningPluginRollout(plugin.AppId)
+	if err != nil && err != mgo.ErrNotFound {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin rollout", err)
+	}
+	if rollout != nil && rollout.PluginId == pluginId {
+		o.ServeError(http.StatusBadRequest, "Unable to delete a plugin in rollout, promote or roll back it first")
+	}
 	err = models.DeletePlugin(pluginId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to delete the plugin", err)
 	}
 	models.AddOperation(plugin.AppId, models.OperationTypeDeletePlugin, o.Ctx.Input.IP(),
-		"Deleted plugin: "+plugin.Id)
+		"Deleted plugin: "+plugin.Id, o.GetLoginUser().Name)
 	o.ServeWithEmptyData()
 }
+
+func (o *PluginController) checkPluginRole(pluginId string, role string) {
+	plugin, err := models.GetPluginById(pluginId, false)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin", err)
+	}
+	o.CheckAppRole(plugin.AppId, role)
+}
@@ -0,0 +1,177 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"gopkg.in/mgo.v2"
+	"math"
+	"net/http"
+	"rasp-cloud/models"
+	"strconv"
+	"strings"
+)
+
+type pluginRolloutParam struct {
+	AppId    string   `json:"app_id"`
+	PluginId string   `json:"plugin_id"`
+	Percent  int      `json:"percent"`
+	RaspIds  []string `json:"rasp_ids"`
+	Page     int      `json:"page"`
+	Perpage  int      `json:"perpage"`
+}
+
+// @router /rollout/get [post]
+func (o *PluginController) GetRollout() {
+	param := o.getRolloutParam(models.RoleReadOnly)
+	rollout, err := models.GetRunningPluginRollout(param.AppId)
+	if err == mgo.ErrNotFound {
+		o.Serve(map[string]interface{}{"rollout": nil, "stats": nil})
+		return
+	}
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin rollout", err)
+	}
+	stats, err := models.GetPluginRolloutStats(rollout)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get the stats of plugin rollout", err)
+	}
+	o.Serve(map[string]interface{}{"rollout": rollout, "stats": stats})
+}
+
+// @router /rollout/history [post]
+func (o *PluginController) GetRolloutHistory() {
+	param := o.getRolloutParam(models.RoleReadOnly)
+	if param.Page <= 0 {
+		o.ServeError(http.StatusBadRequest, "page must be greater than 0")
+	}
+	if param.Perpage <= 0 {
+		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
+	}
+	total, rollouts, err := models.GetPluginRollouts(param.AppId, param.Page, param.Perpage)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin rollouts", err)
+	}
+	o.Serve(map[string]interface{}{
+		"total":      total,
+		"total_page": math.Ceil(float64(total) / float64(param.Perpage)),
+		"page":       param.Page,
+		"perpage":    param.Perpage,
+		"data":       rollouts,
+	})
+}
+
+// @router /rollout/start [post]
+func (o *PluginController) StartRollout() {
+	param := o.getRolloutParam(models.RoleOperator)
+	if param.PluginId == "" {
+		o.ServeError(http.StatusBadRequest, "plugin_id can not be empty")
+	}
+	plugin, err := models.GetPluginById(param.PluginId, false)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin", err)
+	}
+	if plugin.AppId != param.AppId {
+		o.ServeError(http.StatusBadRequest, "the plugin does not belong to the app")
+	}
+	o.validRolloutTarget(param)
+	rollout, err := models.StartPluginRollout(param.AppId, param.PluginId, param.Percent, param.RaspIds,
+		o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to start plugin rollout", err)
+	}
+	models.AddOperation(param.AppId, models.OperationTypeStartPluginRollout, o.Ctx.Input.IP(),
+		"Started the rollout of plugin "+param.PluginId+": "+rolloutTargetDesc(param),
+		o.GetLoginUser().Name)
+	o.Serve(rollout)
+}
+
+// @router /rollout/update [post]
+func (o *PluginController) UpdateRollout() {
+	param := o.getRolloutParam(models.RoleOperator)
+	o.validRolloutTarget(param)
+	rollout, err := models.UpdatePluginRollout(param.AppId, param.Percent, param.RaspIds, o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to update plugin rollout", err)
+	}
+	models.AddOperation(param.AppId, models.OperationTypeUpdatePluginRollout, o.Ctx.Input.IP(),
+		"Updated the rollout of plugin "+rollout.PluginId+": "+rolloutTargetDesc(param), o.GetLoginUser().Name)
+	o.Serve(rollout)
+}
+
+// @router /rollout/promote [post]
+func (o *PluginController) PromoteRollout() {
+	param := o.getRolloutParam(models.RoleOperator)
+	rollout, err := models.PromotePluginRollout(param.AppId, o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to promote plugin rollout", err)
+	}
+	models.AddOperation(param.AppId, models.OperationTypePromotePluginRollout, o.Ctx.Input.IP(),
+		"Promoted the rollout of plugin "+rollout.PluginId+" to all agents", o.GetLoginUser().Name)
+	o.Serve(rollout)
+}
+
+// @router /rollout/rollback [post]
+func (o *PluginController) RollbackRollout() {
+	param := o.getRolloutParam(models.RoleOperator)
+	rollout, err := models.RollbackPluginRollout(param.AppId, o.GetLoginUser().Name)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to roll back plugin rollout", err)
+	}
+	models.AddOperation(param.AppId, models.OperationTypeRollbackPluginRollout, o.Ctx.Input.IP(),
+		"Rolled back the rollout of plugin "+rollout.PluginId, o.GetLoginUser().Name)
+	o.Serve(rollout)
+}
+
+func (o *PluginController) getRolloutParam(role string) *pluginRolloutParam {
+	var param pluginRolloutParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(param.AppId, role)
+	if _, err = models.GetAppById(param.AppId); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get app", err)
+	}
+	return &param
+}
+
+func (o *PluginController) validRolloutTarget(param *pluginRolloutParam) {
+	if param.Percent < 0 || param.Percent > 100 {
+		o.ServeError(http.StatusBadRequest, "percent must be between [0,100]")
+	}
+	if len(param.RaspIds) > 1000 {
+		o.ServeError(http.StatusBadRequest, "the count of rasp_ids can not be greater than 1000")
+	}
+	for _, raspId := range param.RaspIds {
+		if raspId == "" || len(raspId) > 256 {
+			o.ServeError(http.StatusBadRequest, "the length of rasp id must be between [1,256]")
+		}
+	}
+	if param.Percent == 0 && len(param.RaspIds) == 0 {
+		o.ServeError(http.StatusBadRequest, "either percent or rasp_ids must be set")
+	}
+}
+
+func rolloutTargetDesc(param *pluginRolloutParam) string {
+	desc := strconv.Itoa(param.Percent) + "%"
+	if len(param.RaspIds) > 0 {
+		desc += " and rasp " + strings.Join(param.RaspIds, ",")
+	}
+	return desc
+}
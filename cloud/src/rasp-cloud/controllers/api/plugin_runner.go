@@ -0,0 +1,99 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"rasp-cloud/models"
+	"rasp-cloud/tools/sandbox"
+)
+
+// @router /test [post]
+func (o *PluginController) RunTest() {
+	var param struct {
+		PluginId     string           `json:"plugin_id"`
+		BasePluginId string           `json:"base_plugin_id"`
+		StartTime    int64            `json:"start_time"`
+		EndTime      int64            `json:"end_time"`
+		AttackTypes  []string         `json:"attack_type"`
+		Size         int              `json:"size"`
+		Events       []*sandbox.Event `json:"events"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.PluginId == "" {
+		o.ServeError(http.StatusBadRequest, "plugin_id can not be empty")
+	}
+	plugin, err := models.GetPluginById(param.PluginId, true)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get plugin", err)
+	}
+	o.CheckAppRole(plugin.AppId, models.RoleReadOnly)
+	app, err := models.GetAppById(plugin.AppId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get app", err)
+	}
+	// the plugin is compared with the selected plugin by default
+	if param.BasePluginId == "" && app.SelectedPluginId != plugin.Id {
+		param.BasePluginId = app.SelectedPluginId
+	}
+	var basePlugin *models.Plugin
+	if param.BasePluginId != "" {
+		basePlugin, err = models.GetPluginById(param.BasePluginId, true)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get base plugin", err)
+		}
+		if basePlugin.AppId != plugin.AppId {
+			o.ServeError(http.StatusBadRequest, "the base plugin does not belong to the app of plugin")
+		}
+	}
+
+	events := param.Events
+	if len(events) > 0 {
+		if len(events) > 1000 {
+			o.ServeError(http.StatusBadRequest, "the count of events can not be greater than 1000")
+		}
+		for _, event := range events {
+			if event == nil || event.Hook == "" {
+				o.ServeError(http.StatusBadRequest, "the hook of event can not be empty")
+			}
+		}
+	} else {
+		if param.StartTime <= 0 {
+			o.ServeError(http.StatusBadRequest, "start_time must be greater than 0")
+		}
+		if param.EndTime <= 0 {
+			o.ServeError(http.StatusBadRequest, "end_time must be greater than 0")
+		}
+		if param.StartTime > param.EndTime {
+			o.ServeError(http.StatusBadRequest, "start_time cannot be greater than end_time")
+		}
+		if param.Size <= 0 || param.Size > 1000 {
+			o.ServeError(http.StatusBadRequest, "size must be between (0,1000]")
+		}
+		events, err = models.GetPluginTestEvents(app, param.StartTime, param.EndTime, param.AttackTypes, param.Size)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get the events from attack alarms", err)
+		}
+	}
+	report, err := models.RunPluginTest(plugin, basePlugin, events)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to run plugin test", err)
+	}
+	o.Serve(report)
+}
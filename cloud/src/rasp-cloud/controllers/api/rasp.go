@@ -46,6 +46,11 @@ func (o *RaspController) Search() {
 	if param.Perpage <= 0 {
 		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
 	}
+	if param.Data.AppId == "" {
+		o.CheckRole(models.RoleReadOnly)
+	} else {
+		o.CheckAppRole(param.Data.AppId, models.RoleReadOnly)
+	}
 	total, rasps, err := models.FindRasp(param.Data, param.Page, param.Perpage)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get rasp", err)
@@ -76,6 +81,7 @@ func (o *RaspController) Delete() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to get rasp by id", err)
 	}
+	o.CheckAppRole(rasp.AppId, models.RoleOperator)
 	if *rasp.Online {
 		o.ServeError(http.StatusBadRequest, "can not delete online rasp")
 	}
@@ -83,6 +89,7 @@ func (o *RaspController) Delete() {
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to remove rasp", err)
 	}
-	models.AddOperation(rasp.AppId, models.OperationTypeDeleteRasp, o.Ctx.Input.IP(), "Deleted RASP agent: "+rasp.Id)
+	models.AddOperation(rasp.AppId, models.OperationTypeDeleteRasp, o.Ctx.Input.IP(),
+		"Deleted RASP agent: "+rasp.Id, o.GetLoginUser().Name)
 	o.ServeWithEmptyData()
 }
@@ -0,0 +1,245 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"rasp-cloud/models"
+	"strconv"
+	"strings"
+)
+
+// @router /tags/set [post]
+func (o *RaspController) SetTags() {
+	var param struct {
+		AppId   string   `json:"app_id"`
+		RaspIds []string `json:"rasp_ids"`
+		Tags    []string `json:"tags"`
+		Mode    string   `json:"mode"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(param.AppId, models.RoleOperator)
+	if len(param.RaspIds) == 0 {
+		o.ServeError(http.StatusBadRequest, "rasp_ids can not be empty")
+	}
+	if len(param.RaspIds) > 1000 {
+		o.ServeError(http.StatusBadRequest, "the count of rasp_ids can not be greater than 1000")
+	}
+	if param.Mode == "" {
+		param.Mode = models.RaspTagsModeAdd
+	}
+	if param.Mode != models.RaspTagsModeAdd && param.Mode != models.RaspTagsModeRemove &&
+		param.Mode != models.RaspTagsModeSet {
+		o.ServeError(http.StatusBadRequest, "mode must be add, remove or set")
+	}
+	param.Tags = o.validRaspTags(param.Tags, "tags")
+	if len(param.Tags) == 0 && param.Mode != models.RaspTagsModeSet {
+		o.ServeError(http.StatusBadRequest, "tags can not be empty")
+	}
+	count, err := models.SetRaspTags(param.AppId, param.RaspIds, param.Tags, param.Mode)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to set rasp tags", err)
+	}
+	models.AddOperation(param.AppId, models.OperationTypeUpdateRaspTags, o.Ctx.Input.IP(),
+		"Updated the tags of "+strconv.Itoa(count)+" RASP agents ("+param.Mode+"): "+
+			strings.Join(param.Tags, ","), o.GetLoginUser().Name)
+	o.Serve(map[string]interface{}{"count": count})
+}
+
+// @router /group/get [post]
+func (o *RaspController) GetGroups() {
+	var param struct {
+		AppId string `json:"app_id"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(param.AppId, models.RoleReadOnly)
+	groups, err := models.GetRaspGroupsByApp(param.AppId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get rasp groups", err)
+	}
+	o.Serve(groups)
+}
+
+// @router /group [post]
+func (o *RaspController) AddGroup() {
+	group := o.getGroupParam()
+	if group.AppId == "" {
+		o.ServeError(http.StatusBadRequest, "app_id can not be empty")
+	}
+	o.CheckAppRole(group.AppId, models.RoleOperator)
+	if _, err := models.GetAppById(group.AppId); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get app", err)
+	}
+	o.validRaspGroup(group)
+	group, err := models.AddRaspGroup(group)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to add rasp group", err)
+	}
+	models.AddOperation(group.AppId, models.OperationTypeAddRaspGroup, o.Ctx.Input.IP(),
+		"Added RASP group "+group.Name+": "+group.Id, o.GetLoginUser().Name)
+	o.Serve(group)
+}
+
+// @router /group/update [post]
+func (o *RaspController) UpdateGroup() {
+	group := o.getGroupParam()
+	if group.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	oldGroup, err := models.GetRaspGroupById(group.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get rasp group", err)
+	}
+	o.CheckAppRole(oldGroup.AppId, models.RoleOperator)
+	group.AppId = oldGroup.AppId
+	o.validRaspGroup(group)
+	group, err = models.UpdateRaspGroup(group)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to update rasp group", err)
+	}
+	models.AddOperation(group.AppId, models.OperationTypeUpdateRaspGroup, o.Ctx.Input.IP(),
+		"Updated RASP group "+group.Name+": "+group.Id, o.GetLoginUser().Name)
+	o.Serve(group)
+}
+
+// @router /group/delete [post]
+func (o *RaspController) DeleteGroup() {
+	var param struct {
+		Id string `json:"id"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	group, err := models.GetRaspGroupById(param.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get rasp group", err)
+	}
+	o.CheckAppRole(group.AppId, models.RoleOperator)
+	if _, err = models.RemoveRaspGroupById(param.Id); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove rasp group", err)
+	}
+	models.AddOperation(group.AppId, models.OperationTypeDeleteRaspGroup, o.Ctx.Input.IP(),
+		"Deleted RASP group "+group.Name+": "+group.Id, o.GetLoginUser().Name)
+	o.ServeWithEmptyData()
+}
+
+// @router /group/config [post]
+func (o *RaspController) GetEffectiveConfig() {
+	var param struct {
+		RaspId string `json:"rasp_id"`
+	}
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.RaspId == "" {
+		o.ServeError(http.StatusBadRequest, "rasp_id can not be empty")
+	}
+	rasp, err := models.GetRaspById(param.RaspId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get rasp by id", err)
+	}
+	o.CheckAppRole(rasp.AppId, models.RoleReadOnly)
+	app, err := models.GetAppById(rasp.AppId)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get app", err)
+	}
+	generalConfig, whitelistConfig, groups, err := models.GetRaspEffectiveConfig(app, rasp)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get the config of rasp groups", err)
+	}
+	o.Serve(map[string]interface{}{
+		"general_config":   generalConfig,
+		"whitelist_config": whitelistConfig,
+		"groups":           groups,
+	})
+}
+
+func (o *RaspController) getGroupParam() *models.RaspGroup {
+	var group models.RaspGroup
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &group)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	return &group
+}
+
+func (o *RaspController) validRaspGroup(group *models.RaspGroup) {
+	if group.Name == "" {
+		o.ServeError(http.StatusBadRequest, "name can not be empty")
+	}
+	if len(group.Name) > 64 {
+		o.ServeError(http.StatusBadRequest, "the length of name can not be greater than 64")
+	}
+	group.Selector = o.validRaspTags(group.Selector, "selector")
+	if len(group.Selector) == 0 {
+		o.ServeError(http.StatusBadRequest, "selector can not be empty")
+	}
+	if group.GeneralConfig == nil {
+		group.GeneralConfig = make(map[string]interface{})
+	}
+	// the whitelist of the app can not be overridden by the group
+	if _, ok := group.GeneralConfig["hook.white"]; ok {
+		o.ServeError(http.StatusBadRequest, "hook.white can not be overridden, use whitelist_config instead")
+	}
+	if err := checkGeneralConfig(group.GeneralConfig, false); err != nil {
+		o.ServeError(http.StatusBadRequest, err.Error())
+	}
+	if group.WhitelistConfig == nil {
+		group.WhitelistConfig = make([]models.WhitelistConfigItem, 0)
+	}
+	if err := checkWhitelistConfig(group.WhitelistConfig); err != nil {
+		o.ServeError(http.StatusBadRequest, err.Error())
+	}
+}
+
+func (o *RaspController) validRaspTags(tags []string, paramName string) []string {
+	if len(tags) > models.MaxRaspTagCount {
+		o.ServeError(http.StatusBadRequest,
+			"the count of "+paramName+" can not be greater than "+strconv.Itoa(models.MaxRaspTagCount))
+	}
+	result := make([]string, 0, len(tags))
+	exists := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > models.MaxRaspTagLength {
+			o.ServeError(http.StatusBadRequest,
+				"the length of the element of "+paramName+" must be between [1,"+
+					strconv.Itoa(models.MaxRaspTagLength)+"]")
+		}
+		if !exists[tag] {
+			exists[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
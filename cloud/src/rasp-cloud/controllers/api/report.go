@@ -72,9 +72,14 @@ func (o *ReportController) Search() {
 	if !ok {
 		o.ServeError(http.StatusBadRequest, "app_id must be string")
 	}
-	_, err = models.GetAppById(appId)
-	if err != nil {
-		o.ServeError(http.StatusBadRequest, "failed to get app", err)
+	if appId == "*" {
+		o.CheckRole(models.RoleReadOnly)
+	} else {
+		o.CheckAppRole(appId, models.RoleReadOnly)
+		_, err = models.GetAppById(appId)
+		if err != nil {
+			o.ServeError(http.StatusBadRequest, "failed to get app", err)
+		}
 	}
 	err, result := models.GetHistoryRequestSum(int64(startTime), int64(endTime), interval, timeZone, appId)
 	if err != nil {
@@ -28,6 +28,7 @@ type TokenController struct {
 
 // @router /get [post]
 func (o *TokenController) Get() {
+	o.CheckRole(models.RoleAdmin)
 	var param map[string]int
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
 	if err != nil {
@@ -59,6 +60,7 @@ func (o *TokenController) Get() {
 
 // @router / [post]
 func (o *TokenController) Post() {
+	o.CheckRole(models.RoleAdmin)
 	var token *models.Token
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, &token)
 	if err != nil {
@@ -67,6 +69,16 @@ func (o *TokenController) Post() {
 	if len(token.Description) > 1024 {
 		o.ServeError(http.StatusBadRequest, "the length of the token description must be less than 1024")
 	}
+	// the token without scopes is the administrator token of the old version
+	if len(token.Scopes) == 0 {
+		token.Scopes = []string{models.TokenScopeAdmin}
+	}
+	for _, appId := range token.AppIds {
+		if app, err := models.GetAppById(appId); err != nil || app == nil {
+			o.ServeError(http.StatusBadRequest, "failed to get the app: "+appId, err)
+		}
+	}
+	token.CreateUser = o.GetLoginUser().Name
 	token, err = models.AddToken(token)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to create new token", err)
@@ -76,19 +88,24 @@ func (o *TokenController) Post() {
 
 // @router /delete [post]
 func (o *TokenController) Delete() {
+	o.CheckRole(models.RoleAdmin)
 	var token *models.Token
 	err := json.Unmarshal(o.Ctx.Input.RequestBody, &token)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
 	}
-	if len(token.Token) == 0 {
-		o.ServeError(http.StatusBadRequest, "the token param cannot be empty")
+	tokenId := token.Id
+	if tokenId == "" {
+		tokenId = token.Token
+	}
+	if len(tokenId) == 0 {
+		o.ServeError(http.StatusBadRequest, "the id param cannot be empty")
 	}
 	currentToken := o.Ctx.Input.Header(models.AuthTokenName)
-	if currentToken == token.Token {
+	if currentToken != "" && (currentToken == tokenId || models.GetTokenId(currentToken) == tokenId) {
 		o.ServeError(http.StatusBadRequest, "can not delete the token currently in use")
 	}
-	token, err = models.RemoveToken(token.Token)
+	token, err = models.RemoveToken(tokenId)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, "failed to remove token", err)
 	}
@@ -18,6 +18,8 @@ import (
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"github.com/astaxie/beego"
+	"math"
 	"math/rand"
 	"net/http"
 	"rasp-cloud/controllers"
@@ -30,6 +32,14 @@ type UserController struct {
 	controllers.BaseController
 }
 
+type userParam struct {
+	Id       string            `json:"id"`
+	Name     string            `json:"name"`
+	Password string            `json:"password"`
+	Role     string            `json:"role"`
+	AppRoles map[string]string `json:"app_roles"`
+}
+
 // @router /login [post]
 func (o *UserController) Login() {
 	var loginData map[string]string
@@ -45,23 +55,109 @@ func (o *UserController) Login() {
 	if len(logUser) > 512 || len(logPasswd) > 512 {
 		o.ServeError(http.StatusBadRequest, "the length of username or password cannot be greater than 512")
 	}
-	err = models.VerifyUser(logUser, logPasswd)
+	if !models.IsPasswordLoginEnable() {
+		o.ServeError(http.StatusForbidden, "the password login is disabled, please log in with single sign-on")
+	}
+	ip := models.GetClientIp(o.Ctx.Request)
+	wait, err := models.GetLoginWaitTime(ip, logUser)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get the login attempts", err)
+	}
+	if wait > 0 {
+		seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		o.Ctx.Output.Header("Retry-After", seconds)
+		o.ServeError(http.StatusTooManyRequests,
+			"too many failed login attempts, please try again after "+seconds+" seconds")
+	}
+	user, err := models.VerifyUser(logUser, logPasswd)
 	if err != nil {
+		o.loginFailed(ip, logUser, "incorrect username or password")
 		o.ServeError(http.StatusBadRequest, "username or password is incorrect")
 	}
-	cookie := fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(rand.Intn(10000))+logUser+"openrasp"+
+	// the code is checked after the password so that it does not tell whether the user has enabled it
+	err = models.VerifyTotp(user, loginData["totp_code"])
+	if err == models.ErrTotpRequired {
+		o.ServeError(http.StatusUnauthorized, err.Error())
+	}
+	if err != nil {
+		o.loginFailed(ip, logUser, "incorrect totp code")
+		o.ServeError(http.StatusBadRequest, "failed to verify the totp code", err)
+	}
+	if err = models.ClearLoginFailure(logUser); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to clear the login attempts", err)
+	}
+	o.setLoginCookie(user)
+	models.AddOperation("", models.OperationTypeLogin, ip, "User "+user.Name+" logged in with password", user.Name)
+	o.ServeWithEmptyData()
+}
+
+// loginFailed records the failure in the operation log and delays the next login of the ip and the user name
+func (o *UserController) loginFailed(ip string, userName string, reason string) {
+	models.AddOperation("", models.OperationTypeLoginFailed, ip,
+		"Failed to log in as user "+userName+": "+reason, userName)
+	locked, err := models.AddLoginFailure(ip, userName)
+	if err != nil {
+		beego.Error("failed to add the login failure of " + userName + ": " + err.Error())
+	}
+	for _, item := range locked {
+		models.AddOperation("", models.OperationTypeLoginFailed, ip, "Login of "+item+" is locked for "+
+			models.GetLoginLockoutTime().String()+" after too many failures", userName)
+	}
+}
+
+func (o *UserController) setLoginCookie(user *models.User) {
+	cookie := fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(rand.Intn(10000))+user.Name+"openrasp"+
 		strconv.FormatInt(time.Now().UnixNano(), 10))))
-	err = models.NewCookie(cookie)
+	err := models.NewCookie(cookie, user.Id)
 	if err != nil {
 		o.ServeError(http.StatusUnauthorized, "failed to create cookie", err)
 	}
 	o.Ctx.SetCookie(models.AuthCookieName, cookie)
-	o.ServeWithEmptyData()
+}
+
+// @router /oidc/config [get]
+func (o *UserController) GetOidcConfig() {
+	o.Serve(models.GetOidcConfig())
+}
+
+// @router /oidc/login [get]
+func (o *UserController) OidcLogin() {
+	state, authUrl, err := models.NewOidcLogin()
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to start single sign-on", err)
+	}
+	// the state is bound to the browser so that the callback can not be replayed in another one
+	o.Ctx.SetCookie(models.OidcStateCookieName, state, int(models.OidcStateLifeTime.Seconds()), "/", "", false, true)
+	o.Redirect(authUrl, http.StatusFound)
+}
+
+// @router /oidc/callback [get]
+func (o *UserController) OidcCallback() {
+	if errCode := o.GetString("error"); errCode != "" {
+		o.ServeError(http.StatusUnauthorized, "single sign-on failed: "+errCode+" "+o.GetString("error_description"))
+	}
+	state := o.GetString("state")
+	code := o.GetString("code")
+	if state == "" || code == "" {
+		o.ServeError(http.StatusBadRequest, "state or code cannot be empty")
+	}
+	if state != o.Ctx.GetCookie(models.OidcStateCookieName) {
+		o.ServeError(http.StatusBadRequest, "the state does not match the browser")
+	}
+	o.Ctx.SetCookie(models.OidcStateCookieName, "", -1, "/")
+	user, err := models.FinishOidcLogin(state, code)
+	if err != nil {
+		o.ServeError(http.StatusUnauthorized, "single sign-on failed", err)
+	}
+	o.setLoginCookie(user)
+	models.AddOperation("", models.OperationTypeLogin, models.GetClientIp(o.Ctx.Request),
+		"User "+user.Name+" logged in with single sign-on", user.Name)
+	o.Redirect("/", http.StatusFound)
 }
 
 // @router /islogin [get,post]
 func (o *UserController) IsLogin() {
-	o.ServeWithEmptyData()
+	o.Serve(o.GetLoginUser())
 }
 
 // @router /update [post]
@@ -80,7 +176,11 @@ func (o *UserController) Update() {
 	if param.NewPwd == "" {
 		o.ServeError(http.StatusBadRequest, "new_password can not be empty")
 	}
-	err = models.UpdatePassword(param.OldPwd, param.NewPwd)
+	user := o.GetLoginUser()
+	if user.Id == "" {
+		o.ServeError(http.StatusBadRequest, "the password of api token user can not be updated")
+	}
+	err = models.UpdatePassword(user.Id, param.OldPwd, param.NewPwd)
 	if err != nil {
 		o.ServeError(http.StatusBadRequest, err.Error())
 	}
@@ -94,3 +194,133 @@ func (o *UserController) Logout() {
 	models.RemoveCookie(cookie)
 	o.ServeWithEmptyData()
 }
+
+// @router /get [post]
+func (o *UserController) Get() {
+	o.CheckRole(models.RoleAdmin)
+	var param map[string]int
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	page := param["page"]
+	if page <= 0 {
+		o.ServeError(http.StatusBadRequest, "page must be greater than 0")
+	}
+	perpage := param["perpage"]
+	if perpage <= 0 {
+		o.ServeError(http.StatusBadRequest, "perpage must be greater than 0")
+	}
+	total, users, err := models.GetAllUser(page, perpage)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get users", err)
+	}
+	var result = make(map[string]interface{})
+	result["total"] = total
+	result["total_page"] = math.Ceil(float64(total) / float64(perpage))
+	result["page"] = page
+	result["perpage"] = perpage
+	result["data"] = users
+	o.Serve(result)
+}
+
+// @router / [post]
+func (o *UserController) Post() {
+	o.CheckRole(models.RoleAdmin)
+	var param userParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Name == "" {
+		o.ServeError(http.StatusBadRequest, "name can not be empty")
+	}
+	if param.Password == "" {
+		o.ServeError(http.StatusBadRequest, "password can not be empty")
+	}
+	user, err := models.AddUser(param.Name, param.Password, param.Role, param.AppRoles)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to create user", err)
+	}
+	models.AddOperation("", models.OperationTypeAddUser, o.Ctx.Input.IP(),
+		"New user created with name "+user.Name+", role: "+user.Role, o.GetLoginUser().Name)
+	o.Serve(user)
+}
+
+// @router /config [post]
+func (o *UserController) Config() {
+	o.CheckRole(models.RoleAdmin)
+	var param userParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	user, err := models.UpdateUserRole(param.Id, param.Role, param.AppRoles)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to update the role of user", err)
+	}
+	appRoles, err := json.Marshal(user.AppRoles)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to encode app roles", err)
+	}
+	models.AddOperation("", models.OperationTypeUpdateUserRole, o.Ctx.Input.IP(),
+		"Updated the role of user "+user.Name+", role: "+user.Role+", app roles: "+string(appRoles),
+		o.GetLoginUser().Name)
+	o.Serve(user)
+}
+
+// @router /password/reset [post]
+func (o *UserController) ResetPassword() {
+	o.CheckRole(models.RoleAdmin)
+	var param userParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	if param.Password == "" {
+		o.ServeError(http.StatusBadRequest, "password can not be empty")
+	}
+	user, err := models.GetUserById(param.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get user", err)
+	}
+	if user.Source != "" {
+		o.ServeError(http.StatusBadRequest, "the password of "+user.Source+" user can not be reset")
+	}
+	err = models.ResetUserPassword(user.Id, param.Password)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to reset password", err)
+	}
+	models.AddOperation("", models.OperationTypeResetUserPassword, o.Ctx.Input.IP(),
+		"Reset the password of user "+user.Name, o.GetLoginUser().Name)
+	o.ServeWithEmptyData()
+}
+
+// @router /delete [post]
+func (o *UserController) Delete() {
+	o.CheckRole(models.RoleAdmin)
+	var param userParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	if param.Id == o.GetLoginUser().Id {
+		o.ServeError(http.StatusBadRequest, "can not delete the user currently in use")
+	}
+	user, err := models.RemoveUserById(param.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to remove user", err)
+	}
+	models.AddOperation("", models.OperationTypeDeleteUser, o.Ctx.Input.IP(),
+		"Deleted user with name "+user.Name, o.GetLoginUser().Name)
+	o.ServeWithEmptyData()
+}
@@ -0,0 +1,124 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"rasp-cloud/models"
+)
+
+type totpParam struct {
+	Code string `json:"code"`
+}
+
+// @router /totp/enroll [post]
+func (o *UserController) EnrollTotp() {
+	user := o.getTotpUser()
+	enrollment, err := models.EnrollTotp(user.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to enroll two-factor authentication", err)
+	}
+	o.Serve(enrollment)
+}
+
+// @router /totp/enable [post]
+func (o *UserController) EnableTotp() {
+	user := o.getTotpUser()
+	param := o.getTotpParam()
+	codes, err := models.EnableTotp(user.Id, param.Code)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to enable two-factor authentication", err)
+	}
+	o.Serve(map[string]interface{}{"recovery_codes": codes})
+}
+
+// @router /totp/disable [post]
+func (o *UserController) DisableTotp() {
+	user := o.getTotpUser()
+	param := o.getTotpParam()
+	if err := models.VerifyTotp(user, param.Code); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to verify the totp code", err)
+	}
+	if err := models.DisableTotp(user.Id); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to disable two-factor authentication", err)
+	}
+	o.ServeWithEmptyData()
+}
+
+// @router /totp/recovery/regenerate [post]
+func (o *UserController) RegenerateTotpRecoveryCodes() {
+	user := o.getTotpUser()
+	if !user.TotpEnable {
+		o.ServeError(http.StatusBadRequest, "the two-factor authentication is not enabled")
+	}
+	param := o.getTotpParam()
+	if err := models.VerifyTotp(user, param.Code); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to verify the totp code", err)
+	}
+	codes, err := models.RegenerateTotpRecoveryCodes(user.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to regenerate recovery codes", err)
+	}
+	o.Serve(map[string]interface{}{"recovery_codes": codes})
+}
+
+// @router /totp/reset [post]
+func (o *UserController) ResetTotp() {
+	o.CheckRole(models.RoleAdmin)
+	var param userParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Id == "" {
+		o.ServeError(http.StatusBadRequest, "id can not be empty")
+	}
+	user, err := models.GetUserById(param.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get user", err)
+	}
+	if err = models.DisableTotp(user.Id); err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to reset two-factor authentication", err)
+	}
+	models.AddOperation("", models.OperationTypeResetUserTotp, o.Ctx.Input.IP(),
+		"Reset the two-factor authentication of user "+user.Name, o.GetLoginUser().Name)
+	o.ServeWithEmptyData()
+}
+
+// getTotpUser returns the latest document of the login user, the api token user has no two-factor authentication
+func (o *UserController) getTotpUser() *models.User {
+	loginUser := o.GetLoginUser()
+	if loginUser.Id == "" {
+		o.ServeError(http.StatusBadRequest, "the api token user has no two-factor authentication")
+	}
+	user, err := models.GetUserById(loginUser.Id)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "failed to get user", err)
+	}
+	return user
+}
+
+func (o *UserController) getTotpParam() *totpParam {
+	var param totpParam
+	err := json.Unmarshal(o.Ctx.Input.RequestBody, &param)
+	if err != nil {
+		o.ServeError(http.StatusBadRequest, "Invalid JSON request", err)
+	}
+	if param.Code == "" {
+		o.ServeError(http.StatusBadRequest, "code can not be empty")
+	}
+	return &param
+}
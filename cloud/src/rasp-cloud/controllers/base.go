@@ -17,6 +17,7 @@ package controllers
 import (
 	"github.com/astaxie/beego"
 	"net/http"
+	"rasp-cloud/models"
 )
 
 // base controller
@@ -52,3 +53,26 @@ func (o *BaseController) ServeStatusCode(code int, description ...string) {
 	o.Data["json"] = map[string]interface{}{"status": code, "description": des}
 	o.ServeJSON()
 }
+
+// GetLoginUser returns the user who sends the request, it is set by the auth filter
+func (o *BaseController) GetLoginUser() *models.User {
+	user, ok := o.Ctx.Input.GetData(models.LoginUserKey).(*models.User)
+	if !ok || user == nil {
+		o.ServeError(http.StatusUnauthorized, "failed to get the login user")
+	}
+	return user
+}
+
+// CheckRole requires the login user to have the role for all apps
+func (o *BaseController) CheckRole(role string) {
+	if !o.GetLoginUser().HasRole(role) {
+		o.ServeError(http.StatusForbidden, "permission denied: the "+role+" role is required")
+	}
+}
+
+// CheckAppRole requires the login user to have the role for the app
+func (o *BaseController) CheckAppRole(appId string, role string) {
+	if !o.GetLoginUser().HasAppRole(appId, role) {
+		o.ServeError(http.StatusForbidden, "permission denied: the "+role+" role of app "+appId+" is required")
+	}
+}
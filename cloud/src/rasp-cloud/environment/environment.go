@@ -39,6 +39,7 @@ const (
 type Flag struct {
 	StartType *string
 	Password  *string
+	User      *string
 	Daemon    *bool
 	Version   *bool
 }
@@ -51,13 +52,15 @@ func init() {
 	StartFlag.StartType = flag.String("type", "", "use to provide different routers")
 	StartFlag.Daemon = flag.Bool("d", false, "use to run as daemon process")
 	StartFlag.Version = flag.Bool("version", false, "use to get version")
+	StartFlag.User = flag.String("user", "",
+		"use with '-type reset' to reset the two-factor authentication of the user instead of the admin password")
 	flag.Parse()
 
 	if *StartFlag.Version {
 		fmt.Println(Version)
 		os.Exit(0)
 	}
-	if *StartFlag.StartType == StartTypeReset {
+	if *StartFlag.StartType == StartTypeReset && *StartFlag.User == "" {
 		fmt.Print("Enter new admin password: ")
 		pwd1, err := terminal.ReadPassword(int(syscall.Stdin))
 		fmt.Println()
@@ -26,12 +26,16 @@ import (
 	"fmt"
 	"rasp-cloud/environment"
 	"strings"
+	"errors"
+	"net/http"
 )
 
 var (
 	ElasticClient *elastic.Client
 	ttlIndexes    = make(chan map[string]time.Duration, 1)
 	minEsVersion  = "5.6.0"
+	// none of the docs has a valid app_id
+	ErrNoBulkActions = errors.New("no valid doc to insert")
 )
 
 func init() {
@@ -154,8 +158,25 @@ func Insert(index string, docType string, doc interface{}) (err error) {
 	return
 }
 
+// BulkError is returned by BulkInsert when some docs are rejected while the bulk request succeeds,
+// the retryable docs can be inserted again later, and the others will always be rejected
+type BulkError struct {
+	Retryable []map[string]interface{}
+	Permanent []map[string]interface{}
+	// the reason of the first failed doc
+	Reason string
+}
+
+func (e *BulkError) Error() string {
+	return strconv.Itoa(len(e.Retryable)+len(e.Permanent)) + " docs failed in the bulk insert, " +
+		strconv.Itoa(len(e.Retryable)) + " of them are retryable: " + e.Reason
+}
+
+// BulkInsert inserts the docs, the docs without app_id are skipped, and the docs rejected by es
+// are returned by BulkError
 func BulkInsert(docType string, docs []map[string]interface{}) (err error) {
 	bulkService := ElasticClient.Bulk()
+	added := make([]map[string]interface{}, 0, len(docs))
 	for _, doc := range docs {
 		if doc["app_id"] == nil {
 			beego.Error("failed to get app_id param from alarm: " + fmt.Sprintf("%+v", doc))
@@ -170,20 +191,67 @@ func BulkInsert(docType string, docs []map[string]interface{}) (err error) {
 					DocAsUpsert(true).
 					Doc(doc))
 			} else {
-				if appId, ok := doc["app_id"].(string); ok {
-					bulkService.Add(elastic.NewBulkIndexRequest().
-						Index("real-openrasp-" + docType + "-" + appId).
-						Type(docType).
-						OpType("index").
-						Doc(doc))
-				}
+				bulkService.Add(elastic.NewBulkIndexRequest().
+					Index("real-openrasp-" + docType + "-" + appId).
+					Type(docType).
+					OpType("index").
+					Doc(doc))
 			}
+			added = append(added, doc)
 		} else {
 			beego.Error("the type of alarm's app_id param is not string: " + fmt.Sprintf("%+v", doc))
 		}
 	}
+	if bulkService.NumberOfActions() == 0 {
+		return ErrNoBulkActions
+	}
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(15*time.Second))
 	defer cancel()
-	_, err = bulkService.Do(ctx)
-	return err
+	response, err := bulkService.Do(ctx)
+	if err != nil || response == nil || !response.Errors {
+		return err
+	}
+	// the items of the response are in the order of the requests
+	bulkErr := &BulkError{}
+	for i, item := range response.Items {
+		if i >= len(added) {
+			break
+		}
+		for _, result := range item {
+			if result == nil || (result.Error == nil && result.Status < http.StatusMultipleChoices) {
+				continue
+			}
+			if bulkErr.Reason == "" && result.Error != nil {
+				bulkErr.Reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			if isRetryableStatus(result.Status) {
+				bulkErr.Retryable = append(bulkErr.Retryable, added[i])
+			} else {
+				bulkErr.Permanent = append(bulkErr.Permanent, added[i])
+			}
+		}
+	}
+	if len(bulkErr.Retryable) == 0 && len(bulkErr.Permanent) == 0 {
+		return nil
+	}
+	return bulkErr
+}
+
+// IsPermanentError checks whether the error will happen again on retry, such as the invalid docs
+// and the 4xx responses except timeout and throttling
+func IsPermanentError(err error) bool {
+	if err == ErrNoBulkActions {
+		return true
+	}
+	if e, ok := err.(*elastic.Error); ok {
+		return e.Status >= http.StatusBadRequest && !isRetryableStatus(e.Status)
+	}
+	return false
+}
+
+// the auth and missing index errors are retried as well, they are fixed by the es config rather than the alarm
+func isRetryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusRequestTimeout ||
+		status == http.StatusConflict || status == http.StatusTooManyRequests ||
+		status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusNotFound
 }
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"github.com/astaxie/beego/context"
 	"github.com/astaxie/beego/plugins/cors"
+	"strings"
 )
 
 func init() {
@@ -32,29 +33,54 @@ func init() {
 	}))
 	beego.InsertFilter("/v1/agent/*", beego.BeforeRouter, authAgent)
 	beego.InsertFilter("/v1/api/*", beego.BeforeRouter, authApi)
-	beego.InsertFilter("/v1/user/islogin", beego.BeforeRouter, authApi)
+	beego.InsertFilter("/v1/user/*", beego.BeforeRouter, authUser)
 }
 
+// the agent apis are authenticated by the app secret, and the alarm apis accept the alarm_ingest api token as well
 func authAgent(ctx *context.Context) {
 	appId := ctx.Input.Header("X-OpenRASP-AppID")
+	if token := ctx.Input.Header(models.AuthTokenName); token != "" {
+		app, err := models.GetAppById(appId)
+		if appId == "" || err != nil || app == nil ||
+			models.VerifyIngestToken(token, appId, ctx.Input.URL(), models.GetClientIp(ctx.Request)) != nil {
+			unauthorized(ctx)
+			return
+		}
+		ctx.Input.SetData(models.IngestAppIdKey, appId)
+		return
+	}
 	appSecret := ctx.Input.Header("X-OpenRASP-AppSecret")
 	app, err := models.GetAppById(appId)
 	if appId == "" || err != nil || app == nil || appSecret != app.Secret {
-		ctx.Output.JSON(map[string]interface{}{
-			"status": http.StatusUnauthorized, "description": http.StatusText(http.StatusUnauthorized)},
-			false, false)
+		unauthorized(ctx)
 	}
 }
 
 func authApi(ctx *context.Context) {
 	cookie := ctx.GetCookie(models.AuthCookieName)
-	if has, err := models.HasCookie(cookie); !has || err != nil {
+	user, err := models.GetUserByCookie(cookie)
+	if err != nil || user == nil {
 		token := ctx.Input.Header(models.AuthTokenName)
-		if has, err = models.HasToken(token); !has || err != nil {
-			ctx.Output.JSON(map[string]interface{}{
-				"status": http.StatusUnauthorized, "description": http.StatusText(http.StatusUnauthorized)},
-				false, false)
+		user, err = models.GetUserByToken(token, ctx.Input.URL(), models.GetClientIp(ctx.Request))
+		if err != nil || user == nil {
+			unauthorized(ctx)
 			panic("")
 		}
 	}
+	ctx.Input.SetData(models.LoginUserKey, user)
+}
+
+func unauthorized(ctx *context.Context) {
+	ctx.Output.JSON(map[string]interface{}{
+		"status": http.StatusUnauthorized, "description": http.StatusText(http.StatusUnauthorized)},
+		false, false)
+}
+
+// the user apis except login and logout require authentication
+func authUser(ctx *context.Context) {
+	path := strings.TrimSuffix(ctx.Input.URL(), "/")
+	if path == "/v1/user/login" || path == "/v1/user/logout" || strings.HasPrefix(path, "/v1/user/oidc/") {
+		return
+	}
+	authApi(ctx)
 }
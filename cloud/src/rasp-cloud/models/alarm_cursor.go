@@ -0,0 +1,55 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/mongo"
+	"time"
+)
+
+// AlarmCursor is the notification watermark of the app,
+// the attack alarms before LastAlarmTime have been notified
+type AlarmCursor struct {
+	AppId         string `json:"app_id" bson:"_id"`
+	LastAlarmTime int64  `json:"last_alarm_time" bson:"last_alarm_time"`
+}
+
+const (
+	alarmCursorCollectionName = "alarm_cursor"
+)
+
+// getAlarmCursor returns the watermark of the app, the app without a cursor starts from now
+func getAlarmCursor(appId string) (int64, error) {
+	var cursor *AlarmCursor
+	err := mongo.FindId(alarmCursorCollectionName, appId, &cursor)
+	if err == mgo.ErrNotFound {
+		now := time.Now().UnixNano() / 1000000
+		return now, setAlarmCursor(appId, now)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return cursor.LastAlarmTime, nil
+}
+
+func setAlarmCursor(appId string, lastAlarmTime int64) error {
+	return mongo.UpsertId(alarmCursorCollectionName, appId, bson.M{"last_alarm_time": lastAlarmTime})
+}
+
+func RemoveAlarmCursor(appId string) error {
+	return mongo.RemoveAll(alarmCursorCollectionName, bson.M{"_id": appId})
+}
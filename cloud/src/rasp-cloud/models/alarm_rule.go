@@ -0,0 +1,235 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/models/logs"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlarmRule decides which attack alarms are pushed and to which channels,
+// the app without any enabled rule pushes every new alarm to all enabled channels
+type AlarmRule struct {
+	Id              string   `json:"id" bson:"_id"`
+	AppId           string   `json:"app_id" bson:"app_id"`
+	Name            string   `json:"name" bson:"name"`
+	Enable          bool     `json:"enable" bson:"enable"`
+	AttackTypes     []string `json:"attack_type" bson:"attack_type"`
+	InterceptStates []string `json:"intercept_state" bson:"intercept_state"`
+	MinConfidence   int      `json:"min_plugin_confidence" bson:"min_plugin_confidence"`
+	ServerHostname  string   `json:"server_hostname" bson:"server_hostname"`
+	Url             string   `json:"url" bson:"url"`
+	// the rule is triggered when one attack_source has at least Threshold matching alarms in Period minutes,
+	// it is triggered by every new matching alarm if Threshold is not greater than 1
+	Threshold int64 `json:"threshold" bson:"threshold"`
+	Period    int   `json:"period" bson:"period"`
+	// the names of notifiers, all enabled notifiers are used if it is empty
+	Channels        []string `json:"channels" bson:"channels"`
+	LastTriggerTime int64    `json:"last_trigger_time" bson:"last_trigger_time"`
+	CreateTime      int64    `json:"create_time" bson:"create_time"`
+	// the start time of the next search of the rule without threshold, it falls behind the alarm cursor
+	// of the app only when the search of the rule fails, so that the other rules are not pushed again
+	LastAlarmTime int64 `json:"-" bson:"last_alarm_time"`
+}
+
+const (
+	alarmRuleCollectionName = "alarm_rule"
+	alarmRuleSourceSize     = 10
+)
+
+func init() {
+	index := &mgo.Index{
+		Key:        []string{"app_id"},
+		Unique:     false,
+		Background: true,
+		Name:       "app_id",
+	}
+	err := mongo.CreateIndex(alarmRuleCollectionName, index)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create app_id index for alarm_rule collection", err)
+	}
+}
+
+func handleAlarmRule(rule *AlarmRule) {
+	if rule.AttackTypes == nil {
+		rule.AttackTypes = make([]string, 0)
+	}
+	if rule.InterceptStates == nil {
+		rule.InterceptStates = make([]string, 0)
+	}
+	if rule.Channels == nil {
+		rule.Channels = make([]string, 0)
+	}
+}
+
+func AddAlarmRule(rule *AlarmRule) (*AlarmRule, error) {
+	rule.Id = mongo.GenerateObjectId()
+	rule.CreateTime = time.Now().UnixNano() / 1000000
+	rule.LastTriggerTime = 0
+	rule.LastAlarmTime = 0
+	handleAlarmRule(rule)
+	return rule, mongo.Insert(alarmRuleCollectionName, rule)
+}
+
+func UpdateAlarmRule(rule *AlarmRule) (*AlarmRule, error) {
+	handleAlarmRule(rule)
+	err := mongo.UpdateId(alarmRuleCollectionName, rule.Id, bson.M{
+		"name":                  rule.Name,
+		"enable":                rule.Enable,
+		"attack_type":           rule.AttackTypes,
+		"intercept_state":       rule.InterceptStates,
+		"min_plugin_confidence": rule.MinConfidence,
+		"server_hostname":       rule.ServerHostname,
+		"url":                   rule.Url,
+		"threshold":             rule.Threshold,
+		"period":                rule.Period,
+		"channels":              rule.Channels,
+		// the rule starts from the alarm cursor of the app again, the alarms before the update are not pushed
+		"last_alarm_time": 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetAlarmRuleById(rule.Id)
+}
+
+func GetAlarmRuleById(id string) (rule *AlarmRule, err error) {
+	err = mongo.FindId(alarmRuleCollectionName, id, &rule)
+	if err == nil && rule != nil {
+		handleAlarmRule(rule)
+	}
+	return
+}
+
+func GetAlarmRulesByApp(appId string, page int, perpage int) (count int, result []*AlarmRule, err error) {
+	count, err = mongo.FindAll(alarmRuleCollectionName, bson.M{"app_id": appId}, &result,
+		perpage*(page-1), perpage, "create_time")
+	if err == nil {
+		for _, rule := range result {
+			handleAlarmRule(rule)
+		}
+	}
+	if result == nil {
+		result = make([]*AlarmRule, 0)
+	}
+	return
+}
+
+func getEnabledAlarmRules(appId string) (result []*AlarmRule, err error) {
+	_, err = mongo.FindAll(alarmRuleCollectionName, bson.M{"app_id": appId, "enable": true}, &result, 0, 0)
+	return
+}
+
+func RemoveAlarmRuleById(id string) (rule *AlarmRule, err error) {
+	rule, err = GetAlarmRuleById(id)
+	if err != nil {
+		return
+	}
+	return rule, mongo.RemoveId(alarmRuleCollectionName, id)
+}
+
+func RemoveAlarmRuleByAppId(appId string) error {
+	return mongo.RemoveAll(alarmRuleCollectionName, bson.M{"app_id": appId})
+}
+
+func (rule *AlarmRule) filter() *logs.AttackFilter {
+	return &logs.AttackFilter{
+		AttackTypes:     rule.AttackTypes,
+		InterceptStates: rule.InterceptStates,
+		MinConfidence:   rule.MinConfidence,
+		ServerHostname:  rule.ServerHostname,
+		Url:             rule.Url,
+	}
+}
+
+// handleAlarmRules pushes the alarms in [startTime, endTime] of the app according to the rules,
+// the rule whose search fails keeps its own cursor and searches from it in the next round
+func handleAlarmRules(app *App, rules []*AlarmRule, startTime int64, endTime int64) {
+	for _, rule := range rules {
+		if rule.Threshold <= 1 {
+			ruleStartTime := startTime
+			if rule.LastAlarmTime > 0 && rule.LastAlarmTime < startTime {
+				ruleStartTime = rule.LastAlarmTime
+			}
+			total, alarms, err := logs.SearchAttackWithFilter(ruleStartTime, endTime, rule.filter(), 10, app.Id)
+			if err != nil {
+				beego.Error("failed to search alarms for the alarm rule " + rule.Id + ": " + err.Error())
+				if rule.LastAlarmTime <= 0 || rule.LastAlarmTime > startTime {
+					err = mongo.UpdateId(alarmRuleCollectionName, rule.Id, bson.M{"last_alarm_time": startTime})
+					if err != nil {
+						beego.Error("failed to update the cursor of the alarm rule " + rule.Id + ": " + err.Error())
+					}
+				}
+				continue
+			}
+			if total > 0 {
+				msg := newAttackAlarmMessage(app, total, alarms, false)
+				msg.Title += ": " + rule.Name
+				msg.Content = "报警规则：" + rule.Name + "\n" + msg.Content
+				pushAlarmToChannels(app, msg, rule.Channels)
+			}
+			if rule.LastAlarmTime > 0 {
+				err = mongo.UpdateId(alarmRuleCollectionName, rule.Id, bson.M{"last_alarm_time": 0})
+				if err != nil {
+					beego.Error("failed to update the cursor of the alarm rule " + rule.Id + ": " + err.Error())
+				}
+			}
+			continue
+		}
+
+		// the rule with threshold is silenced in the period after it is triggered
+		periodMillis := int64(rule.Period) * 60 * 1000
+		if endTime-rule.LastTriggerTime < periodMillis {
+			continue
+		}
+		sources, err := logs.AggregationAttackWithSource(endTime-periodMillis, endTime, rule.filter(),
+			rule.Threshold, alarmRuleSourceSize, app.Id)
+		if err != nil {
+			beego.Error("failed to aggregate alarms for the alarm rule " + rule.Id + ": " + err.Error())
+			continue
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		filter := rule.filter()
+		var sourceDesc []string
+		for _, source := range sources {
+			filter.AttackSources = append(filter.AttackSources, fmt.Sprint(source[0]))
+			sourceDesc = append(sourceDesc, fmt.Sprintf("%v（%v 次）", source[0], source[1]))
+		}
+		total, alarms, err := logs.SearchAttackWithFilter(endTime-periodMillis, endTime, filter, 10, app.Id)
+		if err != nil {
+			beego.Error("failed to search alarms for the alarm rule " + rule.Id + ": " + err.Error())
+			continue
+		}
+		msg := newAttackAlarmMessage(app, total, alarms, false)
+		msg.Title += ": " + rule.Name
+		msg.Content = "报警规则：" + rule.Name + "\n以下攻击来源在 " + strconv.Itoa(rule.Period) + " 分钟内的报警次数达到 " +
+			strconv.FormatInt(rule.Threshold, 10) + " 次：" + strings.Join(sourceDesc, "，") + "\n" + msg.Content
+		pushAlarmToChannels(app, msg, rule.Channels)
+		err = mongo.UpdateId(alarmRuleCollectionName, rule.Id, bson.M{"last_trigger_time": endTime})
+		if err != nil {
+			beego.Error("failed to update the trigger time of the alarm rule " + rule.Id + ": " + err.Error())
+		}
+	}
+}
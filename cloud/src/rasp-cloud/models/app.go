@@ -57,6 +57,9 @@ type App struct {
 	EmailAlarmConf   EmailAlarmConf         `json:"email_alarm_conf" bson:"email_alarm_conf"`
 	DingAlarmConf    DingAlarmConf          `json:"ding_alarm_conf" bson:"ding_alarm_conf"`
 	HttpAlarmConf    HttpAlarmConf          `json:"http_alarm_conf" bson:"http_alarm_conf"`
+	ChannelAlarmConf ChannelAlarmConf       `json:"channel_alarm_conf" bson:"channel_alarm_conf"`
+	// the uploaded and deployed plugins must be signed by the trusted keys if it is true
+	RequirePluginSignature bool `json:"require_plugin_signature" bson:"require_plugin_signature"`
 }
 
 type WhitelistConfigItem struct {
@@ -83,6 +86,37 @@ type DingAlarmConf struct {
 	RecvParty  []string `json:"recv_party" bson:"recv_party"`
 }
 
+// ChannelAlarmConf is the config of the notifiers registered by RegisterNotifier, keyed by the notifier name
+type ChannelAlarmConf map[string]map[string]interface{}
+
+// the webhook url of slack, teams and wecom carries the credential, so it is masked as the secret
+var channelSecretKeys = []string{"secret", "webhook_url"}
+
+func (channels ChannelAlarmConf) maskSecret() {
+	for _, conf := range channels {
+		for _, key := range channelSecretKeys {
+			if secret, ok := conf[key].(string); ok && secret != "" {
+				conf[key] = SecreteMask
+			}
+		}
+	}
+}
+
+// RestoreSecret replaces the masked secrets in the config of the channel with the stored ones,
+// the masked secrets are removed if they are not stored
+func (channels ChannelAlarmConf) RestoreSecret(name string, conf map[string]interface{}) {
+	for _, key := range channelSecretKeys {
+		if conf[key] != SecreteMask {
+			continue
+		}
+		if stored, ok := channels[name][key]; ok {
+			conf[key] = stored
+		} else {
+			delete(conf, key)
+		}
+	}
+}
+
 type HttpAlarmConf struct {
 	Enable   bool     `json:"enable" bson:"enable"`
 	RecvAddr []string `json:"recv_addr" bson:"recv_addr"`
@@ -95,6 +129,18 @@ type emailTemplateParam struct {
 	AppName      string
 }
 
+type raspEmailTemplateParam struct {
+	Title        string
+	Rasps        []*RaspAlarmItem
+	DetailedLink string
+	AppName      string
+}
+
+type RaspAlarmItem struct {
+	*Rasp
+	LastHeartbeat string `json:"last_heartbeat"`
+}
+
 type dingResponse struct {
 	ErrCode     int64  `json:"errcode"`
 	ErrMsg      string `json:"errmsg"`
@@ -105,11 +151,13 @@ const (
 	appCollectionName = "app"
 	defaultAppName    = "PHP 示例应用"
 	SecreteMask       = "************"
+	// only the rasps that went offline within the window will be alarmed, unit second
+	raspOfflineAlarmWindow = 24 * 3600
+	alarmLeaseName         = "alarm"
 )
 
 var (
 	panelServerURL string
-	lastAlarmTime  = time.Now().UnixNano() / 1000000
 	TestAlarmData  = []map[string]interface{}{
 		{
 			"event_time":      time.Now().Format("2006-01-01 15:04:05"),
@@ -195,6 +243,16 @@ func startAlarmTicker(interval time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
+			// only the instance holding the lease pushes alarms, the lease outlives a few missed ticks
+			// so that it is not taken over by another instance when the current one is just slow
+			isLeader, err := AcquireLease(alarmLeaseName, 3*interval)
+			if err != nil {
+				beego.Error("failed to acquire the alarm lease: " + err.Error())
+				continue
+			}
+			if !isLeader {
+				continue
+			}
 			handleAttackAlarm()
 			handleRaspExpiredAlarm()
 		}
@@ -213,28 +271,107 @@ func handleAttackAlarm() {
 		beego.Error("failed to get apps for the alarm: " + err.Error())
 		return
 	}
-	now := time.Now().UnixNano() / 1000000
 	for _, app := range apps {
-		total, result, err := logs.SearchLogs(lastAlarmTime, now, nil, "event_time",
-			1, 10, false, logs.AliasAttackIndexName+"-"+app.Id)
+		lastAlarmTime, err := getAlarmCursor(app.Id)
 		if err != nil {
-			beego.Error("failed to get alarm from es: " + err.Error())
+			beego.Error("failed to get the alarm cursor of app " + app.Id + ": " + err.Error())
 			continue
 		}
-		if total > 0 {
-			PushAttackAlarm(&app, total, result, false)
+		now := time.Now().UnixNano() / 1000000
+		if lastAlarmTime > now {
+			continue
 		}
+		err = handleAppAttackAlarm(&app, lastAlarmTime, now)
+		if err != nil {
+			// the cursor is kept, so that the alarms will be pushed in the next round
+			beego.Error("failed to handle alarm for app " + app.Id + ": " + err.Error())
+			continue
+		}
+		err = setAlarmCursor(app.Id, now+1)
+		if err != nil {
+			beego.Error("failed to update the alarm cursor of app " + app.Id + ": " + err.Error())
+		}
+	}
+}
+
+func handleAppAttackAlarm(app *App, startTime int64, endTime int64) error {
+	rules, err := getEnabledAlarmRules(app.Id)
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		handleAlarmRules(app, rules, startTime, endTime)
+		return nil
+	}
+	total, result, err := logs.SearchLogs(startTime, endTime, nil, "event_time",
+		1, 10, false, logs.AliasAttackIndexName+"-"+app.Id)
+	if err != nil {
+		return err
+	}
+	if total > 0 {
+		PushAttackAlarm(app, total, result, false)
 	}
-	lastAlarmTime = now + 1
+	return nil
 }
 
 func handleRaspExpiredAlarm() {
-	//defer func() {
-	//	if r := recover(); r != nil {
-	//		beego.Error("failed to handle alarm: ", r)
-	//	}
-	//}()
-	//Rasp
+	defer func() {
+		if r := recover(); r != nil {
+			beego.Error("failed to handle rasp expired alarm: ", r)
+		}
+	}()
+	offlineRasps, err := FindRaspForOfflineAlarm(false)
+	if err != nil {
+		beego.Error("failed to get offline rasps for the alarm: " + err.Error())
+		return
+	}
+	// the rasps that went offline long ago (e.g. before the cloud was upgraded) are marked silently
+	now := time.Now().Unix()
+	var recentOfflineRasps []*Rasp
+	for _, rasp := range offlineRasps {
+		if now-GetRaspExpiredTime(rasp) <= raspOfflineAlarmWindow {
+			recentOfflineRasps = append(recentOfflineRasps, rasp)
+		}
+	}
+	pushRaspAlarmByApp(recentOfflineRasps, false)
+	err = SetRaspOfflineNotified(getRaspIds(offlineRasps), true)
+	if err != nil {
+		beego.Error("failed to mark offline rasps as notified: " + err.Error())
+	}
+
+	onlineRasps, err := FindRaspForOfflineAlarm(true)
+	if err != nil {
+		beego.Error("failed to get recovered rasps for the alarm: " + err.Error())
+		return
+	}
+	pushRaspAlarmByApp(onlineRasps, true)
+	err = SetRaspOfflineNotified(getRaspIds(onlineRasps), false)
+	if err != nil {
+		beego.Error("failed to mark recovered rasps as notified: " + err.Error())
+	}
+}
+
+func getRaspIds(rasps []*Rasp) []string {
+	ids := make([]string, 0, len(rasps))
+	for _, rasp := range rasps {
+		ids = append(ids, rasp.Id)
+	}
+	return ids
+}
+
+func pushRaspAlarmByApp(rasps []*Rasp, online bool) {
+	appRasps := make(map[string][]*Rasp)
+	for _, rasp := range rasps {
+		appRasps[rasp.AppId] = append(appRasps[rasp.AppId], rasp)
+	}
+	for appId, rasps := range appRasps {
+		app, err := GetAppByIdWithoutMask(appId)
+		if err != nil {
+			beego.Error("failed to get app " + appId + " for the rasp alarm: " + err.Error())
+			continue
+		}
+		PushRaspAlarm(app, rasps, online)
+	}
 }
 
 func AddApp(app *App) (result *App, err error) {
@@ -280,7 +417,7 @@ func selectDefaultPlugin(app *App) {
 		beego.Warn(tools.ErrCodeInitDefaultAppFailed, "failed to get default plugin: "+err.Error())
 		return
 	}
-	plugin, err := AddPlugin(content, app.Id)
+	plugin, err := AddPlugin(content, "", app.Id)
 	if err != nil {
 		beego.Warn(tools.ErrCodeInitDefaultAppFailed, "failed to insert default plugin: "+err.Error())
 		return
@@ -309,7 +446,15 @@ func generateSecret(app *App) string {
 }
 
 func GetAllApp(page int, perpage int, mask bool) (count int, result []*App, err error) {
-	count, err = mongo.FindAll(appCollectionName, nil, &result, perpage*(page-1), perpage, "name")
+	return findApps(nil, page, perpage, mask)
+}
+
+func GetAppsByIds(ids []string, page int, perpage int, mask bool) (count int, result []*App, err error) {
+	return findApps(bson.M{"_id": bson.M{"$in": ids}}, page, perpage, mask)
+}
+
+func findApps(query interface{}, page int, perpage int, mask bool) (count int, result []*App, err error) {
+	count, err = mongo.FindAll(appCollectionName, query, &result, perpage*(page-1), perpage, "name")
 	if err == nil && result != nil {
 		for _, app := range result {
 			if mask {
@@ -371,6 +516,9 @@ func HandleApp(app *App, isCreate bool) {
 	if app.HttpAlarmConf.RecvAddr == nil {
 		app.HttpAlarmConf.RecvAddr = make([]string, 0)
 	}
+	if app.ChannelAlarmConf == nil {
+		app.ChannelAlarmConf = make(ChannelAlarmConf)
+	}
 	if !isCreate {
 		if app.EmailAlarmConf.Password != "" {
 			app.EmailAlarmConf.Password = SecreteMask
@@ -378,6 +526,7 @@ func HandleApp(app *App, isCreate bool) {
 		if app.DingAlarmConf.CorpSecret != "" {
 			app.DingAlarmConf.CorpSecret = SecreteMask
 		}
+		app.ChannelAlarmConf.maskSecret()
 	} else {
 		if app.GeneralConfig == nil {
 			app.GeneralConfig = DefaultGeneralConfig
@@ -399,12 +548,95 @@ func UpdateAppById(id string, doc interface{}) (app *App, err error) {
 	return GetAppById(id)
 }
 
-func UpdateGeneralConfig(appId string, config map[string]interface{}) (*App, error) {
-	return UpdateAppById(appId, bson.M{"general_config": config, "config_time": time.Now().UnixNano()})
+func UpdateGeneralConfig(appId string, config map[string]interface{}, user string) (*App, error) {
+	return updateGeneralConfig(appId, config, user, "")
+}
+
+func updateGeneralConfig(appId string, config map[string]interface{}, user string, comment string) (*App, error) {
+	oldApp, err := GetAppByIdWithoutMask(appId)
+	if err != nil {
+		return nil, err
+	}
+	app, err := UpdateAppById(appId, bson.M{"general_config": config, "config_time": time.Now().UnixNano()})
+	if err != nil {
+		return nil, err
+	}
+	var before interface{}
+	if oldApp.GeneralConfig != nil {
+		before = oldApp.GeneralConfig
+	}
+	err = addConfigRevision(appId, ConfigTypeGeneral, "", before, config, user, comment)
+	if err != nil {
+		return nil, undoAppConfig(appId, bson.M{"general_config": oldApp.GeneralConfig,
+			"config_time": time.Now().UnixNano()}, err)
+	}
+	return app, nil
 }
 
-func UpdateWhiteListConfig(appId string, config []WhitelistConfigItem) (app *App, err error) {
-	return UpdateAppById(appId, bson.M{"whitelist_config": config, "config_time": time.Now().UnixNano()})
+func UpdateWhiteListConfig(appId string, config []WhitelistConfigItem, user string) (app *App, err error) {
+	return updateWhiteListConfig(appId, config, user, "")
+}
+
+func updateWhiteListConfig(appId string, config []WhitelistConfigItem, user string,
+	comment string) (*App, error) {
+	oldApp, err := GetAppByIdWithoutMask(appId)
+	if err != nil {
+		return nil, err
+	}
+	app, err := UpdateAppById(appId, bson.M{"whitelist_config": config, "config_time": time.Now().UnixNano()})
+	if err != nil {
+		return nil, err
+	}
+	var before interface{}
+	if oldApp.WhitelistConfig != nil {
+		before = oldApp.WhitelistConfig
+	}
+	err = addConfigRevision(appId, ConfigTypeWhitelist, "", before, config, user, comment)
+	if err != nil {
+		return nil, undoAppConfig(appId, bson.M{"whitelist_config": oldApp.WhitelistConfig,
+			"config_time": time.Now().UnixNano()}, err)
+	}
+	return app, nil
+}
+
+// UpdateAlarmConfig updates the alarm config of app with the fields of doc
+func UpdateAlarmConfig(appId string, doc bson.M, user string) (*App, error) {
+	return updateAlarmConfig(appId, doc, user, "")
+}
+
+func updateAlarmConfig(appId string, doc bson.M, user string, comment string) (*App, error) {
+	oldApp, err := GetAppByIdWithoutMask(appId)
+	if err != nil {
+		return nil, err
+	}
+	if err = mongo.UpdateId(appCollectionName, appId, doc); err != nil {
+		return nil, err
+	}
+	newApp, err := GetAppByIdWithoutMask(appId)
+	if err != nil {
+		return nil, err
+	}
+	err = addConfigRevision(appId, ConfigTypeAlarm, "", getAlarmConfig(oldApp), getAlarmConfig(newApp),
+		user, comment)
+	if err != nil {
+		return nil, undoAppConfig(appId, bson.M{
+			"email_alarm_conf":   oldApp.EmailAlarmConf,
+			"ding_alarm_conf":    oldApp.DingAlarmConf,
+			"http_alarm_conf":    oldApp.HttpAlarmConf,
+			"channel_alarm_conf": oldApp.ChannelAlarmConf,
+		}, err)
+	}
+	HandleApp(newApp, false)
+	return newApp, nil
+}
+
+// undoAppConfig restores the config of app if its revision fails to be saved,
+// so that every applied config has a revision
+func undoAppConfig(appId string, doc bson.M, cause error) error {
+	if err := mongo.UpdateId(appCollectionName, appId, doc); err != nil {
+		return errors.New(cause.Error() + ", and failed to restore the config of app: " + err.Error())
+	}
+	return cause
 }
 
 func RemoveAppById(id string) (app *App, err error) {
@@ -421,91 +653,84 @@ func GetAppCount() (count int, err error) {
 
 func PushAttackAlarm(app *App, total int64, alarms []map[string]interface{}, isTest bool) {
 	if app != nil {
-		if app.DingAlarmConf.Enable {
-			PushDingAttackAlarm(app, total, alarms, isTest)
-		}
-		if app.EmailAlarmConf.Enable {
-			PushEmailAttackAlarm(app, total, alarms, isTest)
-		}
-		if app.HttpAlarmConf.Enable {
-			PushHttpAttackAlarm(app, total, alarms, isTest)
-		}
+		pushAlarm(app, newAttackAlarmMessage(app, total, alarms, isTest))
+	}
+}
+
+// PushRaspAlarm notifies that the rasps of the app went offline, or came back online if online is true
+func PushRaspAlarm(app *App, rasps []*Rasp, online bool) {
+	if app == nil || len(rasps) == 0 {
+		return
 	}
+	pushAlarm(app, newRaspAlarmMessage(app, rasps, online))
 }
 
 func PushEmailAttackAlarm(app *App, total int64, alarms []map[string]interface{}, isTest bool) error {
-	var emailConf = app.EmailAlarmConf
-	if len(emailConf.RecvAddr) > 0 && emailConf.ServerAddr != "" {
-		var (
-			subject   string
-			msg       string
-			emailAddr = &mail.Address{Address: emailConf.UserName}
-		)
-		hostName, err := os.Hostname()
-		if err == nil {
-			emailAddr.Name = hostName
-		} else {
-			emailAddr.Name = "OpenRASP"
-		}
-		if emailConf.Subject == "" {
-			subject = "OpenRASP alarm"
-		} else {
-			subject = emailConf.Subject
-		}
-		if isTest {
-			subject = "【测试邮件】" + subject
-			alarms = TestAlarmData
-			total = int64(len(TestAlarmData))
-		}
-		head := map[string]string{
-			"from":         emailAddr.String(),
-			"To":           strings.Join(emailConf.RecvAddr, ","),
-			"Content-Type": "text/html; charset=UTF-8",
-			"Subject":      subject,
-		}
-		t, err := template.ParseFiles("views/email.tpl")
-		if err != nil {
-			beego.Error("failed to render email template: " + err.Error())
-			return err
-		}
-		alarmData := new(bytes.Buffer)
-		err = t.Execute(alarmData, &emailTemplateParam{
-			Total:        total - int64(len(alarms)),
-			Alarms:       alarms,
-			AppName:      app.Name,
-			DetailedLink: panelServerURL + "/#/events/" + app.Id,
-		})
-		if err != nil {
-			beego.Error("failed to execute email template: " + err.Error())
-			return err
-		}
-		for k, v := range head {
-			msg += fmt.Sprintf("%s: %s\r\n", k, v)
-		}
-		msg += "\r\n" + alarmData.String()
-		host, _, err := net.SplitHostPort(emailConf.ServerAddr)
-		if err != nil {
-			errMsg := "failed to get email serve host: " + err.Error()
-			beego.Error(errMsg)
-			return errors.New(errMsg)
-		}
-		auth := smtp.PlainAuth("", emailConf.UserName, emailConf.Password, host)
-		if emailConf.Password == "" {
-			auth = nil
-		}
+	return notifiers["email"].Notify(app, newAttackAlarmMessage(app, total, alarms, isTest))
+}
 
-		if emailConf.TlsEnable {
-			return sendEmailWithTls(emailConf, auth, msg)
-		} else {
-			return sendNormalEmail(emailConf, auth, msg)
-		}
-	} else {
+func renderEmailTemplate(file string, data interface{}) (string, error) {
+	t, err := template.ParseFiles(file)
+	if err != nil {
+		beego.Error("failed to render email template: " + err.Error())
+		return "", err
+	}
+	content := new(bytes.Buffer)
+	err = t.Execute(content, data)
+	if err != nil {
+		beego.Error("failed to execute email template: " + err.Error())
+		return "", err
+	}
+	return content.String(), nil
+}
+
+func sendEmailAlarm(app *App, subject string, content string) error {
+	var emailConf = app.EmailAlarmConf
+	if len(emailConf.RecvAddr) == 0 || emailConf.ServerAddr == "" {
 		beego.Error(
 			"failed to send email alarm: the email receiving address and email server address can not be empty", emailConf)
 		return errors.New("the email receiving address and email server address can not be empty")
 	}
-	beego.Debug("succeed in pushing email alarm for app: " + app.Name)
-	return nil
+	var (
+		msg       string
+		emailAddr = &mail.Address{Address: emailConf.UserName}
+	)
+	hostName, err := os.Hostname()
+	if err == nil {
+		emailAddr.Name = hostName
+	} else {
+		emailAddr.Name = "OpenRASP"
+	}
+	head := map[string]string{
+		"from":         emailAddr.String(),
+		"To":           strings.Join(emailConf.RecvAddr, ","),
+		"Content-Type": "text/html; charset=UTF-8",
+		"Subject":      subject,
+	}
+	for k, v := range head {
+		msg += fmt.Sprintf("%s: %s\r\n", k, v)
+	}
+	msg += "\r\n" + content
+	host, _, err := net.SplitHostPort(emailConf.ServerAddr)
+	if err != nil {
+		errMsg := "failed to get email serve host: " + err.Error()
+		beego.Error(errMsg)
+		return errors.New(errMsg)
+	}
+	auth := smtp.PlainAuth("", emailConf.UserName, emailConf.Password, host)
+	if emailConf.Password == "" {
+		auth = nil
+	}
+
+	if emailConf.TlsEnable {
+		err = sendEmailWithTls(emailConf, auth, msg)
+	} else {
+		err = sendNormalEmail(emailConf, auth, msg)
+	}
+	if err == nil {
+		beego.Debug("succeed in pushing email alarm for app: " + app.Name)
+	}
+	return err
 }
 
 func sendNormalEmail(emailConf EmailAlarmConf, auth smtp.Auth, msg string) (err error) {
@@ -584,117 +809,109 @@ func smtpTlsDial(addr string) (*smtp.Client, error) {
 }
 
 func PushHttpAttackAlarm(app *App, total int64, alarms []map[string]interface{}, isTest bool) error {
+	return notifiers["http"].Notify(app, newAttackAlarmMessage(app, total, alarms, isTest))
+}
+
+func sendHttpAlarm(app *App, body map[string]interface{}) error {
 	var httpConf = app.HttpAlarmConf
-	if len(httpConf.RecvAddr) != 0 {
-		body := make(map[string]interface{})
-		body["app_id"] = app.Id
-		if isTest {
-			body["data"] = TestAlarmData
-		} else {
-			body["data"] = alarms
-		}
-		for _, addr := range httpConf.RecvAddr {
-			request := httplib.Post(addr)
-			request.JSONBody(body)
-			request.SetTimeout(10*time.Second, 10*time.Second)
-			response, err := request.Response()
-			if err != nil {
-				beego.Error("failed to push http alarms to: " + addr + ", with error: " + err.Error())
-				return err
-			}
-			if response.StatusCode > 299 || response.StatusCode < 200 {
-				err := errors.New("failed to push http alarms to: " + addr + ", with status code: " +
-					strconv.Itoa(response.StatusCode))
-				beego.Error(err.Error())
-				return err
-			}
-		}
-	} else {
+	if len(httpConf.RecvAddr) == 0 {
 		beego.Error("failed to send http alarm: the http receiving address can not be empty", httpConf)
 		return errors.New("the http receiving address can not be empty")
 	}
-	beego.Debug("succeed in pushing http alarm for app: " + app.Name + " ,with urls: " +
-		fmt.Sprintf("%v", httpConf.RecvAddr))
-	return nil
-}
-
-func PushDingAttackAlarm(app *App, total int64, alarms []map[string]interface{}, isTest bool) error {
-	var dingCong = app.DingAlarmConf
-	if dingCong.CorpId != "" && dingCong.CorpSecret != "" && dingCong.AgentId != "" &&
-		!(len(dingCong.RecvParty) == 0 && len(dingCong.RecvUser) == 0) {
-
-		request := httplib.Get("https://oapi.dingtalk.com/gettoken")
-		request.SetTimeout(10*time.Second, 10*time.Second)
-		request.Param("corpid", dingCong.CorpId)
-		request.Param("corpsecret", dingCong.CorpSecret)
-		response, err := request.Response()
-		errMsg := "failed to get ding ding token with corp id: " + dingCong.CorpId
-		if err != nil {
-			beego.Error(errMsg + ", with error: " + err.Error())
-			return err
-		}
-		if response.StatusCode != 200 {
-			err := errors.New(errMsg + ", with status code: " + strconv.Itoa(response.StatusCode))
-			beego.Error(err.Error())
-			return err
-		}
-		var result dingResponse
-		err = request.ToJSON(&result)
-		if err != nil {
-			beego.Error(errMsg + ", with error: " + err.Error())
-			return err
-		}
-		if result.ErrCode != 0 {
-			err := errors.New(errMsg + ", with errmsg: " + result.ErrMsg)
-			beego.Error(err.Error())
-			return err
-		}
-		token := result.AccessToken
-		body := make(map[string]interface{})
-		dingText := ""
-		if isTest {
-			dingText = "OpenRASP test message from app: " + app.Name + ", time: " + time.Now().Format(time.RFC3339)
-		} else {
-			dingText = "时间：" + time.Now().Format(time.RFC3339) + "， 来自 OpenRAS 的报警\n共有 " +
-				strconv.FormatInt(total, 10) + " 条报警信息来自 APP：" + app.Name + "，详细信息：" + panelServerURL + "/#/events/" + app.Id
-		}
-		if len(dingCong.RecvUser) > 0 {
-			body["touser"] = strings.Join(dingCong.RecvUser, "|")
-		}
-		if len(dingCong.RecvParty) > 0 {
-			body["toparty"] = strings.Join(dingCong.RecvParty, "|")
-		}
-		body["agentid"] = dingCong.AgentId
-		body["msgtype"] = "text"
-		body["text"] = map[string]string{"content": dingText}
-		request = httplib.Post("https://oapi.dingtalk.com/message/send?access_token=" + token)
+	for _, addr := range httpConf.RecvAddr {
+		request := httplib.Post(addr)
 		request.JSONBody(body)
 		request.SetTimeout(10*time.Second, 10*time.Second)
-		response, err = request.Response()
-		errMsg = "failed to push ding ding alarms with corp id: " + dingCong.CorpId
-		if err != nil {
-			beego.Error(errMsg + ", with error: " + err.Error())
-			return err
-		}
-		if response.StatusCode != 200 {
-			err := errors.New(errMsg + ", with status code: " + strconv.Itoa(response.StatusCode))
-			beego.Error(err.Error())
-			return err
-		}
-		err = request.ToJSON(&result)
+		response, err := request.Response()
 		if err != nil {
-			beego.Error(errMsg + ", with error: " + err.Error())
+			beego.Error("failed to push http alarms to: " + addr + ", with error: " + err.Error())
 			return err
 		}
-		if result.ErrCode != 0 {
-			err := errors.New(errMsg + ", with errmsg: " + result.ErrMsg)
+		if response.StatusCode > 299 || response.StatusCode < 200 {
+			err := errors.New("failed to push http alarms to: " + addr + ", with status code: " +
+				strconv.Itoa(response.StatusCode))
 			beego.Error(err.Error())
 			return err
 		}
-	} else {
+	}
+	beego.Debug("succeed in pushing http alarm for app: " + app.Name + " ,with urls: " +
+		fmt.Sprintf("%v", httpConf.RecvAddr))
+	return nil
+}
+
+func PushDingAttackAlarm(app *App, total int64, alarms []map[string]interface{}, isTest bool) error {
+	return notifiers["ding"].Notify(app, newAttackAlarmMessage(app, total, alarms, isTest))
+}
+
+func sendDingAlarm(app *App, dingText string) error {
+	var dingCong = app.DingAlarmConf
+	if dingCong.CorpId == "" || dingCong.CorpSecret == "" || dingCong.AgentId == "" ||
+		(len(dingCong.RecvParty) == 0 && len(dingCong.RecvUser) == 0) {
 		beego.Error("failed to send ding ding alarm: invalid ding ding alarm conf", dingCong)
 		return errors.New("invalid ding ding alarm conf")
 	}
+
+	request := httplib.Get("https://oapi.dingtalk.com/gettoken")
+	request.SetTimeout(10*time.Second, 10*time.Second)
+	request.Param("corpid", dingCong.CorpId)
+	request.Param("corpsecret", dingCong.CorpSecret)
+	response, err := request.Response()
+	errMsg := "failed to get ding ding token with corp id: " + dingCong.CorpId
+	if err != nil {
+		beego.Error(errMsg + ", with error: " + err.Error())
+		return err
+	}
+	if response.StatusCode != 200 {
+		err := errors.New(errMsg + ", with status code: " + strconv.Itoa(response.StatusCode))
+		beego.Error(err.Error())
+		return err
+	}
+	var result dingResponse
+	err = request.ToJSON(&result)
+	if err != nil {
+		beego.Error(errMsg + ", with error: " + err.Error())
+		return err
+	}
+	if result.ErrCode != 0 {
+		err := errors.New(errMsg + ", with errmsg: " + result.ErrMsg)
+		beego.Error(err.Error())
+		return err
+	}
+	token := result.AccessToken
+	body := make(map[string]interface{})
+	if len(dingCong.RecvUser) > 0 {
+		body["touser"] = strings.Join(dingCong.RecvUser, "|")
+	}
+	if len(dingCong.RecvParty) > 0 {
+		body["toparty"] = strings.Join(dingCong.RecvParty, "|")
+	}
+	body["agentid"] = dingCong.AgentId
+	body["msgtype"] = "text"
+	body["text"] = map[string]string{"content": dingText}
+	request = httplib.Post("https://oapi.dingtalk.com/message/send?access_token=" + token)
+	request.JSONBody(body)
+	request.SetTimeout(10*time.Second, 10*time.Second)
+	response, err = request.Response()
+	errMsg = "failed to push ding ding alarms with corp id: " + dingCong.CorpId
+	if err != nil {
+		beego.Error(errMsg + ", with error: " + err.Error())
+		return err
+	}
+	if response.StatusCode != 200 {
+		err := errors.New(errMsg + ", with status code: " + strconv.Itoa(response.StatusCode))
+		beego.Error(err.Error())
+		return err
+	}
+	err = request.ToJSON(&result)
+	if err != nil {
+		beego.Error(errMsg + ", with error: " + err.Error())
+		return err
+	}
+	if result.ErrCode != 0 {
+		err := errors.New(errMsg + ", with errmsg: " + result.ErrMsg)
+		beego.Error(err.Error())
+		return err
+	}
 	beego.Debug("succeed in pushing ding ding alarm for app: " + app.Name + " ,with corp id: " + dingCong.CorpId)
 	return nil
 }
@@ -0,0 +1,191 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/tools/codec"
+	"strconv"
+	"time"
+)
+
+// AppBundle is the portable config of an app, the absent or null parts are not changed on import
+type AppBundle struct {
+	BundleVersion   int                    `json:"bundle_version"`
+	ExportTime      int64                  `json:"export_time"`
+	Name            string                 `json:"name"`
+	Language        string                 `json:"language"`
+	Description     string                 `json:"description"`
+	GeneralConfig   map[string]interface{} `json:"general_config"`
+	WhitelistConfig []WhitelistConfigItem  `json:"whitelist_config"`
+	AlarmConfig     *AlarmConfig           `json:"alarm_config,omitempty"`
+	Plugin          *AppBundlePlugin       `json:"plugin,omitempty"`
+}
+
+// AppBundlePlugin is the selected plugin of the app, the content of the signed plugin is the uploaded one
+// covered by the signature, and the algorithm config is applied to it on import
+type AppBundlePlugin struct {
+	Name            string                 `json:"name"`
+	Version         string                 `json:"version"`
+	Content         string                 `json:"content"`
+	AlgorithmConfig map[string]interface{} `json:"algorithm_config"`
+	Signature       string                 `json:"signature,omitempty"`
+}
+
+const (
+	appBundleVersion = 1
+)
+
+// ExportAppBundle exports the configs and the selected plugin of the app,
+// the secrets of alarm config are masked unless includeSecrets is true
+func ExportAppBundle(appId string, includeSecrets bool) (*AppBundle, error) {
+	var app *App
+	var err error
+	if includeSecrets {
+		app, err = GetAppByIdWithoutMask(appId)
+	} else {
+		app, err = GetAppById(appId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bundle := &AppBundle{
+		BundleVersion:   appBundleVersion,
+		ExportTime:      time.Now().UnixNano() / 1000000,
+		Name:            app.Name,
+		Language:        app.Language,
+		Description:     app.Description,
+		GeneralConfig:   app.GeneralConfig,
+		WhitelistConfig: app.WhitelistConfig,
+		AlarmConfig:     getAlarmConfig(app),
+	}
+	if app.SelectedPluginId != "" {
+		plugin, err := GetPluginById(app.SelectedPluginId, true)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if plugin != nil {
+			bundle.Plugin = &AppBundlePlugin{
+				Name:            plugin.Name,
+				Version:         plugin.Version,
+				Content:         plugin.Content,
+				AlgorithmConfig: plugin.AlgorithmConfig,
+				Signature:       plugin.Signature,
+			}
+			// the signed plugins uploaded by the old version have no signed content, their content is
+			// exported as it is, and it can only be imported without signature if the config is changed
+			if plugin.SignedContent != "" {
+				bundle.Plugin.Content = plugin.SignedContent
+			}
+		}
+	}
+	return bundle, nil
+}
+
+// ParseAppBundle decodes the json or yaml bundle
+func ParseAppBundle(content []byte) (*AppBundle, error) {
+	var bundle *AppBundle
+	if err := codec.Unmarshal(content, &bundle); err != nil {
+		return nil, errors.New("failed to decode the bundle: " + err.Error())
+	}
+	if bundle == nil {
+		return nil, errors.New("the bundle can not be empty")
+	}
+	if bundle.BundleVersion > appBundleVersion {
+		return nil, errors.New("unsupported bundle version: " + strconv.Itoa(bundle.BundleVersion))
+	}
+	return bundle, nil
+}
+
+// EncodeAppBundle encodes the bundle in json or yaml format
+func EncodeAppBundle(bundle *AppBundle, format string) ([]byte, error) {
+	return codec.Marshal(bundle, format)
+}
+
+// ImportAppBundle applies the configs and the plugin of bundle to the app, each part is saved as
+// a config revision, the masked secrets of alarm config are kept as the current ones of app,
+// the warnings of the imported plugin are returned
+func ImportAppBundle(appId string, bundle *AppBundle, user string) (*App, []string, error) {
+	app, err := GetAppByIdWithoutMask(appId)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings := make([]string, 0)
+	if bundle.Plugin != nil {
+		plugin, err := importBundlePlugin(app, bundle.Plugin, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, plugin.Warnings...)
+	}
+	if bundle.GeneralConfig != nil {
+		if _, err = UpdateGeneralConfig(appId, bundle.GeneralConfig, user); err != nil {
+			return nil, nil, err
+		}
+	}
+	if bundle.WhitelistConfig != nil {
+		if _, err = UpdateWhiteListConfig(appId, bundle.WhitelistConfig, user); err != nil {
+			return nil, nil, err
+		}
+	}
+	if bundle.AlarmConfig != nil {
+		config := bundle.AlarmConfig
+		if config.EmailAlarmConf.Password == SecreteMask {
+			config.EmailAlarmConf.Password = app.EmailAlarmConf.Password
+		}
+		if config.DingAlarmConf.CorpSecret == SecreteMask {
+			config.DingAlarmConf.CorpSecret = app.DingAlarmConf.CorpSecret
+		}
+		for name, conf := range config.ChannelAlarmConf {
+			app.ChannelAlarmConf.RestoreSecret(name, conf)
+		}
+		_, err = UpdateAlarmConfig(appId, bson.M{
+			"email_alarm_conf":   config.EmailAlarmConf,
+			"ding_alarm_conf":    config.DingAlarmConf,
+			"http_alarm_conf":    config.HttpAlarmConf,
+			"channel_alarm_conf": config.ChannelAlarmConf,
+		}, user)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	app, err = GetAppById(appId)
+	return app, warnings, err
+}
+
+// importBundlePlugin uploads the plugin of bundle and selects it, the plugin is uploaded without signature
+// if the signature does not match, since the algorithm config in content may be changed after signing,
+// unless the app requires signed plugins
+func importBundlePlugin(app *App, bundlePlugin *AppBundlePlugin, user string) (*Plugin, error) {
+	plugin, err := AddPlugin([]byte(bundlePlugin.Content), bundlePlugin.Signature, app.Id)
+	if err != nil && bundlePlugin.Signature != "" && !app.RequirePluginSignature {
+		plugin, err = AddPlugin([]byte(bundlePlugin.Content), "", app.Id)
+	}
+	if err != nil {
+		return nil, errors.New("failed to add the plugin of bundle: " + err.Error())
+	}
+	if bundlePlugin.AlgorithmConfig != nil {
+		_, err = UpdateAlgorithmConfig(plugin.Id, bundlePlugin.AlgorithmConfig, true, user)
+		if err != nil {
+			return nil, errors.New("failed to update the algorithm config of bundle: " + err.Error())
+		}
+	}
+	if err = SetSelectedPlugin(app.Id, plugin.Id); err != nil {
+		return nil, errors.New("failed to select the plugin of bundle: " + err.Error())
+	}
+	return plugin, nil
+}
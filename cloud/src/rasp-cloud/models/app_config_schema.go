@@ -0,0 +1,163 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"rasp-cloud/tools/schema"
+)
+
+// GeneralConfigField is the schema of a general config key
+type GeneralConfigField struct {
+	*schema.Schema
+	Key     string      `json:"key"`
+	Default interface{} `json:"default,omitempty"`
+	// the key is only supported by the agents of these languages, it is supported by all agents if it is empty
+	Languages []string `json:"languages,omitempty"`
+}
+
+const (
+	generalConfigMaxLength = 512
+)
+
+var (
+	// GeneralConfigFields are the known general config keys, they are all optional,
+	// the agents use their own defaults for the absent keys
+	GeneralConfigFields = []*GeneralConfigField{
+		{Key: "clientip.header", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the header of the real client ip, such as X-Forwarded-For"}},
+		{Key: "block.status_code", Schema: &schema.Schema{Type: schema.TypeInteger,
+			Minimum: schema.Float(100), Maximum: schema.Float(999),
+			Description: "the http status code of the blocked request"}},
+		{Key: "block.redirect_url", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the redirect url of the blocked request, %request_id% is replaced with the request id"}},
+		{Key: "block.content_json", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the response of the blocked request which accepts json"}},
+		{Key: "block.content_xml", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the response of the blocked request which accepts xml"}},
+		{Key: "block.content_html", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the response of the blocked request which accepts html"}},
+		{Key: "plugin.timeout.millis", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(1),
+			Description: "the timeout of the plugin checks of a request in milliseconds"}},
+		{Key: "plugin.maxstack", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+			Description: "the max depth of the stack passed to the plugin"}},
+		{Key: "plugin.filter", Schema: &schema.Schema{Type: schema.TypeBoolean,
+			Description: "skip the file checks if the file does not exist"}},
+		{Key: "body.maxbytes", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+			Description: "the max bytes of the request body passed to the plugin"}},
+		{Key: "ognl.expression.minlength", Languages: []string{"java"},
+			Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+				Description: "the min length of the ognl expressions to check"}},
+		{Key: "decompile.enable", Languages: []string{"java"}, Schema: &schema.Schema{Type: schema.TypeBoolean,
+			Description: "decompile the stack of alarms to get the source code"}},
+		{Key: "log.maxstack", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+			Description: "the max depth of the stack in alarms"}},
+		{Key: "log.maxburst", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+			Description: "the max count of alarms per second"}},
+		{Key: "inject.urlprefix", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the url prefix of the pages to inject the html"}},
+		{Key: "inject.custom_headers", Schema: &schema.Schema{Type: schema.TypeObject,
+			AdditionalProperties: true, Description: "the headers added to the responses"}},
+		{Key: "security.enforce_policy", Schema: &schema.Schema{Type: schema.TypeBoolean,
+			Description: "stop the server if it violates the security baseline"}},
+		{Key: "lru.max_size", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+			Description: "the max size of the lru cache of checked items"}},
+		{Key: "debug.level", Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(0),
+			Description: "the debug log level, 0 disables the debug logs"}},
+		{Key: "fileleak_scan.interval", Languages: []string{"php"},
+			Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(60),
+				Description: "the interval of the leaked file scan in seconds"}},
+		{Key: "fileleak_scan.limit", Languages: []string{"php"},
+			Schema: &schema.Schema{Type: schema.TypeInteger, Minimum: schema.Float(1),
+				Description: "the max count of leaked files in a scan"}},
+		{Key: "fileleak_scan.name", Languages: []string{"php"}, Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the regular expression of the leaked file names"}},
+		{Key: "syslog.enable", Schema: &schema.Schema{Type: schema.TypeBoolean,
+			Description: "send the alarms to the syslog server"}},
+		{Key: "syslog.url", Schema: &schema.Schema{Type: schema.TypeString,
+			Pattern:     `^$|^(tcp|udp)://[^:/]+:\d+$`,
+			Description: "the address of the syslog server, such as tcp://127.0.0.1:514"}},
+		{Key: "syslog.tag", Schema: &schema.Schema{Type: schema.TypeString,
+			Description: "the tag of the syslog messages"}},
+		{Key: "syslog.facility", Schema: &schema.Schema{Type: schema.TypeInteger,
+			Minimum: schema.Float(0), Maximum: schema.Float(23), Description: "the facility of the syslog messages"}},
+		{Key: "syslog.connection_timeout", Schema: &schema.Schema{Type: schema.TypeInteger,
+			Minimum: schema.Float(1), Description: "the connection timeout of the syslog server in milliseconds"}},
+		{Key: "syslog.read_timeout", Schema: &schema.Schema{Type: schema.TypeInteger,
+			Minimum: schema.Float(1), Description: "the read timeout of the syslog server in milliseconds"}},
+		{Key: "syslog.reconnect_interval", Schema: &schema.Schema{Type: schema.TypeInteger,
+			Minimum: schema.Float(1), Description: "the reconnect interval of the syslog server in seconds"}},
+	}
+	generalConfigSchema = &schema.Schema{Type: schema.TypeObject, Properties: map[string]*schema.Schema{}}
+)
+
+func init() {
+	for _, field := range GeneralConfigFields {
+		field.Optional = true
+		if field.Type == schema.TypeString {
+			field.MaxLength = schema.Int(generalConfigMaxLength)
+		}
+		field.Default = DefaultGeneralConfig[field.Key]
+		generalConfigSchema.Properties[field.Key] = field.Schema
+	}
+}
+
+// GetGeneralConfigFields returns the general config keys supported by the agents of the language,
+// all keys are returned if the language is empty
+func GetGeneralConfigFields(language string) []*GeneralConfigField {
+	fields := make([]*GeneralConfigField, 0, len(GeneralConfigFields))
+	for _, field := range GeneralConfigFields {
+		if language == "" || field.SupportLanguage(language) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (field *GeneralConfigField) SupportLanguage(language string) bool {
+	if len(field.Languages) == 0 {
+		return true
+	}
+	for _, item := range field.Languages {
+		if item == language {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGeneralConfig validates the general config with the known keys, the keys of other languages
+// are accepted since the agents ignore them, the unknown keys are rejected unless allowUnknownKeys is true
+func ValidateGeneralConfig(config map[string]interface{}, allowUnknownKeys bool) error {
+	if config == nil {
+		return errors.New("the config cannot be nil")
+	}
+	err := generalConfigSchema.Validate(config, &schema.Options{AllowUnknownKeys: allowUnknownKeys})
+	if err != nil {
+		return errors.New("invalid general config: " + err.Error())
+	}
+	for key, value := range config {
+		if _, ok := generalConfigSchema.Properties[key]; ok {
+			continue
+		}
+		if value == nil {
+			return errors.New("the value of " + key + " config cannot be nil")
+		}
+		if v, ok := value.(string); ok && len(v) > generalConfigMaxLength {
+			return errors.New("the length of config key " + key + " can not be greater than 512")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"rasp-cloud/tools/diff"
+	"strconv"
+	"time"
+)
+
+// ConfigRevision is an immutable snapshot of a config of the app after a change,
+// the versions of each config start from 1
+type ConfigRevision struct {
+	Id    string `json:"id" bson:"_id"`
+	AppId string `json:"app_id" bson:"app_id"`
+	Type  string `json:"type" bson:"type"`
+	// the plugin of the algorithm config
+	PluginId string      `json:"plugin_id,omitempty" bson:"plugin_id"`
+	Version  int         `json:"version" bson:"version"`
+	Config   interface{} `json:"config" bson:"config"`
+	User     string      `json:"user" bson:"user"`
+	Comment  string      `json:"comment,omitempty" bson:"comment,omitempty"`
+	Time     int64       `json:"time" bson:"time"`
+}
+
+// AlarmConfig is the alarm config of the app saved in the revisions
+type AlarmConfig struct {
+	EmailAlarmConf   EmailAlarmConf   `json:"email_alarm_conf" bson:"email_alarm_conf"`
+	DingAlarmConf    DingAlarmConf    `json:"ding_alarm_conf" bson:"ding_alarm_conf"`
+	HttpAlarmConf    HttpAlarmConf    `json:"http_alarm_conf" bson:"http_alarm_conf"`
+	ChannelAlarmConf ChannelAlarmConf `json:"channel_alarm_conf" bson:"channel_alarm_conf"`
+}
+
+// ConfigRevisionDiff is the changes from the base revision to the revision
+type ConfigRevisionDiff struct {
+	RevisionId     string        `json:"revision_id"`
+	BaseRevisionId string        `json:"base_revision_id"`
+	Content        string        `json:"content"`
+	Changes        []diff.Change `json:"changes"`
+}
+
+const (
+	configRevisionCollectionName = "config_revision"
+
+	ConfigTypeGeneral   = "general"
+	ConfigTypeWhitelist = "whitelist"
+	ConfigTypeAlarm     = "alarm"
+	ConfigTypeAlgorithm = "algorithm"
+
+	// the unique index of version rejects the revisions saved at the same time, they are retried
+	configRevisionRetries = 5
+)
+
+var (
+	ConfigTypes = []string{ConfigTypeGeneral, ConfigTypeWhitelist, ConfigTypeAlarm, ConfigTypeAlgorithm}
+)
+
+func init() {
+	count, err := mongo.Count(configRevisionCollectionName)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get config_revision collection count", err)
+	}
+	if count <= 0 {
+		index := &mgo.Index{
+			Key:        []string{"app_id", "type", "plugin_id", "version"},
+			Unique:     true,
+			Background: true,
+			Name:       "app_type_version",
+		}
+		err = mongo.CreateIndex(configRevisionCollectionName, index)
+		if err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed,
+				"failed to create app_type_version index for config_revision collection", err)
+		}
+	}
+}
+
+// addConfigRevision saves the config after the change, the config before the change is saved as
+// the first version if the config has no revision yet, such as the configs of the apps created before,
+// the version is allocated again if it is taken by another instance at the same time
+func addConfigRevision(appId string, configType string, pluginId string, before interface{},
+	after interface{}, user string, comment string) (err error) {
+	for i := 0; i < configRevisionRetries; i++ {
+		if err = insertConfigRevision(appId, configType, pluginId, before, after, user, comment); !mgo.IsDup(err) {
+			return err
+		}
+	}
+	return errors.New("failed to allocate the version of " + configType + " config revision: " + err.Error())
+}
+
+func insertConfigRevision(appId string, configType string, pluginId string, before interface{},
+	after interface{}, user string, comment string) error {
+	var latest *ConfigRevision
+	err := mongo.FindOneBySort(configRevisionCollectionName,
+		bson.M{"app_id": appId, "type": configType, "plugin_id": pluginId}, &latest, "-version")
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	} else if before != nil {
+		err = mongo.Insert(configRevisionCollectionName, newConfigRevision(appId, configType, pluginId,
+			version, before, "", "initial config"))
+		if err != nil {
+			return err
+		}
+		version++
+	}
+	return mongo.Insert(configRevisionCollectionName,
+		newConfigRevision(appId, configType, pluginId, version, after, user, comment))
+}
+
+func newConfigRevision(appId string, configType string, pluginId string, version int,
+	config interface{}, user string, comment string) *ConfigRevision {
+	return &ConfigRevision{
+		Id:       mongo.GenerateObjectId(),
+		AppId:    appId,
+		Type:     configType,
+		PluginId: pluginId,
+		Version:  version,
+		Config:   config,
+		User:     user,
+		Comment:  comment,
+		Time:     time.Now().UnixNano() / 1000000,
+	}
+}
+
+// GetConfigRevisions returns the revisions of the app sorted by time in descending order,
+// configType and pluginId are ignored if they are empty
+func GetConfigRevisions(appId string, configType string, pluginId string, page int,
+	perpage int) (count int, result []*ConfigRevision, err error) {
+	query := bson.M{"app_id": appId}
+	if configType != "" {
+		query["type"] = configType
+	}
+	if pluginId != "" {
+		query["plugin_id"] = pluginId
+	}
+	count, err = mongo.FindAll(configRevisionCollectionName, query, &result, perpage*(page-1), perpage,
+		"-time", "-version")
+	if err != nil {
+		return
+	}
+	if result == nil {
+		result = make([]*ConfigRevision, 0)
+	}
+	for _, revision := range result {
+		if err = revision.maskSecret(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetConfigRevisionById returns the revision without masking the secrets
+func GetConfigRevisionById(id string) (revision *ConfigRevision, err error) {
+	err = mongo.FindId(configRevisionCollectionName, id, &revision)
+	return
+}
+
+func RemoveConfigRevisionByAppId(appId string) error {
+	return mongo.RemoveAll(configRevisionCollectionName, bson.M{"app_id": appId})
+}
+
+// DiffConfigRevision returns the unified diff of the json configs and the changed keys,
+// the whitelist items are compared by url, the secrets of alarm config are masked
+func DiffConfigRevision(baseRevision *ConfigRevision, revision *ConfigRevision) (*ConfigRevisionDiff, error) {
+	if baseRevision.AppId != revision.AppId || baseRevision.Type != revision.Type ||
+		baseRevision.PluginId != revision.PluginId {
+		return nil, errors.New("the revisions must belong to the same config")
+	}
+	if err := baseRevision.maskSecret(); err != nil {
+		return nil, err
+	}
+	if err := revision.maskSecret(); err != nil {
+		return nil, err
+	}
+	baseContent, err := json.MarshalIndent(baseRevision.Config, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.MarshalIndent(revision.Config, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	baseObject, err := baseRevision.diffObject()
+	if err != nil {
+		return nil, err
+	}
+	object, err := revision.diffObject()
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigRevisionDiff{
+		RevisionId:     revision.Id,
+		BaseRevisionId: baseRevision.Id,
+		Content: diff.Unified("version "+strconv.Itoa(baseRevision.Version),
+			"version "+strconv.Itoa(revision.Version), string(baseContent)+"\n", string(content)+"\n", 3),
+		Changes: diff.Objects(baseObject, object),
+	}, nil
+}
+
+// RollbackConfigRevision saves the config of the revision as a new revision and applies it to the app,
+// the config_time of app is updated so that the agents pick it up, the config is validated with the schema
+// as the update does since the schema may change after the revision is saved
+func RollbackConfigRevision(revision *ConfigRevision, allowUnknownKeys bool, user string) (*App, error) {
+	comment := "rollback to version " + strconv.Itoa(revision.Version)
+	var err error
+	switch revision.Type {
+	case ConfigTypeGeneral:
+		var config map[string]interface{}
+		if err = revision.decode(&config); err == nil {
+			if err = ValidateGeneralConfig(config, allowUnknownKeys); err == nil {
+				_, err = updateGeneralConfig(revision.AppId, config, user, comment)
+			}
+		}
+	case ConfigTypeWhitelist:
+		var config []WhitelistConfigItem
+		if err = revision.decode(&config); err == nil {
+			_, err = updateWhiteListConfig(revision.AppId, config, user, comment)
+		}
+	case ConfigTypeAlarm:
+		var config AlarmConfig
+		if err = revision.decode(&config); err == nil {
+			_, err = updateAlarmConfig(revision.AppId, bson.M{
+				"email_alarm_conf":   config.EmailAlarmConf,
+				"ding_alarm_conf":    config.DingAlarmConf,
+				"http_alarm_conf":    config.HttpAlarmConf,
+				"channel_alarm_conf": config.ChannelAlarmConf,
+			}, user, comment)
+		}
+	case ConfigTypeAlgorithm:
+		var plugin *Plugin
+		if plugin, err = GetPluginById(revision.PluginId, true); err != nil {
+			return nil, errors.New("failed to get the plugin " + revision.PluginId + ": " + err.Error())
+		}
+		var config map[string]interface{}
+		if err = revision.decode(&config); err == nil {
+			if err = validAlgorithmConfig(plugin, config, allowUnknownKeys); err == nil {
+				_, err = handleAlgorithmConfig(plugin, config, user, comment)
+			}
+		}
+	default:
+		err = errors.New("unknown config type: " + revision.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = touchAppConfig(revision.AppId); err != nil {
+		return nil, err
+	}
+	return GetAppById(revision.AppId)
+}
+
+// decode converts the config decoded from mongo to the type of result
+func (revision *ConfigRevision) decode(result interface{}) error {
+	data, err := bson.Marshal(bson.M{"config": revision.Config})
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Config bson.Raw `bson:"config"`
+	}
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return doc.Config.Unmarshal(result)
+}
+
+func (revision *ConfigRevision) maskSecret() error {
+	if revision.Type != ConfigTypeAlarm {
+		return nil
+	}
+	var config AlarmConfig
+	if err := revision.decode(&config); err != nil {
+		return err
+	}
+	app := &App{EmailAlarmConf: config.EmailAlarmConf, DingAlarmConf: config.DingAlarmConf,
+		HttpAlarmConf: config.HttpAlarmConf, ChannelAlarmConf: config.ChannelAlarmConf}
+	HandleApp(app, false)
+	revision.Config = &AlarmConfig{EmailAlarmConf: app.EmailAlarmConf, DingAlarmConf: app.DingAlarmConf,
+		HttpAlarmConf: app.HttpAlarmConf, ChannelAlarmConf: app.ChannelAlarmConf}
+	return nil
+}
+
+// diffObject converts the config to json object, the whitelist is converted to the hooks by url
+func (revision *ConfigRevision) diffObject() (map[string]interface{}, error) {
+	var config interface{} = revision.Config
+	if revision.Type == ConfigTypeWhitelist {
+		var items []WhitelistConfigItem
+		if err := revision.decode(&items); err != nil {
+			return nil, err
+		}
+		hooks := make(map[string]interface{}, len(items))
+		for _, item := range items {
+			hooks[item.Url] = item.Hook
+		}
+		config = hooks
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	err = json.Unmarshal(content, &result)
+	return result, err
+}
+
+func getAlarmConfig(app *App) *AlarmConfig {
+	return &AlarmConfig{
+		EmailAlarmConf:   app.EmailAlarmConf,
+		DingAlarmConf:    app.DingAlarmConf,
+		HttpAlarmConf:    app.HttpAlarmConf,
+		ChannelAlarmConf: app.ChannelAlarmConf,
+	}
+}
@@ -20,11 +20,13 @@ import (
 	"rasp-cloud/tools"
 	"gopkg.in/mgo.v2"
 	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type Cookie struct {
-	Id   string    `json:"id" bson:"_id"`
-	Time time.Time `json:"time" bson:"time"`
+	Id     string    `json:"id" bson:"_id"`
+	UserId string    `json:"user_id" bson:"user_id"`
+	Time   time.Time `json:"time" bson:"time"`
 }
 
 const (
@@ -55,19 +57,23 @@ func init() {
 	}
 }
 
-func NewCookie(id string) error {
-	return mongo.Insert(cookieCollectionName, &Cookie{Id: id, Time: time.Now()})
+func NewCookie(id string, userId string) error {
+	return mongo.Insert(cookieCollectionName, &Cookie{Id: id, UserId: userId, Time: time.Now()})
 }
 
-func HasCookie(id string) (bool, error) {
-	var result *Cookie
-	err := mongo.FindId(cookieCollectionName, id, &result)
-	if err != nil || result == nil {
-		return false, err
+func GetUserByCookie(id string) (*User, error) {
+	var cookie *Cookie
+	err := mongo.FindId(cookieCollectionName, id, &cookie)
+	if err != nil {
+		return nil, err
 	}
-	return true, err
+	return GetUserById(cookie.UserId)
 }
 
 func RemoveCookie(id string) error {
 	return mongo.RemoveId(cookieCollectionName, id)
 }
+
+func RemoveCookieByUserId(userId string) error {
+	return mongo.RemoveAll(cookieCollectionName, bson.M{"user_id": userId})
+}
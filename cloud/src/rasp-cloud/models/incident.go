@@ -0,0 +1,448 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/olivere/elastic"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/environment"
+	"rasp-cloud/es"
+	"rasp-cloud/models/logs"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"strconv"
+	"time"
+)
+
+// Incident records the triage of the attack alarms with the same request_id or stack_md5,
+// an alarm belongs to the incident of its request_id if it exists, otherwise the incident of its stack_md5,
+// and the alarms without incident are regarded as open
+type Incident struct {
+	Id         string             `json:"id" bson:"_id"`
+	AppId      string             `json:"app_id" bson:"app_id"`
+	GroupBy    string             `json:"group_by" bson:"group_by"`
+	GroupKey   string             `json:"group_key" bson:"group_key"`
+	Status     string             `json:"status" bson:"status"`
+	Assignee   string             `json:"assignee" bson:"assignee"`
+	Comments   []*IncidentComment `json:"comments" bson:"comments"`
+	History    []*IncidentHistory `json:"history" bson:"history"`
+	CreateTime int64              `json:"create_time" bson:"create_time"`
+	UpdateTime int64              `json:"update_time" bson:"update_time"`
+	// whether the status has been copied to the incident_status field of the alarms in es
+	AlarmSynced bool `json:"-" bson:"alarm_synced"`
+}
+
+type IncidentComment struct {
+	User    string `json:"user" bson:"user"`
+	Content string `json:"content" bson:"content"`
+	Time    int64  `json:"time" bson:"time"`
+}
+
+type IncidentHistory struct {
+	User   string `json:"user" bson:"user"`
+	Action string `json:"action" bson:"action"`
+	From   string `json:"from" bson:"from"`
+	To     string `json:"to" bson:"to"`
+	Time   int64  `json:"time" bson:"time"`
+}
+
+const (
+	incidentCollectionName = "incident"
+
+	IncidentStatusOpen          = "open"
+	IncidentStatusAcknowledged  = "acknowledged"
+	IncidentStatusResolved      = "resolved"
+	IncidentStatusFalsePositive = "false_positive"
+
+	IncidentGroupByRequest = "request_id"
+	IncidentGroupByStack   = "stack_md5"
+
+	// the alarm stores the status of its incident of each group field in this field
+	alarmIncidentStatusField = "incident_status"
+	incidentSyncLeaseName    = "incident_alarm_sync"
+	incidentSyncInterval     = time.Minute
+	// the incidents updated recently are synced again for the alarms that are spooled during the update
+	incidentResyncWindow = time.Hour
+)
+
+var (
+	IncidentStatuses = []string{IncidentStatusOpen, IncidentStatusAcknowledged, IncidentStatusResolved,
+		IncidentStatusFalsePositive}
+	IncidentGroupFields = []string{IncidentGroupByRequest, IncidentGroupByStack}
+)
+
+func init() {
+	indexes := []*mgo.Index{
+		{
+			Key:        []string{"app_id", "status"},
+			Unique:     false,
+			Background: true,
+			Name:       "app_id_status",
+		},
+		{
+			Key:        []string{"app_id", "update_time"},
+			Unique:     false,
+			Background: true,
+			Name:       "app_id_update_time",
+		},
+	}
+	for _, index := range indexes {
+		err := mongo.CreateIndex(incidentCollectionName, index)
+		if err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed,
+				"failed to create "+index.Name+" index for incident collection", err)
+		}
+	}
+	if *environment.StartFlag.StartType == environment.StartTypeDefault ||
+		*environment.StartFlag.StartType == environment.StartTypeForeground {
+		go startIncidentSyncTicker()
+	}
+}
+
+// GetIncidentId returns the id of the incident, it is the same for the same group in the app
+func GetIncidentId(appId string, groupBy string, groupKey string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(appId+"\n"+groupBy+"\n"+groupKey)))
+}
+
+func handleIncident(incident *Incident) {
+	if incident.Comments == nil {
+		incident.Comments = make([]*IncidentComment, 0)
+	}
+	if incident.History == nil {
+		incident.History = make([]*IncidentHistory, 0)
+	}
+}
+
+// GetIncident returns the incident of the group, the incident that does not exist is returned as open
+func GetIncident(appId string, groupBy string, groupKey string) (incident *Incident, err error) {
+	id := GetIncidentId(appId, groupBy, groupKey)
+	err = mongo.FindId(incidentCollectionName, id, &incident)
+	if err == mgo.ErrNotFound {
+		return &Incident{
+			Id:       id,
+			AppId:    appId,
+			GroupBy:  groupBy,
+			GroupKey: groupKey,
+			Status:   IncidentStatusOpen,
+			Comments: make([]*IncidentComment, 0),
+			History:  make([]*IncidentHistory, 0),
+		}, nil
+	}
+	if err == nil {
+		handleIncident(incident)
+	}
+	return
+}
+
+func SearchIncidents(appId string, status string, assignee string, page int,
+	perpage int) (count int, result []*Incident, err error) {
+	query := bson.M{"app_id": appId}
+	if status != "" {
+		query["status"] = status
+	}
+	if assignee != "" {
+		query["assignee"] = assignee
+	}
+	count, err = mongo.FindAll(incidentCollectionName, query, &result, perpage*(page-1), perpage,
+		"-update_time")
+	if err == nil {
+		for _, incident := range result {
+			handleIncident(incident)
+		}
+	}
+	if result == nil {
+		result = make([]*Incident, 0)
+	}
+	return
+}
+
+// updateIncident creates the incident if it does not exist, and appends the history
+func updateIncident(appId string, groupBy string, groupKey string, set bson.M, history *IncidentHistory,
+	comment *IncidentComment) (*Incident, error) {
+	now := time.Now().UnixNano() / 1000000
+	id := GetIncidentId(appId, groupBy, groupKey)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["update_time"] = now
+	setOnInsert := bson.M{
+		"app_id":      appId,
+		"group_by":    groupBy,
+		"group_key":   groupKey,
+		"create_time": now,
+	}
+	// the alarms are synced again when the status changes or the incident is created
+	if _, ok := set["status"]; !ok {
+		setOnInsert["status"] = IncidentStatusOpen
+		setOnInsert["alarm_synced"] = false
+	} else {
+		set["alarm_synced"] = false
+	}
+	if _, ok := set["assignee"]; !ok {
+		setOnInsert["assignee"] = ""
+	}
+	push := bson.M{}
+	if history != nil {
+		history.Time = now
+		push["history"] = history
+	}
+	if comment != nil {
+		comment.Time = now
+		push["comments"] = comment
+	}
+	update := bson.M{"$set": set, "$setOnInsert": setOnInsert}
+	if len(push) > 0 {
+		update["$push"] = push
+	}
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	var incident *Incident
+	_, err := newSession.DB(mongo.DbName).C(incidentCollectionName).FindId(id).Apply(mgo.Change{
+		Update:    update,
+		Upsert:    true,
+		ReturnNew: true,
+	}, &incident)
+	if err != nil {
+		return nil, err
+	}
+	handleIncident(incident)
+	if !incident.AlarmSynced {
+		// the incident is synced again by the ticker if it fails here
+		if err = syncIncidentAlarms(incident); err != nil {
+			beego.Error("failed to sync the status of incident " + incident.Id + " to alarms: " + err.Error())
+		}
+	}
+	return incident, nil
+}
+
+// UpdateIncidentStatus changes the status of the incident, the optional comment is added in the same update
+func UpdateIncidentStatus(appId string, groupBy string, groupKey string, status string, content string,
+	user string) (*Incident, error) {
+	incident, err := GetIncident(appId, groupBy, groupKey)
+	if err != nil {
+		return nil, err
+	}
+	var comment *IncidentComment
+	if content != "" {
+		comment = &IncidentComment{User: user, Content: content}
+	}
+	return updateIncident(appId, groupBy, groupKey, bson.M{"status": status},
+		&IncidentHistory{User: user, Action: "status", From: incident.Status, To: status}, comment)
+}
+
+func UpdateIncidentAssignee(appId string, groupBy string, groupKey string, assignee string,
+	user string) (*Incident, error) {
+	incident, err := GetIncident(appId, groupBy, groupKey)
+	if err != nil {
+		return nil, err
+	}
+	return updateIncident(appId, groupBy, groupKey, bson.M{"assignee": assignee},
+		&IncidentHistory{User: user, Action: "assign", From: incident.Assignee, To: assignee}, nil)
+}
+
+func AddIncidentComment(appId string, groupBy string, groupKey string, content string,
+	user string) (*Incident, error) {
+	return updateIncident(appId, groupBy, groupKey, nil,
+		&IncidentHistory{User: user, Action: "comment"}, &IncidentComment{User: user, Content: content})
+}
+
+func RemoveIncidentByAppId(appId string) error {
+	return mongo.RemoveAll(incidentCollectionName, bson.M{"app_id": appId})
+}
+
+// GetIncidentQuery returns the es query of the attack alarms in the status, it follows the same rule as
+// SetAlarmIncidents: the incident of request_id is preferred, and the alarm without incident is open
+func GetIncidentQuery(status string) elastic.Query {
+	requestField := alarmIncidentStatusField + "." + IncidentGroupByRequest
+	stackField := alarmIncidentStatusField + "." + IncidentGroupByStack
+	queries := []elastic.Query{
+		elastic.NewTermQuery(requestField, status),
+		elastic.NewBoolQuery().
+			MustNot(elastic.NewExistsQuery(requestField)).
+			Filter(elastic.NewTermQuery(stackField, status)),
+	}
+	if status == IncidentStatusOpen {
+		queries = append(queries, elastic.NewBoolQuery().
+			MustNot(elastic.NewExistsQuery(requestField), elastic.NewExistsQuery(stackField)))
+	}
+	return elastic.NewBoolQuery().Should(queries...).MinimumNumberShouldMatch(1)
+}
+
+// SetAlarmIncidentStatus sets the incident_status field of the new attack alarms before they are stored,
+// it has the status of the incident of each group field
+func SetAlarmIncidentStatus(alarms []map[string]interface{}) error {
+	incidentMap, err := getAlarmIncidents(alarms, bson.M{"status": 1})
+	if err != nil {
+		return err
+	}
+	for _, alarm := range alarms {
+		appId := fmt.Sprint(alarm["app_id"])
+		status := make(map[string]interface{})
+		for _, groupBy := range IncidentGroupFields {
+			if groupKey, ok := alarm[groupBy].(string); ok && groupKey != "" {
+				if incident, ok := incidentMap[GetIncidentId(appId, groupBy, groupKey)]; ok {
+					status[groupBy] = incident.Status
+				}
+			}
+		}
+		if len(status) > 0 {
+			alarm[alarmIncidentStatusField] = status
+		} else {
+			delete(alarm, alarmIncidentStatusField)
+		}
+	}
+	return nil
+}
+
+func getAlarmIncidents(alarms []map[string]interface{}, selector bson.M) (map[string]*Incident, error) {
+	ids := make([]string, 0, len(alarms)*2)
+	for _, alarm := range alarms {
+		appId := fmt.Sprint(alarm["app_id"])
+		for _, groupBy := range IncidentGroupFields {
+			if groupKey, ok := alarm[groupBy].(string); ok && groupKey != "" {
+				ids = append(ids, GetIncidentId(appId, groupBy, groupKey))
+			}
+		}
+	}
+	incidentMap := make(map[string]*Incident)
+	if len(ids) == 0 {
+		return incidentMap, nil
+	}
+	var incidents []*Incident
+	_, err := mongo.FindAllWithSelect(incidentCollectionName, bson.M{"_id": bson.M{"$in": ids}}, &incidents,
+		selector, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, incident := range incidents {
+		incidentMap[incident.Id] = incident
+	}
+	return incidentMap, nil
+}
+
+// syncIncidentAlarms copies the status of the incident to the alarms of its group
+func syncIncidentAlarms(incident *Incident) error {
+	statusField := alarmIncidentStatusField + "." + incident.GroupBy
+	script := elastic.NewScriptInline("if (ctx._source." + alarmIncidentStatusField + " == null) {" +
+		"ctx._source." + alarmIncidentStatusField + " = [:]} " +
+		"ctx._source." + alarmIncidentStatusField + "[params.group_by] = params.status").
+		Lang("painless").
+		Param("group_by", incident.GroupBy).
+		Param("status", incident.Status)
+	query := elastic.NewBoolQuery().
+		Filter(elastic.NewTermQuery(incident.GroupBy, incident.GroupKey)).
+		MustNot(elastic.NewTermQuery(statusField, incident.Status))
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	result, err := es.ElasticClient.UpdateByQuery(logs.AliasAttackIndexName + "-" + incident.AppId).
+		Query(query).Script(script).Conflicts("proceed").Refresh("true").Do(ctx)
+	if err != nil {
+		return err
+	}
+	if result.VersionConflicts > 0 {
+		return errors.New(strconv.FormatInt(result.VersionConflicts, 10) + " alarms are updated concurrently")
+	}
+	// the incident updated during the sync is synced again
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	err = newSession.DB(mongo.DbName).C(incidentCollectionName).Update(
+		bson.M{"_id": incident.Id, "update_time": incident.UpdateTime},
+		bson.M{"$set": bson.M{"alarm_synced": true}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func startIncidentSyncTicker() {
+	ticker := time.NewTicker(incidentSyncInterval)
+	for {
+		select {
+		case <-ticker.C:
+			isLeader, err := AcquireLease(incidentSyncLeaseName, 3*incidentSyncInterval)
+			if err != nil {
+				beego.Error("failed to acquire the incident sync lease: " + err.Error())
+				continue
+			}
+			if isLeader {
+				syncIncidents()
+			}
+		}
+	}
+}
+
+// syncIncidents syncs the incidents that failed to sync or are updated recently,
+// the incidents created before the incident_status field of alarms are synced as well
+func syncIncidents() {
+	defer func() {
+		if r := recover(); r != nil {
+			beego.Error("failed to sync incidents: ", r)
+		}
+	}()
+	since := time.Now().Add(-incidentResyncWindow).UnixNano() / 1000000
+	var incidents []*Incident
+	_, err := mongo.FindAll(incidentCollectionName, bson.M{"$or": []bson.M{
+		{"alarm_synced": bson.M{"$ne": true}},
+		{"update_time": bson.M{"$gt": since}},
+	}}, &incidents, 0, 0)
+	if err != nil {
+		beego.Error("failed to get the incidents to be synced: " + err.Error())
+		return
+	}
+	for _, incident := range incidents {
+		if err = syncIncidentAlarms(incident); err != nil {
+			beego.Error("failed to sync the status of incident " + incident.Id + " to alarms: " + err.Error())
+		}
+	}
+}
+
+// SetAlarmIncidents sets the incident of the attack alarms, the incident of request_id is preferred
+func SetAlarmIncidents(alarms []map[string]interface{}) error {
+	if len(alarms) == 0 {
+		return nil
+	}
+	incidentMap, err := getAlarmIncidents(alarms, bson.M{"status": 1, "assignee": 1, "group_by": 1})
+	if err != nil {
+		return err
+	}
+	for _, alarm := range alarms {
+		appId := fmt.Sprint(alarm["app_id"])
+		result := map[string]interface{}{"status": IncidentStatusOpen}
+		for _, groupBy := range IncidentGroupFields {
+			groupKey, ok := alarm[groupBy].(string)
+			if !ok || groupKey == "" {
+				continue
+			}
+			if incident, ok := incidentMap[GetIncidentId(appId, groupBy, groupKey)]; ok {
+				result = map[string]interface{}{
+					"id":       incident.Id,
+					"group_by": groupBy,
+					"status":   incident.Status,
+					"assignee": incident.Assignee,
+				}
+				break
+			}
+		}
+		alarm["incident"] = result
+		delete(alarm, alarmIncidentStatusField)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/astaxie/beego"
+	"io/ioutil"
+	"rasp-cloud/tools"
+	"rasp-cloud/tools/ldap"
+	"strings"
+	"time"
+)
+
+const (
+	ldapUserNamePlaceholder = "{username}"
+	ldapUserDnPlaceholder   = "{dn}"
+	ldapTimeout             = 10 * time.Second
+)
+
+var (
+	ldapEnable        bool
+	ldapFallbackLocal bool
+	ldapUrl           string
+	ldapStartTls      bool
+	ldapTlsConfig     *tls.Config
+	ldapBindDn        string
+	ldapSearchBase    string
+	ldapUserFilter    string
+	ldapDefaultRole   string
+	// the filters of roles in descending order of the role level
+	ldapRoleFilters []ldapRoleFilter
+)
+
+type ldapRoleFilter struct {
+	role   string
+	filter string
+}
+
+func init() {
+	ldapEnable = beego.AppConfig.DefaultBool("LdapEnable", false)
+	if !ldapEnable {
+		return
+	}
+	ldapFallbackLocal = beego.AppConfig.DefaultBool("LdapFallbackLocal", false)
+	ldapUrl = beego.AppConfig.String("LdapUrl")
+	ldapStartTls = beego.AppConfig.DefaultBool("LdapStartTls", false)
+	ldapBindDn = beego.AppConfig.String("LdapBindDn")
+	ldapSearchBase = beego.AppConfig.String("LdapSearchBase")
+	ldapUserFilter = beego.AppConfig.DefaultString("LdapUserFilter", "(uid={username})")
+	ldapDefaultRole = beego.AppConfig.String("LdapDefaultRole")
+	if ldapUrl == "" || !strings.Contains(ldapBindDn, ldapUserNamePlaceholder) {
+		tools.Panic(tools.ErrCodeConfigInitFailed,
+			"the 'LdapUrl' config can not be empty and the 'LdapBindDn' config must contain {username}", nil)
+	}
+	if ldapDefaultRole != "" && !IsValidRole(ldapDefaultRole) {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "unknown role of the 'LdapDefaultRole' config: "+ldapDefaultRole, nil)
+	}
+	for _, item := range []struct {
+		key  string
+		role string
+	}{{"LdapAdminFilter", RoleAdmin}, {"LdapOperatorFilter", RoleOperator}} {
+		if filter := beego.AppConfig.String(item.key); filter != "" {
+			if ldapSearchBase == "" {
+				tools.Panic(tools.ErrCodeConfigInitFailed,
+					"the 'LdapSearchBase' config is required by the '"+item.key+"' config", nil)
+			}
+			ldapRoleFilters = append(ldapRoleFilters, ldapRoleFilter{role: item.role, filter: filter})
+		}
+	}
+	var err error
+	ldapTlsConfig, err = newLdapTlsConfig()
+	if err != nil {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "failed to init the tls config of ldap", err)
+	}
+}
+
+func newLdapTlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: beego.AppConfig.DefaultBool("LdapTlsSkipVerify", false),
+	}
+	if caFile := beego.AppConfig.String("LdapTlsCa"); caFile != "" {
+		content, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.New("failed to parse the certificates in " + caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// verifyLdapUser binds as the user, the role of user is the first role whose filter matches an entry
+// in the search base, or the default role if no filter matches
+func verifyLdapUser(userName string, pwd string) (*User, error) {
+	if !userNameRegex.MatchString(userName) {
+		return nil, errors.New("invalid user name: " + userName)
+	}
+	conn, err := ldap.Dial(ldapUrl, ldapTlsConfig, ldapTimeout)
+	if err != nil {
+		return nil, errors.New("failed to connect to the ldap server: " + err.Error())
+	}
+	defer conn.Close()
+	if ldapStartTls {
+		if err = conn.StartTLS(ldapTlsConfig); err != nil {
+			return nil, errors.New("failed to start tls with the ldap server: " + err.Error())
+		}
+	}
+	dn := strings.Replace(ldapBindDn, ldapUserNamePlaceholder, ldap.EscapeDN(userName), -1)
+	if err = conn.Bind(dn, pwd); err != nil {
+		return nil, errors.New("failed to bind the ldap user " + dn + ": " + err.Error())
+	}
+	role := ldapDefaultRole
+	if ldapSearchBase != "" {
+		// the bind dn may be an alias such as the user principal name of active directory
+		entries, err := searchLdap(conn, ldapUserFilter, userName, dn)
+		if err != nil {
+			return nil, errors.New("failed to search the ldap user " + userName + ": " + err.Error())
+		}
+		if len(entries) != 1 {
+			return nil, errors.New("the ldap user " + userName + " is not found in " + ldapSearchBase)
+		}
+		dn = entries[0].DN
+		for _, item := range ldapRoleFilters {
+			entries, err = searchLdap(conn, item.filter, userName, dn)
+			if err != nil {
+				return nil, errors.New("failed to search the " + item.role + " role of ldap user: " + err.Error())
+			}
+			if len(entries) > 0 {
+				role = item.role
+				break
+			}
+		}
+	}
+	return syncExternalUser(UserSourceLdap, strings.ToLower(dn), userName, role)
+}
+
+func searchLdap(conn *ldap.Conn, filter string, userName string, dn string) ([]*ldap.Entry, error) {
+	filter = strings.NewReplacer(ldapUserNamePlaceholder, ldap.EscapeFilter(userName),
+		ldapUserDnPlaceholder, ldap.EscapeFilter(dn)).Replace(filter)
+	return conn.Search(&ldap.SearchRequest{
+		BaseDn: ldapSearchBase,
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: filter,
+		// no attribute is required
+		Attributes: []string{"1.1"},
+		SizeLimit:  2,
+	})
+}
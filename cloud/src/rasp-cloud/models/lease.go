@@ -0,0 +1,78 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"rasp-cloud/mongo"
+	"time"
+)
+
+// Lease makes sure that only one panel instance does the job named by the lease at the same time
+type Lease struct {
+	Name       string `json:"name" bson:"_id"`
+	Owner      string `json:"owner" bson:"owner"`
+	ExpireTime int64  `json:"expire_time" bson:"expire_time"`
+}
+
+const (
+	leaseCollectionName = "lease"
+)
+
+var (
+	// InstanceId identifies the current panel instance
+	InstanceId string
+)
+
+func init() {
+	hostName, err := os.Hostname()
+	if err != nil {
+		hostName = "unknown"
+	}
+	InstanceId = fmt.Sprintf("%s-%d-%s", hostName, os.Getpid(), mongo.GenerateObjectId())
+}
+
+// AcquireLease acquires or renews the lease for the ttl, it returns false if the lease is held by another instance
+func AcquireLease(name string, ttl time.Duration) (bool, error) {
+	now := time.Now().UnixNano() / 1000000
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	var lease Lease
+	_, err := newSession.DB(mongo.DbName).C(leaseCollectionName).Find(bson.M{
+		"_id": name,
+		"$or": []bson.M{
+			{"owner": InstanceId},
+			{"expire_time": bson.M{"$lt": now}},
+		},
+	}).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{
+			"owner":       InstanceId,
+			"expire_time": now + int64(ttl/time.Millisecond),
+		}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &lease)
+	if err != nil {
+		// the lease exists but does not match the query, so the upsert conflicts with it
+		if mgo.IsDup(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return lease.Owner == InstanceId, nil
+}
@@ -0,0 +1,182 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net"
+	"net/http"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"rasp-cloud/tools/realip"
+	"strings"
+	"time"
+)
+
+// LoginAttempt is the failed logins of a client ip or a user name,
+// it is removed after no failure happens in the 'LoginFailureWindow' config
+type LoginAttempt struct {
+	Id          string    `json:"id" bson:"_id"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LastTime    time.Time `json:"last_time" bson:"last_time"`
+	LockedUntil time.Time `json:"locked_until" bson:"locked_until"`
+}
+
+const (
+	loginAttemptCollectionName = "login_attempt"
+	loginAttemptIpPrefix       = "ip:"
+	loginAttemptUserPrefix     = "user:"
+	// the delay after the first failure, it is doubled after each failure
+	loginBaseDelay = time.Second
+)
+
+var (
+	loginMaxUserFailures int
+	loginMaxIpFailures   int
+	loginLockoutTime     time.Duration
+	// the X-Forwarded-For header is only trusted for the requests from these proxies
+	trustedProxies []*net.IPNet
+)
+
+func init() {
+	loginMaxUserFailures = beego.AppConfig.DefaultInt("LoginMaxFailures", 5)
+	loginMaxIpFailures = beego.AppConfig.DefaultInt("LoginMaxIpFailures", 20)
+	loginLockoutTime = time.Duration(beego.AppConfig.DefaultInt("LoginLockoutTime", 15)) * time.Minute
+	if loginMaxUserFailures <= 0 || loginMaxIpFailures <= 0 || loginLockoutTime <= 0 {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "the 'LoginMaxFailures', 'LoginMaxIpFailures' and "+
+			"'LoginLockoutTime' configs must be greater than 0", nil)
+	}
+	// the attempt is removed after the window, so the window must cover the lockout
+	window := time.Duration(beego.AppConfig.DefaultInt("LoginFailureWindow", 60)) * time.Minute
+	if window < loginLockoutTime {
+		tools.Panic(tools.ErrCodeConfigInitFailed,
+			"the 'LoginFailureWindow' config must not be less than the 'LoginLockoutTime' config", nil)
+	}
+	var err error
+	trustedProxies, err = realip.ParseTrustedProxies(beego.AppConfig.DefaultString("TrustedProxies", ""))
+	if err != nil {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "failed to parse the 'TrustedProxies' config", err)
+	}
+	count, err := mongo.Count(loginAttemptCollectionName)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get login_attempt collection count", err)
+	}
+	if count <= 0 {
+		index := &mgo.Index{
+			Key:         []string{"last_time"},
+			Background:  true,
+			Name:        "last_time",
+			ExpireAfter: window,
+		}
+		err = mongo.CreateIndex(loginAttemptCollectionName, index)
+		if err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create index for login_attempt collection", err)
+		}
+	}
+}
+
+// GetLoginWaitTime returns the time to wait before the next login of the ip and the user name
+func GetLoginWaitTime(ip string, userName string) (time.Duration, error) {
+	var attempts []*LoginAttempt
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	err := newSession.DB(mongo.DbName).C(loginAttemptCollectionName).Find(
+		bson.M{"_id": bson.M{"$in": loginAttemptIds(ip, userName)}}).All(&attempts)
+	if err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, attempt := range attempts {
+		if remaining := time.Until(attempt.LockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// AddLoginFailure counts the failure of the ip and the user name, the next login is delayed exponentially
+// and locked for the 'LoginLockoutTime' config after the max failures, it returns the attempts locked by this failure,
+// such as ip:127.0.0.1 or user:openrasp
+func AddLoginFailure(ip string, userName string) (locked []string, err error) {
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	collection := newSession.DB(mongo.DbName).C(loginAttemptCollectionName)
+	now := time.Now()
+	for _, id := range loginAttemptIds(ip, userName) {
+		var attempt LoginAttempt
+		_, err = collection.FindId(id).Apply(mgo.Change{
+			Update:    bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"last_time": now}},
+			Upsert:    true,
+			ReturnNew: true,
+		}, &attempt)
+		if err != nil {
+			return
+		}
+		maxFailures := loginMaxUserFailures
+		if strings.HasPrefix(id, loginAttemptIpPrefix) {
+			maxFailures = loginMaxIpFailures
+		}
+		if attempt.Failures == maxFailures {
+			locked = append(locked, id)
+		}
+		err = collection.UpdateId(id, bson.M{"$set": bson.M{
+			"locked_until": now.Add(loginDelay(attempt.Failures, maxFailures))}})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ClearLoginFailure resets the failures of the user name after a successful login,
+// the failures of the ip are kept so that a valid account does not unlock the guesses of others
+func ClearLoginFailure(userName string) error {
+	err := mongo.RemoveId(loginAttemptCollectionName, loginAttemptUserPrefix+strings.ToLower(userName))
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// GetClientIp returns the ip of the request, the X-Forwarded-For header is ignored
+// unless the request comes from the proxies of the 'TrustedProxies' config
+func GetClientIp(request *http.Request) string {
+	return realip.ClientIp(request.RemoteAddr, request.Header.Get("X-Forwarded-For"), trustedProxies)
+}
+
+func GetLoginLockoutTime() time.Duration {
+	return loginLockoutTime
+}
+
+func loginAttemptIds(ip string, userName string) []string {
+	return []string{loginAttemptIpPrefix + ip, loginAttemptUserPrefix + strings.ToLower(userName)}
+}
+
+// loginDelay is 1s, 2s, 4s... after each failure, and the lockout time after the max failures
+func loginDelay(failures int, maxFailures int) time.Duration {
+	if failures >= maxFailures {
+		return loginLockoutTime
+	}
+	delay := loginBaseDelay
+	for i := 1; i < failures && delay < loginLockoutTime; i++ {
+		delay *= 2
+	}
+	if delay > loginLockoutTime {
+		return loginLockoutTime
+	}
+	return delay
+}
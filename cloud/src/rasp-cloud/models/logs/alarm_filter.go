@@ -0,0 +1,186 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/olivere/elastic"
+	"rasp-cloud/es"
+	"strings"
+	"time"
+)
+
+// AttackFilter filters the attack alarms, the empty fields are ignored
+type AttackFilter struct {
+	AttackTypes     []string
+	InterceptStates []string
+	MinConfidence   int
+	// wildcard patterns, '*' matches any sequence and '?' matches any single character
+	ServerHostname string
+	Url            string
+	AttackSources  []string
+}
+
+func (filter *AttackFilter) query(startTime int64, endTime int64) *elastic.BoolQuery {
+	filterQueries := []elastic.Query{elastic.NewRangeQuery("event_time").Gte(startTime).Lte(endTime)}
+	if len(filter.AttackTypes) > 0 {
+		filterQueries = append(filterQueries, elastic.NewTermsQuery("attack_type", toInterfaces(filter.AttackTypes)...))
+	}
+	if len(filter.InterceptStates) > 0 {
+		filterQueries = append(filterQueries,
+			elastic.NewTermsQuery("intercept_state", toInterfaces(filter.InterceptStates)...))
+	}
+	if len(filter.AttackSources) > 0 {
+		filterQueries = append(filterQueries,
+			elastic.NewTermsQuery("attack_source", toInterfaces(filter.AttackSources)...))
+	}
+	if filter.MinConfidence > 0 {
+		filterQueries = append(filterQueries, elastic.NewRangeQuery("plugin_confidence").Gte(filter.MinConfidence))
+	}
+	// the hostname and url fields are lowercase normalized, but the wildcard query is not
+	if filter.ServerHostname != "" {
+		filterQueries = append(filterQueries,
+			elastic.NewWildcardQuery("server_hostname", strings.ToLower(filter.ServerHostname)))
+	}
+	if filter.Url != "" {
+		filterQueries = append(filterQueries, elastic.NewWildcardQuery("url", strings.ToLower(filter.Url)))
+	}
+	return elastic.NewBoolQuery().Filter(filterQueries...)
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+func SearchAttackWithFilter(startTime int64, endTime int64, filter *AttackFilter, size int,
+	appId string) (int64, []map[string]interface{}, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Second))
+	defer cancel()
+	queryResult, err := es.ElasticClient.Search(AliasAttackIndexName+"-"+appId).
+		Query(filter.query(startTime, endTime)).
+		Sort("event_time", false).
+		Size(size).
+		Do(ctx)
+	if err != nil {
+		if queryResult != nil && queryResult.Error != nil {
+			errMsg, err := json.Marshal(queryResult.Error)
+			if err != nil {
+				beego.Error(string(errMsg))
+			}
+		}
+		return 0, nil, err
+	}
+	var total int64
+	result := make([]map[string]interface{}, 0)
+	if queryResult != nil && queryResult.Hits != nil && queryResult.Hits.Hits != nil {
+		total = queryResult.Hits.TotalHits
+		for _, item := range queryResult.Hits.Hits {
+			alarm := make(map[string]interface{})
+			if err := json.Unmarshal(*item.Source, &alarm); err != nil {
+				return 0, nil, err
+			}
+			alarm["id"] = item.Id
+			result = append(result, alarm)
+		}
+	}
+	return total, result, nil
+}
+
+// AggregationAttackWithSource returns the attack sources which have at least minCount alarms matching the filter
+func AggregationAttackWithSource(startTime int64, endTime int64, filter *AttackFilter, minCount int64, size int,
+	appId string) ([][]interface{}, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Second))
+	defer cancel()
+	sourceAggr := elastic.NewTermsAggregation().Field("attack_source").
+		MinDocCount(int(minCount)).Size(size).OrderByCount(false)
+	aggrName := "aggr_source"
+	aggrResult, err := es.ElasticClient.Search(AliasAttackIndexName+"-"+appId).
+		Query(filter.query(startTime, endTime)).
+		Aggregation(aggrName, sourceAggr).
+		Size(0).
+		Do(ctx)
+	if err != nil {
+		if aggrResult != nil && aggrResult.Error != nil {
+			errMsg, err := json.Marshal(aggrResult.Error)
+			if err != nil {
+				beego.Error(string(errMsg))
+			}
+		}
+		return nil, err
+	}
+	result := make([][]interface{}, 0)
+	if aggrResult != nil && aggrResult.Aggregations != nil {
+		if terms, ok := aggrResult.Aggregations.Terms(aggrName); ok && terms.Buckets != nil {
+			for _, item := range terms.Buckets {
+				result = append(result, []interface{}{item.Key, item.DocCount})
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetAttackAlarmById returns the attack alarm of the app, the result is nil if it does not exist
+func GetAttackAlarmById(appId string, id string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Second))
+	defer cancel()
+	queryResult, err := es.ElasticClient.Search(AliasAttackIndexName + "-" + appId).
+		Query(elastic.NewIdsQuery().Ids(id)).
+		Size(1).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if queryResult == nil || queryResult.Hits == nil || len(queryResult.Hits.Hits) == 0 {
+		return nil, nil
+	}
+	item := queryResult.Hits.Hits[0]
+	alarm := make(map[string]interface{})
+	if err := json.Unmarshal(*item.Source, &alarm); err != nil {
+		return nil, err
+	}
+	alarm["id"] = item.Id
+	return alarm, nil
+}
+
+// AggregationAttackWithRaspId returns the count of attack alarms of every agent of the app
+func AggregationAttackWithRaspId(startTime int64, endTime int64, appId string) (map[string]int64, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Second))
+	defer cancel()
+	aggrName := "aggr_rasp"
+	aggrResult, err := es.ElasticClient.Search(AliasAttackIndexName+"-"+appId).
+		Query(elastic.NewRangeQuery("event_time").Gte(startTime).Lte(endTime)).
+		Aggregation(aggrName, elastic.NewTermsAggregation().Field("rasp_id").Size(10000)).
+		Size(0).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int64)
+	if aggrResult != nil && aggrResult.Aggregations != nil {
+		if terms, ok := aggrResult.Aggregations.Terms(aggrName); ok && terms.Buckets != nil {
+			for _, item := range terms.Buckets {
+				result[fmt.Sprint(item.Key)] = item.DocCount
+			}
+		}
+	}
+	return result, nil
+}
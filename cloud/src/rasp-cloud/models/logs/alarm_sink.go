@@ -0,0 +1,276 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package logs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/astaxie/beego"
+	"io/ioutil"
+	"rasp-cloud/environment"
+	"rasp-cloud/models/logs/format"
+	"rasp-cloud/tools"
+	"rasp-cloud/tools/kafka"
+	"rasp-cloud/tools/syslog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// bufferedSink pushes the alarms with its own buffer and goroutine,
+// so the slow or unavailable remote sink does not block the other sinks
+type bufferedSink struct {
+	name    string
+	buffer  chan *sinkAlarm
+	write   func(alarmType string, alarms []map[string]interface{}) error
+	dropped int64
+}
+
+type sinkAlarm struct {
+	alarmType string
+	alarm     map[string]interface{}
+}
+
+const (
+	sinkBatchSize = 200
+)
+
+var (
+	// alarmSinks holds the functions of the sinks in AlarmLogMode
+	alarmSinks []func(string, map[string]interface{}) error
+)
+
+func initAlarmSinks(alarmLogMode string, alarmBufferSize int) {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(alarmLogMode, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if names[name] {
+			tools.Panic(tools.ErrCodeConfigInitFailed, "duplicate alarm sink in AlarmLogMode config: "+name, nil)
+		}
+		names[name] = true
+		switch name {
+		case "file":
+			alarmFileFormatter = newSinkFormatter("File")
+			initRaspLoggers()
+			alarmSinks = append(alarmSinks, AddLogWithFile)
+		case "es":
+			initAlarmSpools()
+			startEsAlarmLogPush()
+			alarmSinks = append(alarmSinks, AddLogWithES)
+		case "kafka":
+			write, err := newKafkaSinkWriter()
+			if err != nil {
+				tools.Panic(tools.ErrCodeConfigInitFailed, "failed to init kafka alarm sink", err)
+			}
+			alarmSinks = append(alarmSinks, newBufferedSink(name, alarmBufferSize, write).add)
+		case "syslog":
+			write, err := newSyslogSinkWriter()
+			if err != nil {
+				tools.Panic(tools.ErrCodeConfigInitFailed, "failed to init syslog alarm sink", err)
+			}
+			alarmSinks = append(alarmSinks, newBufferedSink(name, alarmBufferSize, write).add)
+		default:
+			tools.Panic(tools.ErrCodeConfigInitFailed, "Unrecognized the value of AlarmLogMode config: "+name, nil)
+		}
+	}
+	if len(alarmSinks) == 0 {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "the AlarmLogMode config can not be empty", nil)
+	}
+	if len(alarmSinks) == 1 {
+		AddAlarmFunc = alarmSinks[0]
+	} else {
+		AddAlarmFunc = addLogWithSinks
+	}
+}
+
+// addLogWithSinks passes the alarm to all sinks, the error of one sink does not stop the others
+func addLogWithSinks(alarmType string, alarm map[string]interface{}) (err error) {
+	for _, add := range alarmSinks {
+		if sinkErr := add(alarmType, alarm); sinkErr != nil {
+			err = sinkErr
+		}
+	}
+	return
+}
+
+func newBufferedSink(name string, size int,
+	write func(alarmType string, alarms []map[string]interface{}) error) *bufferedSink {
+	sink := &bufferedSink{
+		name:   name,
+		buffer: make(chan *sinkAlarm, size),
+		write:  write,
+	}
+	go func() {
+		for {
+			sink.push()
+		}
+	}()
+	return sink
+}
+
+func (sink *bufferedSink) add(alarmType string, alarm map[string]interface{}) error {
+	select {
+	case sink.buffer <- &sinkAlarm{alarmType: alarmType, alarm: alarm}:
+		return nil
+	default:
+		dropped := atomic.AddInt64(&sink.dropped, 1)
+		// avoid flooding the log when the sink is down
+		if dropped%100 == 1 {
+			beego.Error("the buffer of " + sink.name + " alarm sink is full, " +
+				strconv.FormatInt(dropped, 10) + " alarms are dropped in total")
+		}
+		return errors.New("the buffer of " + sink.name + " alarm sink is full")
+	}
+}
+
+func (sink *bufferedSink) push() {
+	defer func() {
+		if r := recover(); r != nil {
+			beego.Error("failed to push alarms to "+sink.name+": ", r)
+		}
+	}()
+	item := <-sink.buffer
+	batches := map[string][]map[string]interface{}{item.alarmType: {item.alarm}}
+	for count := 1; len(sink.buffer) > 0 && count < sinkBatchSize; count++ {
+		item := <-sink.buffer
+		batches[item.alarmType] = append(batches[item.alarmType], item.alarm)
+	}
+	for alarmType, alarms := range batches {
+		if err := sink.write(alarmType, alarms); err != nil {
+			atomic.AddInt64(&sink.dropped, int64(len(alarms)))
+			beego.Error("failed to push " + strconv.Itoa(len(alarms)) + " " + alarmType + " to " +
+				sink.name + ", the alarms are dropped: " + err.Error())
+		}
+	}
+}
+
+// newSinkFormatter returns the formatter in the config like KafkaFormat, the format is json, cef or leef
+func newSinkFormatter(prefix string) format.Formatter {
+	formatter, err := format.New(beego.AppConfig.DefaultString(prefix+"Format", format.FormatJson),
+		environment.Version)
+	if err != nil {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "failed to init the format of alarm sink", err)
+	}
+	return formatter
+}
+
+func newSinkTlsConfig(prefix string) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: beego.AppConfig.DefaultBool(prefix+"TlsSkipVerify", false),
+	}
+	if caFile := beego.AppConfig.String(prefix + "TlsCa"); caFile != "" {
+		content, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.New("failed to parse the certificates in " + caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func newKafkaSinkWriter() (func(string, []map[string]interface{}) error, error) {
+	var brokers []string
+	for _, broker := range strings.Split(beego.AppConfig.String("KafkaBrokers"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	config := kafka.Config{
+		Brokers:      brokers,
+		RequiredAcks: int16(beego.AppConfig.DefaultInt("KafkaRequiredAcks", 1)),
+		MaxRetries:   2,
+	}
+	if beego.AppConfig.DefaultBool("KafkaTls", false) {
+		tlsConfig, err := newSinkTlsConfig("Kafka")
+		if err != nil {
+			return nil, err
+		}
+		config.TLSConfig = tlsConfig
+	}
+	formatter := newSinkFormatter("Kafka")
+	producer, err := kafka.NewProducer(config)
+	if err != nil {
+		return nil, err
+	}
+	topics := map[string]string{
+		AttackAlarmType: beego.AppConfig.DefaultString("KafkaAttackTopic", "openrasp-attack-alarm"),
+		PolicyAlarmType: beego.AppConfig.DefaultString("KafkaPolicyTopic", "openrasp-policy-alarm"),
+	}
+	return func(alarmType string, alarms []map[string]interface{}) error {
+		topic, ok := topics[alarmType]
+		if !ok {
+			return errors.New("unrecognized alarm type: " + alarmType)
+		}
+		msgs := make([]*kafka.Message, 0, len(alarms))
+		for _, alarm := range alarms {
+			content, err := formatter(alarmType, alarm)
+			if err != nil {
+				beego.Error("failed to format " + alarmType + " for kafka: " + err.Error())
+				continue
+			}
+			// the alarms of the same app keep the order in a partition
+			msgs = append(msgs, &kafka.Message{Key: []byte(fmt.Sprint(alarm["app_id"])), Value: content})
+		}
+		return producer.Send(topic, msgs...)
+	}, nil
+}
+
+func newSyslogSinkWriter() (func(string, []map[string]interface{}) error, error) {
+	syslogUrl := beego.AppConfig.DefaultString("SyslogUrl", "udp://127.0.0.1:514")
+	var tlsConfig *tls.Config
+	if strings.HasPrefix(syslogUrl, "tls://") {
+		var err error
+		if tlsConfig, err = newSinkTlsConfig("Syslog"); err != nil {
+			return nil, err
+		}
+	}
+	formatter := newSinkFormatter("Syslog")
+	writer, err := syslog.NewWriter(syslogUrl, tlsConfig, beego.AppConfig.DefaultInt("SyslogFacility", 16),
+		beego.AppConfig.DefaultString("appname", "rasp-cloud"))
+	if err != nil {
+		return nil, err
+	}
+	return func(alarmType string, alarms []map[string]interface{}) error {
+		severity := syslog.SeverityWarning
+		if alarmType == PolicyAlarmType {
+			severity = syslog.SeverityNotice
+		}
+		msgs := make([][]byte, 0, len(alarms))
+		for _, alarm := range alarms {
+			content, err := formatter(alarmType, alarm)
+			if err != nil {
+				beego.Error("failed to format " + alarmType + " for syslog: " + err.Error())
+				continue
+			}
+			msgs = append(msgs, content)
+		}
+		err := writer.Write(severity, alarmType, msgs...)
+		if err != nil {
+			// give the server a moment before the next batch
+			time.Sleep(time.Second)
+		}
+		return err
+	}, nil
+}
@@ -180,6 +180,17 @@ var (
 					"plugin_message": {
 						"type": "keyword"
 					},
+					"incident_status": {
+						"type": "object",
+						"properties": {
+							"request_id": {
+								"type": "keyword"
+							},
+							"stack_md5": {
+								"type": "keyword"
+							}
+						}
+					},
 					"server_nic": {
 						"type": "nested",
 						"properties": {
@@ -220,14 +231,19 @@ func AddAttackAlarm(alarm map[string]interface{}) error {
 			beego.Error("failed to add attack alarm: ", r)
 		}
 	}()
+	SetAlarmStackMd5(alarm)
+	setAlarmLocation(alarm)
+	return AddAlarmFunc(AttackAlarmType, alarm)
+}
+
+// SetAlarmStackMd5 sets the stack_md5 of the attack alarm, the incident of the alarm is grouped by it
+func SetAlarmStackMd5(alarm map[string]interface{}) {
 	if stack, ok := alarm["stack_trace"]; ok && stack != nil && stack != "" {
 		_, ok = stack.(string)
 		if ok {
 			alarm["stack_md5"] = fmt.Sprintf("%x", md5.Sum([]byte(stack.(string))))
 		}
 	}
-	setAlarmLocation(alarm)
-	return AddAlarmFunc(AttackAlarmType, alarm)
 }
 
 func setAlarmLocation(alarm map[string]interface{}) {
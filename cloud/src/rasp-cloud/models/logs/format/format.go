@@ -0,0 +1,236 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package format formats the attack and policy alarms as json, CEF (ArcSight) or LEEF (QRadar)
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJson = "json"
+	FormatCef  = "cef"
+	FormatLeef = "leef"
+
+	AttackAlarmType = "attack-alarm"
+	PolicyAlarmType = "policy-alarm"
+
+	vendor  = "Baidu"
+	product = "OpenRASP"
+)
+
+// Formatter formats an alarm as a single record
+type Formatter func(alarmType string, alarm map[string]interface{}) ([]byte, error)
+
+// FieldMapping maps the alarm field to the key of CEF extension and LEEF attribute,
+// the field is skipped by the format whose key is empty
+type FieldMapping struct {
+	Field string
+	Cef   string
+	// the label of the CEF custom field, such as cs1Label
+	CefLabel string
+	Leef     string
+}
+
+var (
+	AttackFieldMappings = []FieldMapping{
+		{Field: "event_time", Cef: "rt", Leef: "devTime"},
+		{Field: "attack_type", Cef: "cat", Leef: "cat"},
+		{Field: "attack_source", Cef: "src", Leef: "src"},
+		{Field: "server_ip", Cef: "dst", Leef: "dst"},
+		{Field: "server_hostname", Cef: "dvchost", Leef: "identHostName"},
+		{Field: "url", Cef: "request", Leef: "url"},
+		{Field: "request_method", Cef: "requestMethod", Leef: "requestMethod"},
+		{Field: "user_agent", Cef: "requestClientApplication", Leef: "userAgent"},
+		{Field: "intercept_state", Cef: "act", Leef: "action"},
+		{Field: "plugin_message", Cef: "msg", Leef: "msg"},
+		{Field: "plugin_confidence", Cef: "cn1", CefLabel: "pluginConfidence", Leef: "pluginConfidence"},
+		{Field: "app_id", Cef: "cs1", CefLabel: "appId", Leef: "appId"},
+		{Field: "rasp_id", Cef: "cs2", CefLabel: "raspId", Leef: "raspId"},
+		{Field: "request_id", Cef: "cs3", CefLabel: "requestId", Leef: "requestId"},
+		{Field: "plugin_algorithm", Cef: "cs4", CefLabel: "pluginAlgorithm", Leef: "pluginAlgorithm"},
+	}
+	PolicyFieldMappings = []FieldMapping{
+		{Field: "event_time", Cef: "rt", Leef: "devTime"},
+		{Field: "policy_id", Cef: "cat", Leef: "cat"},
+		{Field: "server_hostname", Cef: "dvchost", Leef: "identHostName"},
+		{Field: "message", Cef: "msg", Leef: "msg"},
+		{Field: "app_id", Cef: "cs1", CefLabel: "appId", Leef: "appId"},
+		{Field: "rasp_id", Cef: "cs2", CefLabel: "raspId", Leef: "raspId"},
+	}
+
+	eventTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999-0700", "2006-01-02 15:04:05"}
+)
+
+const (
+	leefTimeLayout = "Jan 02 2006 15:04:05.000 -0700"
+	leefTimeFormat = "MMM dd yyyy HH:mm:ss.SSS Z"
+)
+
+// New returns the formatter by name, the version is put in the header of CEF and LEEF
+func New(name string, version string) (Formatter, error) {
+	switch name {
+	case "", FormatJson:
+		return formatJson, nil
+	case FormatCef:
+		return func(alarmType string, alarm map[string]interface{}) ([]byte, error) {
+			return formatCef(version, alarmType, alarm)
+		}, nil
+	case FormatLeef:
+		return func(alarmType string, alarm map[string]interface{}) ([]byte, error) {
+			return formatLeef(version, alarmType, alarm)
+		}, nil
+	}
+	return nil, errors.New("unrecognized alarm format: " + name)
+}
+
+func formatJson(alarmType string, alarm map[string]interface{}) ([]byte, error) {
+	return json.Marshal(alarm)
+}
+
+func alarmMeta(alarmType string, alarm map[string]interface{}) (mappings []FieldMapping, signature string,
+	name string, severity int, err error) {
+	switch alarmType {
+	case AttackAlarmType:
+		signature = fieldString(alarm["attack_type"])
+		name = fieldString(alarm["plugin_message"])
+		switch alarm["intercept_state"] {
+		case "block":
+			severity = 8
+		case "log":
+			severity = 6
+		default:
+			severity = 3
+		}
+		return AttackFieldMappings, signature, name, severity, nil
+	case PolicyAlarmType:
+		signature = fieldString(alarm["policy_id"])
+		name = fieldString(alarm["message"])
+		return PolicyFieldMappings, signature, name, 3, nil
+	}
+	return nil, "", "", 0, errors.New("unrecognized alarm type: " + alarmType)
+}
+
+// eventTime parses the event_time of the alarm, which is either milliseconds or a time string
+func eventTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(0, int64(v)*int64(time.Millisecond)), true
+	case int64:
+		return time.Unix(0, v*int64(time.Millisecond)), true
+	case int:
+		return time.Unix(0, int64(v)*int64(time.Millisecond)), true
+	case string:
+		for _, layout := range eventTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func fieldString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}, map[string]interface{}:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(content)
+	}
+	return fmt.Sprint(value)
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefHeaderEscaper   = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	leefValueEscaper    = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+func formatCef(version string, alarmType string, alarm map[string]interface{}) ([]byte, error) {
+	mappings, signature, name, severity, err := alarmMeta(alarmType, alarm)
+	if err != nil {
+		return nil, err
+	}
+	header := []string{"CEF:0", vendor, product, version, signature, name, strconv.Itoa(severity)}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+	var extensions []string
+	for _, mapping := range mappings {
+		value, ok := alarm[mapping.Field]
+		if !ok || value == nil || mapping.Cef == "" {
+			continue
+		}
+		var content string
+		if mapping.Field == "event_time" {
+			t, ok := eventTime(value)
+			if !ok {
+				continue
+			}
+			content = strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+		} else {
+			content = fieldString(value)
+		}
+		extensions = append(extensions, mapping.Cef+"="+cefExtensionEscaper.Replace(content))
+		if mapping.CefLabel != "" {
+			extensions = append(extensions, mapping.Cef+"Label="+mapping.CefLabel)
+		}
+	}
+	return []byte(strings.Join(header, "|") + "|" + strings.Join(extensions, " ")), nil
+}
+
+// formatLeef formats the alarm as LEEF 1.0, the attributes are separated by tab
+func formatLeef(version string, alarmType string, alarm map[string]interface{}) ([]byte, error) {
+	mappings, signature, _, severity, err := alarmMeta(alarmType, alarm)
+	if err != nil {
+		return nil, err
+	}
+	header := []string{"LEEF:1.0", vendor, product, version, signature}
+	for i := 1; i < len(header); i++ {
+		header[i] = leefHeaderEscaper.Replace(header[i])
+	}
+	attributes := []string{"sev=" + strconv.Itoa(severity)}
+	for _, mapping := range mappings {
+		value, ok := alarm[mapping.Field]
+		if !ok || value == nil || mapping.Leef == "" {
+			continue
+		}
+		if mapping.Field == "event_time" {
+			t, ok := eventTime(value)
+			if !ok {
+				continue
+			}
+			attributes = append(attributes, mapping.Leef+"="+t.Format(leefTimeLayout),
+				"devTimeFormat="+leefTimeFormat)
+			continue
+		}
+		attributes = append(attributes, mapping.Leef+"="+leefValueEscaper.Replace(fieldString(value)))
+	}
+	return []byte(strings.Join(header, "|") + "|" + strings.Join(attributes, "\t")), nil
+}
@@ -0,0 +1,174 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package format
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func attackAlarm() map[string]interface{} {
+	return map[string]interface{}{
+		"event_time":        "2019-03-14T10:33:45+0800",
+		"attack_type":       "sql",
+		"attack_source":     "10.0.0.1",
+		"server_ip":         "10.0.0.2",
+		"server_hostname":   "web-1",
+		"url":               "http://example.com/a?id=1 or 1=1",
+		"request_method":    "get",
+		"user_agent":        "curl/7.0",
+		"intercept_state":   "block",
+		"plugin_message":    "SQL injection | union\nselect",
+		"plugin_confidence": float64(90),
+		"app_id":            "app",
+		"rasp_id":           "rasp",
+		"request_id":        "req",
+		"plugin_algorithm":  "sqli_userinput",
+		"stack_trace":       "not mapped",
+	}
+}
+
+func TestFieldMappings(t *testing.T) {
+	for name, mappings := range map[string][]FieldMapping{"attack": AttackFieldMappings,
+		"policy": PolicyFieldMappings} {
+		fields := make(map[string]bool)
+		cefKeys := make(map[string]bool)
+		leefKeys := make(map[string]bool)
+		for _, mapping := range mappings {
+			if fields[mapping.Field] || cefKeys[mapping.Cef] || leefKeys[mapping.Leef] {
+				t.Errorf("duplicate %s mapping: %+v", name, mapping)
+			}
+			fields[mapping.Field] = true
+			cefKeys[mapping.Cef] = true
+			leefKeys[mapping.Leef] = true
+			// the custom fields of CEF must be labeled
+			if (strings.HasPrefix(mapping.Cef, "cs") || strings.HasPrefix(mapping.Cef, "cn")) &&
+				mapping.CefLabel == "" {
+				t.Errorf("the %s mapping of %s has no label", name, mapping.Field)
+			}
+		}
+	}
+}
+
+func TestCef(t *testing.T) {
+	formatter, err := New(FormatCef, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := formatter(AttackAlarmType, attackAlarm())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `CEF:0|Baidu|OpenRASP|1.0|sql|SQL injection \| union select|8|` +
+		`rt=1552530825000 cat=sql src=10.0.0.1 dst=10.0.0.2 dvchost=web-1 ` +
+		`request=http://example.com/a?id\=1 or 1\=1 requestMethod=get requestClientApplication=curl/7.0 ` +
+		`act=block msg=SQL injection | union\nselect cn1=90 cn1Label=pluginConfidence cs1=app cs1Label=appId ` +
+		`cs2=rasp cs2Label=raspId cs3=req cs3Label=requestId cs4=sqli_userinput cs4Label=pluginAlgorithm`
+	if string(content) != expected {
+		t.Fatalf("unexpected cef:\n%s\n%s", content, expected)
+	}
+
+	content, err = formatter(PolicyAlarmType, map[string]interface{}{
+		"event_time": float64(1552530825000),
+		"policy_id":  "3006",
+		"message":    `weak password of mysql: a\b`,
+		"app_id":     "app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `CEF:0|Baidu|OpenRASP|1.0|3006|weak password of mysql: a\\b|3|` +
+		`rt=1552530825000 cat=3006 msg=weak password of mysql: a\\b cs1=app cs1Label=appId`
+	if string(content) != expected {
+		t.Fatalf("unexpected cef:\n%s\n%s", content, expected)
+	}
+}
+
+func TestLeef(t *testing.T) {
+	formatter, err := New(FormatLeef, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alarm := attackAlarm()
+	alarm["intercept_state"] = "log"
+	alarm["user_agent"] = "a\tb"
+	content, err := formatter(AttackAlarmType, alarm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(string(content), "|", 6)
+	if len(parts) != 6 || parts[0] != "LEEF:1.0" || parts[1] != "Baidu" || parts[2] != "OpenRASP" ||
+		parts[3] != "1.0" || parts[4] != "sql" {
+		t.Fatalf("unexpected leef header: %s", content)
+	}
+	attributes := make(map[string]string)
+	for _, attribute := range strings.Split(parts[5], "\t") {
+		kv := strings.SplitN(attribute, "=", 2)
+		attributes[kv[0]] = kv[1]
+	}
+	expected := map[string]string{
+		"sev":              "6",
+		"devTime":          "Mar 14 2019 10:33:45.000 +0800",
+		"devTimeFormat":    "MMM dd yyyy HH:mm:ss.SSS Z",
+		"cat":              "sql",
+		"src":              "10.0.0.1",
+		"dst":              "10.0.0.2",
+		"identHostName":    "web-1",
+		"url":              "http://example.com/a?id=1 or 1=1",
+		"requestMethod":    "get",
+		"userAgent":        "a b",
+		"action":           "log",
+		"msg":              "SQL injection | union select",
+		"pluginConfidence": "90",
+		"appId":            "app",
+		"raspId":           "rasp",
+		"requestId":        "req",
+		"pluginAlgorithm":  "sqli_userinput",
+	}
+	if len(attributes) != len(expected) {
+		t.Errorf("unexpected leef attributes: %v", attributes)
+	}
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("expect %s=%q, got %q", key, value, attributes[key])
+		}
+	}
+}
+
+func TestJson(t *testing.T) {
+	formatter, err := New("", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := formatter(AttackAlarmType, attackAlarm())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alarm map[string]interface{}
+	if err = json.Unmarshal(content, &alarm); err != nil || alarm["stack_trace"] != "not mapped" {
+		t.Fatalf("unexpected json: %s, %v", content, err)
+	}
+	if _, err = New("xml", "1.0"); err == nil {
+		t.Fatal("expect an error for the unknown format")
+	}
+	if _, err = formatter("unknown", attackAlarm()); err != nil {
+		t.Fatal("the json format accepts any alarm type")
+	}
+	cef, _ := New(FormatCef, "1.0")
+	if _, err = cef("unknown", attackAlarm()); err == nil {
+		t.Fatal("expect an error for the unknown alarm type")
+	}
+}
@@ -26,6 +26,10 @@ import (
 	"context"
 	"path"
 	"fmt"
+	"rasp-cloud/tools/spool"
+	"rasp-cloud/models/logs/format"
+	"strconv"
+	"errors"
 )
 
 type AggrTimeParam struct {
@@ -57,6 +61,8 @@ type SearchAttackParam struct {
 		AttackUrl    string    `json:"url,omitempty"`
 		LocalIp      string    `json:"local_ip,omitempty"`
 		AttackType   *[]string `json:"attack_type,omitempty"`
+		// the status of the incident, see models.IncidentStatuses
+		Status string `json:"status,omitempty"`
 	} `json:"data"`
 }
 
@@ -82,21 +88,20 @@ var (
 	esAttackAlarmBuffer chan map[string]interface{}
 	esPolicyAlarmBuffer chan map[string]interface{}
 	alarmFileLoggers    = make(map[string]*logs.BeeLogger)
+	alarmFileFormatter  format.Formatter
+	// the alarms are spooled to disk when the buffer is full or es is unavailable
+	alarmSpools = make(map[string]*spool.Spool)
+)
+
+const (
+	esBulkSize            = 200
+	spoolSegmentSize      = 32 * 1024 * 1024
+	spoolMaxRetryInterval = 60 * time.Second
 )
 
 func init() {
 	es.RegisterTTL(24*365*time.Hour, AliasAttackIndexName+"-*")
 	es.RegisterTTL(24*365*time.Hour, AliasPolicyIndexName+"-*")
-	alarmLogMode := beego.AppConfig.DefaultString("AlarmLogMode", "file")
-	if alarmLogMode == "file" {
-		AddAlarmFunc = AddLogWithFile
-		initRaspLoggers()
-	} else if alarmLogMode == "es" {
-		startEsAlarmLogPush()
-		AddAlarmFunc = AddLogWithES
-	} else {
-		tools.Panic(tools.ErrCodeConfigInitFailed, "Unrecognized the value of RaspLogMode config", nil)
-	}
 	alarmBufferSize := beego.AppConfig.DefaultInt("AlarmBufferSize", 300)
 	if alarmBufferSize <= 0 {
 		tools.Panic(tools.ErrCodeMongoInitFailed, "the 'AlarmBufferSize' config must be greater than 0", nil)
@@ -106,6 +111,28 @@ func init() {
 	}
 	esAttackAlarmBuffer = make(chan map[string]interface{}, alarmBufferSize)
 	esPolicyAlarmBuffer = make(chan map[string]interface{}, alarmBufferSize)
+	initAlarmSinks(beego.AppConfig.DefaultString("AlarmLogMode", "file"), alarmBufferSize)
+}
+
+func initAlarmSpools() {
+	spoolMaxSize := beego.AppConfig.DefaultInt64("AlarmSpoolMaxSize", 1024)
+	if spoolMaxSize <= 0 {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "the 'AlarmSpoolMaxSize' config must be greater than 0", nil)
+	}
+	currentPath, err := tools.GetCurrentPath()
+	if err != nil {
+		tools.Panic(tools.ErrCodeLogInitFailed, "failed to init alarm spool", err)
+	}
+	for _, alarmType := range []string{AttackAlarmType, PolicyAlarmType} {
+		// the spool that is not drained before the last exit is replayed here
+		alarmSpool, err := spool.Open(path.Join(currentPath, "openrasp-logs", "spool", alarmType),
+			spoolMaxSize*1024*1024, spoolSegmentSize)
+		if err != nil {
+			tools.Panic(tools.ErrCodeLogInitFailed, "failed to open the spool of "+alarmType, err)
+		}
+		alarmSpools[alarmType] = alarmSpool
+		go startSpoolDrain(alarmType, alarmSpool)
+	}
 }
 
 func initRaspLoggers() {
@@ -152,33 +179,170 @@ func handleEsLogPush() {
 	}()
 	select {
 	case alarm := <-esAttackAlarmBuffer:
-		alarms := make([]map[string]interface{}, 0, 200)
+		alarms := make([]map[string]interface{}, 0, esBulkSize)
 		alarms = append(alarms, alarm)
-		for len(esAttackAlarmBuffer) > 0 && len(alarms) < 200 {
+		for len(esAttackAlarmBuffer) > 0 && len(alarms) < esBulkSize {
 			alarm := <-esAttackAlarmBuffer
 			alarms = append(alarms, alarm)
 		}
 		err := es.BulkInsert(AttackAlarmType, alarms)
 		if err != nil {
 			beego.Error("failed to execute es bulk insert: " + err.Error())
+			handleBulkError(AttackAlarmType, alarms, err)
 		}
 	case alarm := <-esPolicyAlarmBuffer:
-		alarms := make([]map[string]interface{}, 0, 200)
+		alarms := make([]map[string]interface{}, 0, esBulkSize)
 		alarms = append(alarms, alarm)
-		for len(esPolicyAlarmBuffer) > 0 && len(alarms) < 200 {
+		for len(esPolicyAlarmBuffer) > 0 && len(alarms) < esBulkSize {
 			alarm := <-esPolicyAlarmBuffer
 			alarms = append(alarms, alarm)
 		}
 		err := es.BulkInsert(PolicyAlarmType, alarms)
 		if err != nil {
 			beego.Error("failed to execute es bulk insert: " + err.Error())
+			handleBulkError(PolicyAlarmType, alarms, err)
 		}
 	}
 }
 
+// handleBulkError spools the alarms that can be inserted later, and quarantines the alarms rejected by es
+func handleBulkError(alarmType string, alarms []map[string]interface{}, err error) {
+	bulkErr, ok := err.(*es.BulkError)
+	if !ok {
+		spoolAlarms(alarmType, alarms...)
+		return
+	}
+	spoolAlarms(alarmType, bulkErr.Retryable...)
+	if alarmSpool, ok := alarmSpools[alarmType]; ok && len(bulkErr.Permanent) > 0 {
+		if err = alarmSpool.Quarantine(encodeAlarms(alarmType, bulkErr.Permanent)); err != nil {
+			logs.Error("failed to quarantine " + strconv.Itoa(len(bulkErr.Permanent)) + " " + alarmType + ": " +
+				err.Error() + ", the alarms are dropped: " + fmt.Sprintf("%+v", bulkErr.Permanent))
+		}
+	}
+}
+
+func spoolAlarms(alarmType string, alarms ...map[string]interface{}) {
+	alarmSpool, ok := alarmSpools[alarmType]
+	if !ok || len(alarms) == 0 {
+		return
+	}
+	records := encodeAlarms(alarmType, alarms)
+	err := alarmSpool.Append(records...)
+	if err != nil {
+		// the alarms are dropped, keep them in the log at least
+		logs.Error("failed to spool " + strconv.Itoa(len(records)) + " " + alarmType + ": " + err.Error() +
+			", the alarms are dropped: " + fmt.Sprintf("%+v", alarms))
+	}
+}
+
+func encodeAlarms(alarmType string, alarms []map[string]interface{}) [][]byte {
+	records := make([][]byte, 0, len(alarms))
+	for _, alarm := range alarms {
+		content, err := json.Marshal(alarm)
+		if err != nil {
+			logs.Error("failed to encode " + alarmType + " for the spool: " + err.Error())
+			continue
+		}
+		records = append(records, content)
+	}
+	return records
+}
+
+// startSpoolDrain pushes the spooled alarms to es, and retries with exponential backoff when es fails,
+// the alarms rejected by es are moved to the quarantine file of the spool
+func startSpoolDrain(alarmType string, alarmSpool *spool.Spool) {
+	retryInterval := time.Second
+	for {
+		// some alarms of the batch are spooled again when es is busy, they are retried with backoff as well
+		requeued := false
+		count, err := alarmSpool.Drain(esBulkSize, func(records [][]byte) error {
+			var pushErr error
+			requeued, pushErr = pushSpooledAlarms(alarmType, alarmSpool, records)
+			return pushErr
+		})
+		if err != nil || requeued {
+			message := "some alarms are rejected by es"
+			if err != nil {
+				message = err.Error()
+			}
+			beego.Error("failed to push the spooled " + alarmType + " to es, retry after " +
+				retryInterval.String() + ": " + message)
+			time.Sleep(retryInterval)
+			retryInterval *= 2
+			if retryInterval > spoolMaxRetryInterval {
+				retryInterval = spoolMaxRetryInterval
+			}
+			continue
+		}
+		retryInterval = time.Second
+		if count == 0 {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// pushSpooledAlarms pushes the records to es, the records failed in the bulk insert are appended to the spool
+// again or quarantined, so that the inserted ones are not inserted twice
+func pushSpooledAlarms(alarmType string, alarmSpool *spool.Spool, records [][]byte) (requeued bool, err error) {
+	alarms := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		var alarm map[string]interface{}
+		if err := json.Unmarshal(record, &alarm); err != nil {
+			return false, spool.Poison(errors.New("failed to decode the spooled " + alarmType + ": " + err.Error()))
+		}
+		alarms = append(alarms, alarm)
+	}
+	err = es.BulkInsert(alarmType, alarms)
+	if bulkErr, ok := err.(*es.BulkError); ok {
+		beego.Error("failed to push " + alarmType + ": " + bulkErr.Error())
+		if len(bulkErr.Permanent) > 0 {
+			err = alarmSpool.Quarantine(encodeAlarms(alarmType, bulkErr.Permanent))
+			if err == spool.ErrQuarantineFull {
+				beego.Error("the quarantine of " + alarmType + " is full, the alarms are dropped: " +
+					fmt.Sprintf("%+v", bulkErr.Permanent))
+			} else if err != nil {
+				return false, err
+			}
+		}
+		if len(bulkErr.Retryable) > 0 {
+			if err = alarmSpool.Append(encodeAlarms(alarmType, bulkErr.Retryable)...); err != nil {
+				return false, err
+			}
+		}
+		return len(bulkErr.Retryable) > 0, nil
+	}
+	if err != nil && es.IsPermanentError(err) {
+		beego.Error("the spooled " + alarmType + " is rejected by es, it is quarantined: " + err.Error())
+		return false, spool.Poison(err)
+	}
+	return false, err
+}
+
+// GetSpoolStats returns the stats of the alarm spools, it is empty if the alarms are not pushed to es
+func GetSpoolStats() map[string]spool.Stats {
+	result := make(map[string]spool.Stats)
+	for alarmType, alarmSpool := range alarmSpools {
+		result[alarmType] = alarmSpool.Stats()
+	}
+	return result
+}
+
+// ReplaySpoolQuarantine pushes the quarantined alarms to es again, it returns the count of the replayed alarms
+func ReplaySpoolQuarantine() (map[string]int, error) {
+	result := make(map[string]int)
+	for alarmType, alarmSpool := range alarmSpools {
+		count, err := alarmSpool.Replay()
+		if err != nil {
+			return result, errors.New("failed to replay the quarantined " + alarmType + ": " + err.Error())
+		}
+		result[alarmType] = count
+	}
+	return result, nil
+}
+
 func AddLogWithFile(alarmType string, alarm map[string]interface{}) error {
 	if logger, ok := alarmFileLoggers[alarmType]; ok && logger != nil {
-		content, err := json.Marshal(alarm)
+		content, err := alarmFileFormatter(alarmType, alarm)
 		if err != nil {
 			return err
 		}
@@ -194,17 +358,21 @@ func AddLogWithFile(alarmType string, alarm map[string]interface{}) error {
 }
 
 func AddLogWithES(alarmType string, alarm map[string]interface{}) error {
+	// the alarm without app_id can not be indexed, it is rejected before being buffered or spooled
+	if appId, ok := alarm["app_id"].(string); !ok || appId == "" {
+		return errors.New("the app_id of " + alarmType + " must be a non-empty string")
+	}
 	if alarmType == AttackAlarmType {
 		select {
 		case esAttackAlarmBuffer <- alarm:
 		default:
-			logs.Error("failed to write attack alarm ,the buffer is full: " + fmt.Sprintf("%+v", alarm))
+			spoolAlarms(AttackAlarmType, alarm)
 		}
 	} else if alarmType == PolicyAlarmType {
 		select {
 		case esPolicyAlarmBuffer <- alarm:
 		default:
-			logs.Error("failed to write policy alarm ,the buffer is full: " + fmt.Sprintf("%+v", alarm))
+			spoolAlarms(PolicyAlarmType, alarm)
 		}
 	}
 	return nil
@@ -212,6 +380,12 @@ func AddLogWithES(alarmType string, alarm map[string]interface{}) error {
 
 func SearchLogs(startTime int64, endTime int64, query map[string]interface{}, sortField string, page int,
 	perpage int, ascending bool, index ...string) (int64, []map[string]interface{}, error) {
+	return SearchLogsWithFilter(startTime, endTime, query, nil, sortField, page, perpage, ascending, index...)
+}
+
+// SearchLogsWithFilter is the same as SearchLogs, the extra filter is ignored if it is nil
+func SearchLogsWithFilter(startTime int64, endTime int64, query map[string]interface{}, extraFilter elastic.Query,
+	sortField string, page int, perpage int, ascending bool, index ...string) (int64, []map[string]interface{}, error) {
 	var total int64
 	filterQueries := make([]elastic.Query, 0, len(query)+1)
 	shouldQueries := make([]elastic.Query, 0, len(query)+1)
@@ -246,6 +420,9 @@ func SearchLogs(startTime int64, endTime int64, query map[string]interface{}, so
 		}
 	}
 	filterQueries = append(filterQueries, elastic.NewRangeQuery("event_time").Gte(startTime).Lte(endTime))
+	if extraFilter != nil {
+		filterQueries = append(filterQueries, extraFilter)
+	}
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Second))
 	defer cancel()
 	boolQuery := elastic.NewBoolQuery().Filter(filterQueries...)
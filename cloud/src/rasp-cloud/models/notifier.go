@@ -0,0 +1,252 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"github.com/astaxie/beego"
+	"strconv"
+	"time"
+)
+
+const (
+	AlarmTypeAttack      = "attack"
+	AlarmTypeRaspOffline = "rasp_offline"
+	AlarmTypeRaspOnline  = "rasp_online"
+)
+
+// Notifier is an alarm channel, e.g. email, ding ding, http, slack
+type Notifier interface {
+	Name() string
+	Enabled(app *App) bool
+	Notify(app *App, msg *AlarmMessage) error
+}
+
+// ConfigurableNotifier is a notifier whose config is stored in the channel_alarm_conf of the app,
+// the value of the 'secret' key in the config is masked when the app is returned
+type ConfigurableNotifier interface {
+	Notifier
+	ValidateConf(conf map[string]interface{}) error
+}
+
+type AlarmMessage struct {
+	Type         string
+	Title        string
+	Content      string
+	DetailedLink string
+	Total        int64
+	Alarms       []map[string]interface{}
+	Rasps        []*RaspAlarmItem
+	IsTest       bool
+}
+
+var (
+	notifiers     = make(map[string]Notifier)
+	notifierNames []string
+)
+
+func init() {
+	RegisterNotifier(&emailNotifier{})
+	RegisterNotifier(&dingNotifier{})
+	RegisterNotifier(&httpNotifier{})
+}
+
+// RegisterNotifier adds the notifier to the registry, the notifiers are called in the order of registration
+func RegisterNotifier(notifier Notifier) {
+	name := notifier.Name()
+	if _, ok := notifiers[name]; ok {
+		panic("duplicate notifier: " + name)
+	}
+	notifiers[name] = notifier
+	notifierNames = append(notifierNames, name)
+}
+
+func GetNotifier(name string) (Notifier, bool) {
+	notifier, ok := notifiers[name]
+	return notifier, ok
+}
+
+func GetConfigurableNotifier(name string) (ConfigurableNotifier, bool) {
+	notifier, ok := notifiers[name].(ConfigurableNotifier)
+	return notifier, ok
+}
+
+func pushAlarm(app *App, msg *AlarmMessage) {
+	pushAlarmToChannels(app, msg, nil)
+}
+
+// pushAlarmToChannels pushes the alarm to the enabled notifiers in the channels, or all enabled notifiers
+// if the channels is empty
+func pushAlarmToChannels(app *App, msg *AlarmMessage, channels []string) {
+	if app == nil {
+		return
+	}
+	for _, name := range notifierNames {
+		if len(channels) > 0 && !containsString(channels, name) {
+			continue
+		}
+		notifier := notifiers[name]
+		if notifier.Enabled(app) {
+			if err := notifier.Notify(app, msg); err != nil {
+				beego.Error("failed to push " + name + " alarm for app " + app.Name + ": " + err.Error())
+			}
+		}
+	}
+}
+
+// TestNotifier sends a test message through the notifier of the app
+func TestNotifier(app *App, name string) error {
+	notifier, ok := GetNotifier(name)
+	if !ok {
+		return errors.New("unknown alarm channel: " + name)
+	}
+	if !notifier.Enabled(app) {
+		return errors.New("please enable the " + name + " alarm first")
+	}
+	return notifier.Notify(app, newAttackAlarmMessage(app, 0, nil, true))
+}
+
+func newAttackAlarmMessage(app *App, total int64, alarms []map[string]interface{}, isTest bool) *AlarmMessage {
+	msg := &AlarmMessage{
+		Type:         AlarmTypeAttack,
+		Title:        "OpenRASP alarm",
+		DetailedLink: panelServerURL + "/#/events/" + app.Id,
+		Total:        total,
+		Alarms:       alarms,
+		IsTest:       isTest,
+	}
+	if isTest {
+		msg.Title = "OpenRASP test message"
+		msg.Alarms = TestAlarmData
+		msg.Total = int64(len(TestAlarmData))
+		msg.Content = "OpenRASP test message from app: " + app.Name + ", time: " + time.Now().Format(time.RFC3339)
+	} else {
+		msg.Content = "时间：" + time.Now().Format(time.RFC3339) + "， 来自 OpenRAS 的报警\n共有 " +
+			strconv.FormatInt(total, 10) + " 条报警信息来自 APP：" + app.Name + "，详细信息：" + msg.DetailedLink
+	}
+	return msg
+}
+
+func newRaspAlarmMessage(app *App, rasps []*Rasp, online bool) *AlarmMessage {
+	msg := &AlarmMessage{
+		DetailedLink: panelServerURL + "/#/hosts/" + app.Id,
+		Total:        int64(len(rasps)),
+	}
+	if online {
+		msg.Type = AlarmTypeRaspOnline
+		msg.Title = "OpenRASP 主机恢复通知"
+	} else {
+		msg.Type = AlarmTypeRaspOffline
+		msg.Title = "OpenRASP 主机离线通知"
+	}
+	msg.Content = "时间：" + time.Now().Format(time.RFC3339) + "，" + msg.Title + "\nAPP：" + app.Name
+	for _, rasp := range rasps {
+		item := &RaspAlarmItem{
+			Rasp:          rasp,
+			LastHeartbeat: time.Unix(rasp.LastHeartbeatTime, 0).Format("2006-01-02 15:04:05"),
+		}
+		msg.Rasps = append(msg.Rasps, item)
+		msg.Content += "\n" + item.HostName + "（" + item.RegisterIp + "），最后心跳时间：" + item.LastHeartbeat
+	}
+	msg.Content += "\n详细信息：" + msg.DetailedLink
+	return msg
+}
+
+type emailNotifier struct{}
+
+func (*emailNotifier) Name() string {
+	return "email"
+}
+
+func (*emailNotifier) Enabled(app *App) bool {
+	return app.EmailAlarmConf.Enable
+}
+
+func (*emailNotifier) Notify(app *App, msg *AlarmMessage) (err error) {
+	var subject, content string
+	if msg.Type == AlarmTypeAttack {
+		if app.EmailAlarmConf.Subject == "" {
+			subject = "OpenRASP alarm"
+		} else {
+			subject = app.EmailAlarmConf.Subject
+		}
+		if msg.IsTest {
+			subject = "【测试邮件】" + subject
+		}
+		content, err = renderEmailTemplate("views/email.tpl", &emailTemplateParam{
+			Total:        msg.Total - int64(len(msg.Alarms)),
+			Alarms:       msg.Alarms,
+			AppName:      app.Name,
+			DetailedLink: msg.DetailedLink,
+		})
+	} else {
+		subject = msg.Title
+		content, err = renderEmailTemplate("views/rasp_email.tpl", &raspEmailTemplateParam{
+			Title:        msg.Title,
+			Rasps:        msg.Rasps,
+			AppName:      app.Name,
+			DetailedLink: msg.DetailedLink,
+		})
+	}
+	if err != nil {
+		return
+	}
+	return sendEmailAlarm(app, subject, content)
+}
+
+type dingNotifier struct{}
+
+func (*dingNotifier) Name() string {
+	return "ding"
+}
+
+func (*dingNotifier) Enabled(app *App) bool {
+	return app.DingAlarmConf.Enable
+}
+
+func (*dingNotifier) Notify(app *App, msg *AlarmMessage) error {
+	return sendDingAlarm(app, msg.Content)
+}
+
+type httpNotifier struct{}
+
+func (*httpNotifier) Name() string {
+	return "http"
+}
+
+func (*httpNotifier) Enabled(app *App) bool {
+	return app.HttpAlarmConf.Enable
+}
+
+func (*httpNotifier) Notify(app *App, msg *AlarmMessage) error {
+	body := make(map[string]interface{})
+	body["app_id"] = app.Id
+	if msg.Type == AlarmTypeAttack {
+		body["data"] = msg.Alarms
+	} else {
+		body["type"] = msg.Type
+		body["data"] = msg.Rasps
+	}
+	return sendHttpAlarm(app, body)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
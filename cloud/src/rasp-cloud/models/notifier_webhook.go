@@ -0,0 +1,257 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/httplib"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the notifiers below push alarms to the incoming webhook of the IM robots,
+// their configs are stored in the channel_alarm_conf of the app
+func init() {
+	RegisterNotifier(&slackNotifier{})
+	RegisterNotifier(&teamsNotifier{})
+	RegisterNotifier(&wecomNotifier{})
+	RegisterNotifier(&feishuNotifier{})
+}
+
+func getChannelConf(app *App, name string) map[string]interface{} {
+	if app.ChannelAlarmConf == nil {
+		return nil
+	}
+	return app.ChannelAlarmConf[name]
+}
+
+func getConfString(conf map[string]interface{}, key string) string {
+	value, _ := conf[key].(string)
+	return value
+}
+
+func webhookEnabled(app *App, name string) bool {
+	enable, _ := getChannelConf(app, name)["enable"].(bool)
+	return enable
+}
+
+func validWebhookConf(conf map[string]interface{}, allowedKeys ...string) error {
+	for key := range conf {
+		allowed := key == "enable" || key == "webhook_url"
+		for _, allowedKey := range allowedKeys {
+			allowed = allowed || key == allowedKey
+		}
+		if !allowed {
+			return errors.New("unknown config key: " + key)
+		}
+	}
+	if _, ok := conf["enable"].(bool); conf["enable"] != nil && !ok {
+		return errors.New("the enable must be a boolean")
+	}
+	for _, key := range allowedKeys {
+		if _, ok := conf[key].(string); conf[key] != nil && !ok {
+			return errors.New("the " + key + " must be a string")
+		}
+		if len(getConfString(conf, key)) > 1024 {
+			return errors.New("the length of " + key + " cannot be greater than 1024")
+		}
+	}
+	webhookUrl, ok := conf["webhook_url"].(string)
+	if !ok || webhookUrl == "" {
+		return errors.New("the webhook_url cannot be empty")
+	}
+	if len(webhookUrl) > 1024 {
+		return errors.New("the length of webhook_url cannot be greater than 1024")
+	}
+	u, err := url.Parse(webhookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("the webhook_url must be a valid http or https url")
+	}
+	return nil
+}
+
+// postWebhook posts the body as json to the webhook, and decodes the response into the result if it is not nil
+func postWebhook(name string, webhookUrl string, body interface{}, result interface{}) error {
+	request := httplib.Post(webhookUrl)
+	request.SetTimeout(10*time.Second, 10*time.Second)
+	_, err := request.JSONBody(body)
+	if err != nil {
+		return err
+	}
+	response, err := request.Response()
+	if err != nil {
+		return errors.New("failed to push " + name + " alarm: " + err.Error())
+	}
+	if response.StatusCode > 299 || response.StatusCode < 200 {
+		return errors.New("failed to push " + name + " alarm, with status code: " + strconv.Itoa(response.StatusCode))
+	}
+	if result != nil {
+		content, err := request.Bytes()
+		if err != nil {
+			return errors.New("failed to read the response of " + name + " webhook: " + err.Error())
+		}
+		if err = json.Unmarshal(content, result); err != nil {
+			return errors.New("failed to decode the response of " + name + " webhook: " + err.Error())
+		}
+	}
+	beego.Debug("succeed in pushing " + name + " alarm")
+	return nil
+}
+
+type slackNotifier struct{}
+
+func (*slackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *slackNotifier) Enabled(app *App) bool {
+	return webhookEnabled(app, n.Name())
+}
+
+func (*slackNotifier) ValidateConf(conf map[string]interface{}) error {
+	return validWebhookConf(conf)
+}
+
+func (n *slackNotifier) Notify(app *App, msg *AlarmMessage) error {
+	conf := getChannelConf(app, n.Name())
+	return postWebhook(n.Name(), getConfString(conf, "webhook_url"), map[string]interface{}{
+		"text": "*" + msg.Title + "*\n" + msg.Content,
+	}, nil)
+}
+
+type teamsNotifier struct{}
+
+func (*teamsNotifier) Name() string {
+	return "teams"
+}
+
+func (n *teamsNotifier) Enabled(app *App) bool {
+	return webhookEnabled(app, n.Name())
+}
+
+func (*teamsNotifier) ValidateConf(conf map[string]interface{}) error {
+	return validWebhookConf(conf)
+}
+
+func (n *teamsNotifier) Notify(app *App, msg *AlarmMessage) error {
+	conf := getChannelConf(app, n.Name())
+	// the text of the message card is markdown, a single line break is ignored
+	return postWebhook(n.Name(), getConfString(conf, "webhook_url"), map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "http://schema.org/extensions",
+		"themeColor": "D70000",
+		"summary":    msg.Title,
+		"title":      msg.Title,
+		"text":       strings.Replace(msg.Content, "\n", "\n\n", -1),
+		"potentialAction": []map[string]interface{}{
+			{
+				"@type": "OpenUri",
+				"name":  "Details",
+				"targets": []map[string]string{
+					{"os": "default", "uri": msg.DetailedLink},
+				},
+			},
+		},
+	}, nil)
+}
+
+type wecomResponse struct {
+	ErrCode int64  `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+type wecomNotifier struct{}
+
+func (*wecomNotifier) Name() string {
+	return "wecom"
+}
+
+func (n *wecomNotifier) Enabled(app *App) bool {
+	return webhookEnabled(app, n.Name())
+}
+
+func (*wecomNotifier) ValidateConf(conf map[string]interface{}) error {
+	return validWebhookConf(conf)
+}
+
+func (n *wecomNotifier) Notify(app *App, msg *AlarmMessage) error {
+	conf := getChannelConf(app, n.Name())
+	var result wecomResponse
+	err := postWebhook(n.Name(), getConfString(conf, "webhook_url"), map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": msg.Title + "\n" + msg.Content},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return errors.New("failed to push wecom alarm, with errmsg: " + result.ErrMsg)
+	}
+	return nil
+}
+
+type feishuResponse struct {
+	Code int64  `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+type feishuNotifier struct{}
+
+func (*feishuNotifier) Name() string {
+	return "feishu"
+}
+
+func (n *feishuNotifier) Enabled(app *App) bool {
+	return webhookEnabled(app, n.Name())
+}
+
+func (*feishuNotifier) ValidateConf(conf map[string]interface{}) error {
+	return validWebhookConf(conf, "secret")
+}
+
+func (n *feishuNotifier) Notify(app *App, msg *AlarmMessage) error {
+	conf := getChannelConf(app, n.Name())
+	body := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": msg.Title + "\n" + msg.Content},
+	}
+	if secret := getConfString(conf, "secret"); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		body["timestamp"] = timestamp
+		body["sign"] = feishuSign(timestamp, secret)
+	}
+	var result feishuResponse
+	err := postWebhook(n.Name(), getConfString(conf, "webhook_url"), body, &result)
+	if err != nil {
+		return err
+	}
+	if result.Code != 0 {
+		return errors.New("failed to push feishu alarm, with msg: " + result.Msg)
+	}
+	return nil
+}
+
+// feishuSign signs the request for the robot with signature verification enabled
+func feishuSign(timestamp string, secret string) string {
+	h := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,220 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"rasp-cloud/tools/oidc"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OidcState is a pending login, it is consumed by the callback of the provider
+type OidcState struct {
+	Id       string    `bson:"_id"`
+	Nonce    string    `bson:"nonce"`
+	Verifier string    `bson:"verifier"`
+	Time     time.Time `bson:"time"`
+}
+
+// OidcConfig is the login config shown to the login page
+type OidcConfig struct {
+	Enable           bool `json:"enable"`
+	LocalLoginEnable bool `json:"local_login_enable"`
+	// the ldap users log in with password as the local users
+	LdapEnable bool `json:"ldap_enable"`
+}
+
+const (
+	oidcStateCollectionName = "oidc_state"
+	OidcStateCookieName     = "RASP_OIDC_STATE"
+	// the user must finish the login in the provider within it
+	OidcStateLifeTime = 10 * time.Minute
+)
+
+var (
+	oidcEnable       bool
+	localLoginEnable bool
+	oidcNameClaim    string
+	oidcGroupClaim   string
+	oidcDefaultRole  string
+	// the group of the provider to the panel role
+	oidcGroupRoles = make(map[string]string)
+	oidcProvider   *oidc.Provider
+	oidcMutex      sync.Mutex
+)
+
+func init() {
+	oidcEnable = beego.AppConfig.DefaultBool("OidcEnable", false)
+	localLoginEnable = beego.AppConfig.DefaultBool("LocalLoginEnable", true)
+	if !oidcEnable {
+		if !localLoginEnable && !beego.AppConfig.DefaultBool("LdapEnable", false) {
+			tools.Panic(tools.ErrCodeConfigInitFailed, "the 'LocalLoginEnable' config can not be false "+
+				"if both the 'OidcEnable' and 'LdapEnable' configs are false", nil)
+		}
+		return
+	}
+	oidcNameClaim = beego.AppConfig.DefaultString("OidcNameClaim", "preferred_username")
+	oidcGroupClaim = beego.AppConfig.DefaultString("OidcGroupClaim", "groups")
+	oidcDefaultRole = beego.AppConfig.String("OidcDefaultRole")
+	if oidcDefaultRole != "" && !IsValidRole(oidcDefaultRole) {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "unknown role of the 'OidcDefaultRole' config: "+oidcDefaultRole, nil)
+	}
+	// the groups of lower roles are added first so that the higher role takes precedence
+	for _, item := range []struct {
+		key  string
+		role string
+	}{{"OidcReadOnlyGroups", RoleReadOnly}, {"OidcOperatorGroups", RoleOperator}, {"OidcAdminGroups", RoleAdmin}} {
+		for _, group := range strings.Split(beego.AppConfig.String(item.key), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				oidcGroupRoles[group] = item.role
+			}
+		}
+	}
+
+	count, err := mongo.Count(oidcStateCollectionName)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get oidc_state collection count", err)
+	}
+	if count <= 0 {
+		index := &mgo.Index{
+			Key:         []string{"time"},
+			Background:  true,
+			Name:        "time",
+			ExpireAfter: OidcStateLifeTime,
+		}
+		err = mongo.CreateIndex(oidcStateCollectionName, index)
+		if err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create index for oidc_state collection", err)
+		}
+	}
+}
+
+func GetOidcConfig() *OidcConfig {
+	return &OidcConfig{Enable: oidcEnable, LocalLoginEnable: localLoginEnable, LdapEnable: ldapEnable}
+}
+
+// IsPasswordLoginEnable checks whether the local or ldap users can log in with password
+func IsPasswordLoginEnable() bool {
+	return localLoginEnable || ldapEnable
+}
+
+// getOidcProvider discovers the provider on the first login, so that the panel can start
+// while the provider is unavailable
+func getOidcProvider() (*oidc.Provider, error) {
+	if !oidcEnable {
+		return nil, errors.New("the single sign-on is not enabled")
+	}
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+	redirectUrl := beego.AppConfig.String("OidcRedirectUrl")
+	if redirectUrl == "" {
+		redirectUrl = strings.TrimSuffix(beego.AppConfig.String("PanelServerURL"), "/") + "/v1/user/oidc/callback"
+	}
+	provider, err := oidc.NewProvider(oidc.Config{
+		Issuer:       beego.AppConfig.String("OidcIssuer"),
+		ClientId:     beego.AppConfig.String("OidcClientId"),
+		ClientSecret: beego.AppConfig.String("OidcClientSecret"),
+		RedirectUrl:  redirectUrl,
+		Scopes:       strings.Fields(beego.AppConfig.DefaultString("OidcScopes", "openid profile email")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return provider, nil
+}
+
+// NewOidcLogin saves a pending login and returns its state and the url of the provider
+func NewOidcLogin() (state string, authUrl string, err error) {
+	provider, err := getOidcProvider()
+	if err != nil {
+		return
+	}
+	oidcState := &OidcState{Time: time.Now()}
+	if oidcState.Id, err = oidc.RandomString(32); err != nil {
+		return
+	}
+	if oidcState.Nonce, err = oidc.RandomString(32); err != nil {
+		return
+	}
+	if oidcState.Verifier, err = oidc.NewVerifier(); err != nil {
+		return
+	}
+	if err = mongo.Insert(oidcStateCollectionName, oidcState); err != nil {
+		return
+	}
+	return oidcState.Id, provider.AuthCodeURL(oidcState.Id, oidcState.Nonce, oidcState.Verifier), nil
+}
+
+// FinishOidcLogin consumes the pending login of the state, redeems the code and returns the user
+// of the id token, the user is created on the first login and its role is synchronized with the groups
+func FinishOidcLogin(state string, code string) (*User, error) {
+	provider, err := getOidcProvider()
+	if err != nil {
+		return nil, err
+	}
+	var oidcState *OidcState
+	err = mongo.FindId(oidcStateCollectionName, state, &oidcState)
+	if err != nil {
+		return nil, errors.New("the login has expired, please try again")
+	}
+	// the state can only be used once
+	if err = mongo.RemoveId(oidcStateCollectionName, state); err != nil {
+		return nil, err
+	}
+	if time.Since(oidcState.Time) > OidcStateLifeTime {
+		return nil, errors.New("the login has expired, please try again")
+	}
+	token, err := provider.Exchange(code, oidcState.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.VerifyIdToken(token.IdToken, oidcState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return syncOidcUser(claims)
+}
+
+func syncOidcUser(claims oidc.Claims) (*User, error) {
+	name := claims.String(oidcNameClaim)
+	if !userNameRegex.MatchString(name) {
+		return nil, errors.New("invalid user name in the '" + oidcNameClaim + "' claim: " + name)
+	}
+	return syncExternalUser(UserSourceOidc, claims.String("sub"), name, mapOidcRole(claims.Strings(oidcGroupClaim)))
+}
+
+// mapOidcRole returns the highest role of the groups, or the default role if no group is mapped
+func mapOidcRole(groups []string) string {
+	role := ""
+	for _, group := range groups {
+		if groupRole, ok := oidcGroupRoles[group]; ok && roleLevels[groupRole] > roleLevels[role] {
+			role = groupRole
+		}
+	}
+	if role == "" {
+		role = oidcDefaultRole
+	}
+	return role
+}
@@ -55,6 +55,29 @@ const (
 	OperationTypeDeleteApp
 	OperationTypeEditApp
 	OperationTypeRestorePlugin
+	OperationTypeAddUser
+	OperationTypeDeleteUser
+	OperationTypeUpdateUserRole
+	OperationTypeResetUserPassword
+	OperationTypeAddAlarmRule
+	OperationTypeUpdateAlarmRule
+	OperationTypeDeleteAlarmRule
+	OperationTypeStartPluginRollout
+	OperationTypeUpdatePluginRollout
+	OperationTypePromotePluginRollout
+	OperationTypeRollbackPluginRollout
+	OperationTypeUpdateRaspTags
+	OperationTypeAddRaspGroup
+	OperationTypeUpdateRaspGroup
+	OperationTypeDeleteRaspGroup
+	OperationTypeUpdatePluginSignature
+	OperationTypeRollbackConfig
+	OperationTypeExportApp
+	OperationTypeImportApp
+	OperationTypeResetUserTotp
+	OperationTypeLogin
+	OperationTypeLoginFailed
+	OperationTypeReplayAlarmSpool
 )
 
 func init() {
@@ -89,19 +112,7 @@ func init() {
 	}
 }
 
-func AddOperation(appId string, typeId int, ip string, content string, userName ...string) error {
-	var user string
-	var err error
-	if len(userName) == 0 {
-		user, err = GetLoginUserName()
-		if err != nil {
-			beego.Error("failed to add operation with content: " + content + ",can not get username: " + err.Error())
-			return err
-		}
-	} else {
-		user = userName[0]
-	}
-
+func AddOperation(appId string, typeId int, ip string, content string, user string) error {
 	var operation = &Operation{
 		AppId:   appId,
 		TypeId:  typeId,
@@ -111,7 +122,7 @@ func AddOperation(appId string, typeId int, ip string, content string, userName
 		Time:    time.Now().UnixNano() / 1000000,
 		Content: content,
 	}
-	err = mongo.Insert(operationCollectionName, operation)
+	err := mongo.Insert(operationCollectionName, operation)
 	if err != nil {
 		beego.Error("failed to add operation with content: " + operation.Content + ",error is: " + err.Error())
 	}
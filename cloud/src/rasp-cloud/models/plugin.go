@@ -33,6 +33,10 @@ import (
 	"bufio"
 	"bytes"
 	"github.com/robertkrimen/otto"
+	"rasp-cloud/tools/sandbox"
+	"rasp-cloud/tools/schema"
+	"rasp-cloud/tools/signature"
+	"golang.org/x/crypto/ed25519"
 )
 
 type Plugin struct {
@@ -45,6 +49,15 @@ type Plugin struct {
 	Content                string                 `json:"plugin,omitempty" bson:"content"`
 	DefaultAlgorithmConfig map[string]interface{} `bson:"default_algorithm_config"`
 	AlgorithmConfig        map[string]interface{} `json:"algorithm_config" bson:"algorithm_config"`
+	// the checks registered by the plugin in the sandbox
+	Checks   []sandbox.Check `json:"checks" bson:"checks"`
+	Hooks    []string        `json:"hooks" bson:"hooks"`
+	Warnings []string        `json:"warnings,omitempty" bson:"-"`
+	// the signature of uploaded plugin and the fingerprint of the trusted key which signs it
+	Signature   string `json:"signature,omitempty" bson:"signature,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" bson:"fingerprint,omitempty"`
+	// the content covered by the signature, the content is changed by the algorithm config later
+	SignedContent string `json:"-" bson:"signed_content,omitempty"`
 }
 
 const (
@@ -54,6 +67,10 @@ const (
 var (
 	mutex      sync.Mutex
 	MaxPlugins int
+	// the timeout of loading the plugin and running each check in the sandbox
+	pluginSandboxTimeout time.Duration
+	// the public keys trusted to sign the plugins
+	pluginTrustedKeys []ed25519.PublicKey
 )
 
 func init() {
@@ -65,6 +82,13 @@ func init() {
 	} else {
 		MaxPlugins = value
 	}
+	pluginSandboxTimeout = time.Duration(beego.AppConfig.DefaultInt("PluginSandboxTimeout", 5000)) *
+		time.Millisecond
+	keys, err := signature.ParsePublicKeys(beego.AppConfig.String("PluginTrustedKeys"))
+	if err != nil {
+		tools.Panic(tools.ErrCodeConfigInitFailed, "failed to parse the 'PluginTrustedKeys' config", err)
+	}
+	pluginTrustedKeys = keys
 	count, err := mongo.Count(pluginCollectionName)
 	if err != nil {
 		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get plugin collection count", err)
@@ -95,7 +119,26 @@ func init() {
 	}
 }
 
-func AddPlugin(pluginContent []byte, appId string) (plugin *Plugin, err error) {
+// AddPlugin adds the plugin to the app, the signature comment in content is used if pluginSignature is empty,
+// the plugin must be signed by a trusted key if the app requires signed plugins
+func AddPlugin(pluginContent []byte, pluginSignature string, appId string) (plugin *Plugin, err error) {
+	if pluginSignature == "" {
+		pluginContent, pluginSignature = signature.SplitComment(pluginContent)
+	}
+	var fingerprint string
+	if pluginSignature != "" {
+		if fingerprint, err = signature.Verify(pluginTrustedKeys, pluginContent, pluginSignature); err != nil {
+			return nil, errors.New("failed to verify the plugin signature: " + err.Error())
+		}
+	} else {
+		var app *App
+		if err = mongo.FindId(appCollectionName, appId, &app); err != nil {
+			return nil, err
+		}
+		if app.RequirePluginSignature {
+			return nil, errors.New("the app requires signed plugins, but the plugin is not signed")
+		}
+	}
 
 	pluginReader := bufio.NewReader(bytes.NewReader(pluginContent))
 	firstLine, err := pluginReader.ReadString('\n')
@@ -142,12 +185,25 @@ func AddPlugin(pluginContent []byte, appId string) (plugin *Plugin, err error) {
 	if err != nil {
 		return nil, errors.New("failed to unmarshal algorithm json data: " + err.Error())
 	}
-	return addPluginToDb(newVersion, newPluginName, pluginContent, appId, algorithmData)
+	box, err := sandbox.Load(pluginContent, pluginSandboxTimeout)
+	if err != nil {
+		return nil, errors.New("failed to load the plugin in sandbox: " + err.Error())
+	}
+	if err = box.Validate(); err != nil {
+		return nil, errors.New("failed to validate the plugin in sandbox: " + err.Error())
+	}
+	plugin, err = addPluginToDb(newVersion, newPluginName, pluginContent, appId, algorithmData,
+		box.Checks(), box.Hooks(), pluginSignature, fingerprint)
+	if err == nil {
+		plugin.Warnings = box.Warnings()
+	}
+	return
 
 }
 
 func addPluginToDb(version string, name string, content []byte, appId string,
-	defaultAlgorithmConfig map[string]interface{}) (plugin *Plugin, err error) {
+	defaultAlgorithmConfig map[string]interface{}, checks []sandbox.Check, hooks []string,
+	pluginSignature string, fingerprint string) (plugin *Plugin, err error) {
 	newMd5 := fmt.Sprintf("%x", md5.Sum(content))
 	plugin = &Plugin{
 		Id:                     generatePluginId(appId),
@@ -159,6 +215,13 @@ func addPluginToDb(version string, name string, content []byte, appId string,
 		AppId:                  appId,
 		DefaultAlgorithmConfig: defaultAlgorithmConfig,
 		AlgorithmConfig:        defaultAlgorithmConfig,
+		Checks:                 checks,
+		Hooks:                  hooks,
+		Signature:              pluginSignature,
+		Fingerprint:            fingerprint,
+	}
+	if pluginSignature != "" {
+		plugin.SignedContent = plugin.Content
 	}
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -197,58 +260,119 @@ func GetSelectedPlugin(appId string, hasContent bool) (plugin *Plugin, err error
 	return GetPluginById(app.SelectedPluginId, hasContent)
 }
 
+// SetSelectedPlugin selects the plugin for the app, it is rejected while a plugin rollout is running
+// because the rollout rolls back to the plugin selected when it starts
 func SetSelectedPlugin(appId string, pluginId string) error {
-	_, err := GetPluginById(pluginId, false)
+	if _, err := GetRunningPluginRollout(appId); err != mgo.ErrNotFound {
+		if err == nil {
+			return ErrPluginRolloutRunning
+		}
+		return err
+	}
+	return setSelectedPlugin(appId, pluginId)
+}
+
+func setSelectedPlugin(appId string, pluginId string) error {
+	plugin, err := GetPluginById(pluginId, false)
 	if err != nil {
 		return err
 	}
+	var app *App
+	if err = mongo.FindId(appCollectionName, appId, &app); err != nil {
+		return err
+	}
+	if err = checkPluginSignature(app, plugin); err != nil {
+		return err
+	}
 	return mongo.UpdateId(appCollectionName, appId, bson.M{"selected_plugin_id": pluginId})
 }
 
-func RestoreDefaultConfiguration(pluginId string) (appId string, err error) {
+// checkPluginSignature checks that the plugin is signed by a key which is still trusted
+// if the app requires signed plugins, the signature is verified on upload,
+// the later changes of algorithm config are not covered by it
+func checkPluginSignature(app *App, plugin *Plugin) error {
+	if !app.RequirePluginSignature {
+		return nil
+	}
+	if plugin.Fingerprint == "" {
+		return errors.New("the app requires signed plugins, but the plugin " + plugin.Id + " is not signed")
+	}
+	for _, fingerprint := range GetPluginTrustedKeys() {
+		if fingerprint == plugin.Fingerprint {
+			return nil
+		}
+	}
+	return errors.New("the key " + plugin.Fingerprint + " which signs the plugin " + plugin.Id +
+		" is not trusted any more")
+}
+
+// UpdatePluginSignatureConfig sets whether the app requires signed plugins,
+// the selected plugin must be signed before it is required
+func UpdatePluginSignatureConfig(appId string, required bool) (*App, error) {
+	if required {
+		if len(pluginTrustedKeys) == 0 {
+			return nil, signature.ErrNoTrustedKey
+		}
+		var app *App
+		if err := mongo.FindId(appCollectionName, appId, &app); err != nil {
+			return nil, err
+		}
+		if app.SelectedPluginId != "" {
+			plugin, err := GetPluginById(app.SelectedPluginId, false)
+			if err != nil {
+				return nil, err
+			}
+			app.RequirePluginSignature = true
+			if err = checkPluginSignature(app, plugin); err != nil {
+				return nil, errors.New("the selected plugin must be signed first: " + err.Error())
+			}
+		}
+	}
+	return UpdateAppById(appId, bson.M{"require_plugin_signature": required})
+}
+
+// GetPluginTrustedKeys returns the fingerprints of the trusted keys
+func GetPluginTrustedKeys() []string {
+	fingerprints := make([]string, 0, len(pluginTrustedKeys))
+	for _, key := range pluginTrustedKeys {
+		fingerprints = append(fingerprints, signature.Fingerprint(key))
+	}
+	return fingerprints
+}
+
+func RestoreDefaultConfiguration(pluginId string, user string) (appId string, err error) {
 	plugin, err := GetPluginById(pluginId, true)
 	if err != nil {
 		return "", err
 	}
-	return handleAlgorithmConfig(plugin, plugin.DefaultAlgorithmConfig)
+	return handleAlgorithmConfig(plugin, plugin.DefaultAlgorithmConfig, user, "restore the default config")
 }
 
-func UpdateAlgorithmConfig(pluginId string, config map[string]interface{}) (appId string, err error) {
+// UpdateAlgorithmConfig validates the config with the schema inferred from the default algorithm config,
+// the keys unknown to the default config are rejected unless allowUnknownKeys is true
+func UpdateAlgorithmConfig(pluginId string, config map[string]interface{},
+	allowUnknownKeys bool, user string) (appId string, err error) {
 	plugin, err := GetPluginById(pluginId, true)
 	if err != nil {
 		return "", err
 	}
-	if err := validAlgorithmConfig(plugin, config); err != nil {
+	if err := validAlgorithmConfig(plugin, config, allowUnknownKeys); err != nil {
 		return "", err
 	}
-	return handleAlgorithmConfig(plugin, config)
+	return handleAlgorithmConfig(plugin, config, user, "")
 }
 
-func validAlgorithmConfig(plugin *Plugin, config map[string]interface{}) error {
-	errMsg := "failed to match the new config format to default algorithm config format"
-	for key, defaultValue := range plugin.DefaultAlgorithmConfig {
-		if c, ok := config[key]; !ok || (c == nil && defaultValue != nil) {
-			return errors.New(errMsg + ", " + "can not find the key '" + key + "' in new config")
-		}
-		if defaultValue != nil {
-			if defaultItem, ok := defaultValue.(map[string]interface{}); ok {
-				if item, ok := config[key].(map[string]interface{}); ok {
-					for subKey := range defaultItem {
-						if _, ok := item[subKey]; !ok {
-							return errors.New(errMsg + ", " + "can not find the key '" +
-								key + "." + subKey + "' in new config")
-						}
-					}
-				} else {
-					return errors.New(errMsg + ", " + "the key '" + key + "' must be an object")
-				}
-			}
-		}
+func validAlgorithmConfig(plugin *Plugin, config map[string]interface{}, allowUnknownKeys bool) error {
+	err := schema.Infer(plugin.DefaultAlgorithmConfig).
+		Validate(config, &schema.Options{AllowUnknownKeys: allowUnknownKeys})
+	if err != nil {
+		return errors.New("invalid algorithm config: " + err.Error())
 	}
 	return nil
 }
 
-func handleAlgorithmConfig(plugin *Plugin, config map[string]interface{}) (appId string, err error) {
+func handleAlgorithmConfig(plugin *Plugin, config map[string]interface{}, user string,
+	comment string) (appId string, err error) {
 	content, err := json.MarshalIndent(config, "", "\t")
 	if err != nil {
 		return "", err
@@ -264,8 +388,25 @@ func handleAlgorithmConfig(plugin *Plugin, config map[string]interface{}) (appId
 	algorithmContent := regexp.MustCompile(regex).ReplaceAllString(plugin.Content, newContent)
 	newMd5 := fmt.Sprintf("%x", md5.Sum([]byte(algorithmContent)))
 	fmt.Println(algorithmContent)
-	return plugin.AppId, mongo.UpdateId(pluginCollectionName, plugin.Id, bson.M{"content": algorithmContent,
+	err = mongo.UpdateId(pluginCollectionName, plugin.Id, bson.M{"content": algorithmContent,
 		"algorithm_config": config, "md5": newMd5})
+	if err != nil {
+		return "", err
+	}
+	var before interface{}
+	if plugin.AlgorithmConfig != nil {
+		before = plugin.AlgorithmConfig
+	}
+	err = addConfigRevision(plugin.AppId, ConfigTypeAlgorithm, plugin.Id, before, config, user, comment)
+	if err != nil {
+		// every applied config has a revision, so the plugin is restored
+		if undoErr := mongo.UpdateId(pluginCollectionName, plugin.Id, bson.M{"content": plugin.Content,
+			"algorithm_config": plugin.AlgorithmConfig, "md5": plugin.Md5}); undoErr != nil {
+			err = errors.New(err.Error() + ", and failed to restore the plugin: " + undoErr.Error())
+		}
+		return "", err
+	}
+	return plugin.AppId, nil
 }
 
 func GetPluginById(id string, hasContent bool) (plugin *Plugin, err error) {
@@ -275,7 +416,7 @@ func GetPluginById(id string, hasContent bool) (plugin *Plugin, err error) {
 	if hasContent {
 		err = query.One(&plugin)
 	} else {
-		err = query.Select(bson.M{"content": 0}).One(&plugin)
+		err = query.Select(bson.M{"content": 0, "signed_content": 0}).One(&plugin)
 	}
 	return
 }
@@ -287,7 +428,8 @@ func GetPluginsByApp(appId string, skip int, limit int) (total int, plugins []Pl
 	if err != nil {
 		return
 	}
-	err = newSession.DB(mongo.DbName).C(pluginCollectionName).Find(bson.M{"app_id": appId}).Select(bson.M{"content": 0}).
+	err = newSession.DB(mongo.DbName).C(pluginCollectionName).Find(bson.M{"app_id": appId}).
+		Select(bson.M{"content": 0, "signed_content": 0}).
 		Sort("-upload_time").Skip(skip).Limit(limit).All(&plugins)
 	if plugins == nil {
 		plugins = make([]Plugin, 0)
@@ -0,0 +1,43 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"rasp-cloud/tools/diff"
+)
+
+// PluginDiff is the changes from the base plugin to the plugin
+type PluginDiff struct {
+	PluginId        string        `json:"plugin_id"`
+	BasePluginId    string        `json:"base_plugin_id"`
+	Content         string        `json:"content"`
+	AlgorithmConfig []diff.Change `json:"algorithm_config"`
+}
+
+// DiffPlugin returns the unified diff of content and the changed keys of algorithm config,
+// both plugins must have content
+func DiffPlugin(basePlugin *Plugin, plugin *Plugin, context int) *PluginDiff {
+	return &PluginDiff{
+		PluginId:     plugin.Id,
+		BasePluginId: basePlugin.Id,
+		Content: diff.Unified(pluginDiffName(basePlugin), pluginDiffName(plugin),
+			basePlugin.Content, plugin.Content, context),
+		AlgorithmConfig: diff.Objects(basePlugin.AlgorithmConfig, plugin.AlgorithmConfig),
+	}
+}
+
+func pluginDiffName(plugin *Plugin) string {
+	return plugin.Name + "-" + plugin.Version + " (" + plugin.Id + ")"
+}
@@ -0,0 +1,317 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"hash/crc32"
+	"rasp-cloud/models/logs"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"time"
+)
+
+// PluginRollout deploys the canary plugin to a part of the agents of the app,
+// the other agents keep using the selected plugin until the rollout is promoted
+type PluginRollout struct {
+	Id           string                  `json:"id" bson:"_id"`
+	AppId        string                  `json:"app_id" bson:"app_id"`
+	PluginId     string                  `json:"plugin_id" bson:"plugin_id"`
+	BasePluginId string                  `json:"base_plugin_id" bson:"base_plugin_id"`
+	Percent      int                     `json:"percent" bson:"percent"`
+	RaspIds      []string                `json:"rasp_ids" bson:"rasp_ids"`
+	Status       string                  `json:"status" bson:"status"`
+	StartTime    int64                   `json:"start_time" bson:"start_time"`
+	UpdateTime   int64                   `json:"update_time" bson:"update_time"`
+	History      []*PluginRolloutHistory `json:"history" bson:"history"`
+	// it is only set while the rollout is running, the unique index on it allows one running rollout per app
+	RunningAppId string `json:"-" bson:"running_app_id,omitempty"`
+}
+
+type PluginRolloutHistory struct {
+	User    string   `json:"user" bson:"user"`
+	Action  string   `json:"action" bson:"action"`
+	Percent int      `json:"percent" bson:"percent"`
+	RaspIds []string `json:"rasp_ids" bson:"rasp_ids"`
+	Time    int64    `json:"time" bson:"time"`
+}
+
+type PluginRolloutGroupStats struct {
+	PluginId    string `json:"plugin_id"`
+	RaspCount   int    `json:"rasp_count"`
+	OnlineCount int    `json:"online_count"`
+	AlarmCount  int64  `json:"alarm_count"`
+}
+
+const (
+	pluginRolloutCollectionName = "plugin_rollout"
+
+	PluginRolloutRunning    = "running"
+	PluginRolloutPromoted   = "promoted"
+	PluginRolloutRolledBack = "rolled_back"
+)
+
+var (
+	ErrNoRunningRollout     = errors.New("no running plugin rollout")
+	ErrPluginRolloutRunning = errors.New("the plugin rollout of the app is running, please promote or roll back it first")
+)
+
+func init() {
+	index := &mgo.Index{
+		Key:        []string{"app_id", "status"},
+		Unique:     false,
+		Background: true,
+		Name:       "app_id_status",
+	}
+	err := mongo.CreateIndex(pluginRolloutCollectionName, index)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create app_id_status index for plugin_rollout collection",
+			err)
+	}
+	// the running rollouts of the old version have no running_app_id
+	var rollouts []*PluginRollout
+	_, err = mongo.FindAll(pluginRolloutCollectionName, bson.M{"status": PluginRolloutRunning,
+		"running_app_id": bson.M{"$exists": false}}, &rollouts, 0, 0)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get the running plugin rollouts", err)
+	}
+	for _, rollout := range rollouts {
+		if err = mongo.UpdateId(pluginRolloutCollectionName, rollout.Id,
+			bson.M{"running_app_id": rollout.AppId}); err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to set running_app_id of plugin rollout", err)
+		}
+	}
+	index = &mgo.Index{
+		Key:        []string{"running_app_id"},
+		Unique:     true,
+		Sparse:     true,
+		Background: true,
+		Name:       "running_app_id",
+	}
+	err = mongo.CreateIndex(pluginRolloutCollectionName, index)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed,
+			"failed to create running_app_id index for plugin_rollout collection", err)
+	}
+}
+
+func handlePluginRollout(rollout *PluginRollout) {
+	if rollout.RaspIds == nil {
+		rollout.RaspIds = make([]string, 0)
+	}
+	if rollout.History == nil {
+		rollout.History = make([]*PluginRolloutHistory, 0)
+	}
+}
+
+// GetRunningPluginRollout returns the running rollout of the app, the error is mgo.ErrNotFound if there is none
+func GetRunningPluginRollout(appId string) (rollout *PluginRollout, err error) {
+	err = mongo.FindOne(pluginRolloutCollectionName, bson.M{"app_id": appId, "status": PluginRolloutRunning},
+		&rollout)
+	if err == nil {
+		handlePluginRollout(rollout)
+	}
+	return
+}
+
+func GetPluginRollouts(appId string, page int, perpage int) (count int, result []*PluginRollout, err error) {
+	count, err = mongo.FindAll(pluginRolloutCollectionName, bson.M{"app_id": appId}, &result,
+		perpage*(page-1), perpage, "-start_time")
+	if err == nil {
+		for _, rollout := range result {
+			handlePluginRollout(rollout)
+		}
+	}
+	if result == nil {
+		result = make([]*PluginRollout, 0)
+	}
+	return
+}
+
+func StartPluginRollout(appId string, pluginId string, percent int, raspIds []string,
+	user string) (*PluginRollout, error) {
+	if _, err := GetRunningPluginRollout(appId); err != mgo.ErrNotFound {
+		if err == nil {
+			return nil, ErrPluginRolloutRunning
+		}
+		return nil, err
+	}
+	var app *App
+	if err := mongo.FindId(appCollectionName, appId, &app); err != nil {
+		return nil, err
+	}
+	if app.SelectedPluginId == pluginId {
+		return nil, errors.New("the plugin is selected by the app already")
+	}
+	plugin, err := GetPluginById(pluginId, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkPluginSignature(app, plugin); err != nil {
+		return nil, err
+	}
+	if raspIds == nil {
+		raspIds = make([]string, 0)
+	}
+	now := time.Now().UnixNano() / 1000000
+	rollout := &PluginRollout{
+		Id:           mongo.GenerateObjectId(),
+		AppId:        appId,
+		PluginId:     pluginId,
+		BasePluginId: app.SelectedPluginId,
+		Percent:      percent,
+		RaspIds:      raspIds,
+		Status:       PluginRolloutRunning,
+		StartTime:    now,
+		UpdateTime:   now,
+		History: []*PluginRolloutHistory{
+			{User: user, Action: "start", Percent: percent, RaspIds: raspIds, Time: now},
+		},
+		RunningAppId: appId,
+	}
+	// the rollout started by another request at the same time is rejected by the unique index
+	if err = mongo.Insert(pluginRolloutCollectionName, rollout); err != nil {
+		if mgo.IsDup(err) {
+			return nil, ErrPluginRolloutRunning
+		}
+		return nil, err
+	}
+	return rollout, nil
+}
+
+func UpdatePluginRollout(appId string, percent int, raspIds []string, user string) (*PluginRollout, error) {
+	if raspIds == nil {
+		raspIds = make([]string, 0)
+	}
+	return changePluginRollout(appId, "update", bson.M{"percent": percent, "rasp_ids": raspIds},
+		&PluginRolloutHistory{User: user, Action: "update", Percent: percent, RaspIds: raspIds})
+}
+
+// PromotePluginRollout selects the canary plugin for all agents of the app
+func PromotePluginRollout(appId string, user string) (*PluginRollout, error) {
+	rollout, err := GetRunningPluginRollout(appId)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrNoRunningRollout
+		}
+		return nil, err
+	}
+	if err = setSelectedPlugin(appId, rollout.PluginId); err != nil {
+		return nil, err
+	}
+	return changePluginRollout(appId, "promote", bson.M{"status": PluginRolloutPromoted},
+		&PluginRolloutHistory{User: user, Action: "promote", Percent: 100})
+}
+
+// RollbackPluginRollout stops the rollout, the agents with the canary plugin go back to the selected plugin
+func RollbackPluginRollout(appId string, user string) (*PluginRollout, error) {
+	return changePluginRollout(appId, "rollback", bson.M{"status": PluginRolloutRolledBack},
+		&PluginRolloutHistory{User: user, Action: "rollback"})
+}
+
+func changePluginRollout(appId string, action string, set bson.M,
+	history *PluginRolloutHistory) (*PluginRollout, error) {
+	now := time.Now().UnixNano() / 1000000
+	set["update_time"] = now
+	history.Time = now
+	if history.RaspIds == nil {
+		history.RaspIds = make([]string, 0)
+	}
+	update := bson.M{"$set": set, "$push": bson.M{"history": history}}
+	if status, ok := set["status"]; ok && status != PluginRolloutRunning {
+		update["$unset"] = bson.M{"running_app_id": ""}
+	}
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	var rollout *PluginRollout
+	_, err := newSession.DB(mongo.DbName).C(pluginRolloutCollectionName).
+		Find(bson.M{"app_id": appId, "status": PluginRolloutRunning}).
+		Apply(mgo.Change{
+			Update:    update,
+			ReturnNew: true,
+		}, &rollout)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNoRunningRollout
+	}
+	if err != nil {
+		return nil, errors.New("failed to " + action + " the plugin rollout: " + err.Error())
+	}
+	handlePluginRollout(rollout)
+	return rollout, nil
+}
+
+func RemovePluginRolloutByAppId(appId string) error {
+	return mongo.RemoveAll(pluginRolloutCollectionName, bson.M{"app_id": appId})
+}
+
+// IsCanaryRasp checks whether the agent gets the canary plugin,
+// the agents are bucketed by the hash of rollout id and rasp id, so the bucket is stable in a rollout
+func (rollout *PluginRollout) IsCanaryRasp(raspId string) bool {
+	for _, id := range rollout.RaspIds {
+		if id == raspId {
+			return true
+		}
+	}
+	return int(crc32.ChecksumIEEE([]byte(rollout.Id+raspId))%100) < rollout.Percent
+}
+
+// GetPluginForRasp returns the plugin for the agent, it is the canary plugin if the agent is in the running rollout
+func GetPluginForRasp(appId string, raspId string, hasContent bool) (*Plugin, error) {
+	rollout, err := GetRunningPluginRollout(appId)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	if rollout != nil && rollout.IsCanaryRasp(raspId) {
+		plugin, err := GetPluginById(rollout.PluginId, hasContent)
+		// the canary plugin that has been removed is ignored
+		if err != mgo.ErrNotFound {
+			return plugin, err
+		}
+	}
+	return GetSelectedPlugin(appId, hasContent)
+}
+
+// GetPluginRolloutStats returns the stats of the agents in the canary and base group since the rollout started
+func GetPluginRolloutStats(rollout *PluginRollout) (map[string]*PluginRolloutGroupStats, error) {
+	var rasps []*Rasp
+	_, err := mongo.FindAll(raspCollectionName, bson.M{"app_id": rollout.AppId}, &rasps, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	alarmCounts, err := logs.AggregationAttackWithRaspId(rollout.StartTime, time.Now().UnixNano()/1000000,
+		rollout.AppId)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]*PluginRolloutGroupStats{
+		"canary": {PluginId: rollout.PluginId},
+		"base":   {PluginId: rollout.BasePluginId},
+	}
+	for _, rasp := range rasps {
+		HandleRasp(rasp)
+		group := result["base"]
+		if rollout.IsCanaryRasp(rasp.Id) {
+			group = result["canary"]
+		}
+		group.RaspCount++
+		if rasp.Online != nil && *rasp.Online {
+			group.OnlineCount++
+		}
+		group.AlarmCount += alarmCounts[rasp.Id]
+	}
+	return result, nil
+}
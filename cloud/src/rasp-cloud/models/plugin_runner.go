@@ -0,0 +1,137 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"rasp-cloud/models/logs"
+	"rasp-cloud/tools/sandbox"
+)
+
+// PluginTestReport is the decisions of the plugin on the check events,
+// they are compared with the decisions of the base plugin if it is set
+type PluginTestReport struct {
+	PluginId     string                    `json:"plugin_id"`
+	BasePluginId string                    `json:"base_plugin_id"`
+	Total        int                       `json:"total"`
+	Changed      int                       `json:"changed"`
+	Summary      map[string]map[string]int `json:"summary"`
+	Events       []*PluginTestEvent        `json:"events"`
+}
+
+type PluginTestEvent struct {
+	Id         string               `json:"id"`
+	Hook       string               `json:"hook"`
+	Url        string               `json:"url"`
+	Result     *sandbox.EventResult `json:"result"`
+	BaseResult *sandbox.EventResult `json:"base_result,omitempty"`
+	Changed    bool                 `json:"changed"`
+}
+
+const (
+	pluginTestSummaryError = "error"
+)
+
+// GetPluginTestEvents rebuilds the check events from the latest attack alarms of the app,
+// the alarms without attack_params are skipped
+func GetPluginTestEvents(app *App, startTime int64, endTime int64, attackTypes []string,
+	size int) ([]*sandbox.Event, error) {
+	_, alarms, err := logs.SearchAttackWithFilter(startTime, endTime,
+		&logs.AttackFilter{AttackTypes: attackTypes}, size, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*sandbox.Event, 0, len(alarms))
+	for _, alarm := range alarms {
+		if event, err := sandbox.EventFromAlarm(alarm, app.Language); err == nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// RunPluginTest runs the plugin and the base plugin over the events in sandbox, basePlugin can be nil
+func RunPluginTest(plugin *Plugin, basePlugin *Plugin, events []*sandbox.Event) (*PluginTestReport, error) {
+	report := &PluginTestReport{
+		PluginId: plugin.Id,
+		Total:    len(events),
+		Summary:  map[string]map[string]int{"plugin": newPluginTestSummary()},
+		Events:   make([]*PluginTestEvent, 0, len(events)),
+	}
+	box, err := loadPluginSandbox(plugin)
+	if err != nil {
+		return nil, err
+	}
+	var baseBox *sandbox.Sandbox
+	if basePlugin != nil {
+		report.BasePluginId = basePlugin.Id
+		report.Summary["base_plugin"] = newPluginTestSummary()
+		if baseBox, err = loadPluginSandbox(basePlugin); err != nil {
+			return nil, err
+		}
+	}
+	for _, event := range events {
+		url, _ := event.Context["url"].(string)
+		testEvent := &PluginTestEvent{Id: event.Id, Hook: event.Hook, Url: url}
+		if testEvent.Result, err = runPluginTestEvent(box, event, report.Summary["plugin"]); err != nil {
+			return nil, errors.New("failed to run plugin " + plugin.Id + ": " + err.Error())
+		}
+		if baseBox != nil {
+			testEvent.BaseResult, err = runPluginTestEvent(baseBox, event, report.Summary["base_plugin"])
+			if err != nil {
+				return nil, errors.New("failed to run plugin " + basePlugin.Id + ": " + err.Error())
+			}
+			if testEvent.Result.Action != testEvent.BaseResult.Action {
+				testEvent.Changed = true
+				report.Changed++
+			}
+		}
+		report.Events = append(report.Events, testEvent)
+	}
+	return report, nil
+}
+
+func loadPluginSandbox(plugin *Plugin) (*sandbox.Sandbox, error) {
+	box, err := sandbox.Load([]byte(plugin.Content), pluginSandboxTimeout)
+	if err != nil {
+		return nil, errors.New("failed to load plugin " + plugin.Id + " in sandbox: " + err.Error())
+	}
+	return box, nil
+}
+
+func runPluginTestEvent(box *sandbox.Sandbox, event *sandbox.Event,
+	summary map[string]int) (*sandbox.EventResult, error) {
+	result, err := box.Run(event)
+	if err != nil {
+		return nil, err
+	}
+	summary[result.Action]++
+	for _, item := range result.Results {
+		if item.Error != "" {
+			summary[pluginTestSummaryError]++
+			break
+		}
+	}
+	return result, nil
+}
+
+func newPluginTestSummary() map[string]int {
+	return map[string]int{
+		sandbox.ActionBlock:    0,
+		sandbox.ActionLog:      0,
+		sandbox.ActionIgnore:   0,
+		pluginTestSummaryError: 0,
+	}
+}
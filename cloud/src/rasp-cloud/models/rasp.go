@@ -39,10 +39,17 @@ type Rasp struct {
 	Online            *bool  `json:"online" bson:"online,omitempty"`
 	LastHeartbeatTime int64  `json:"last_heartbeat_time" bson:"last_heartbeat_time,omitempty"`
 	RegisterTime      int64  `json:"register_time" bson:"register_time,omitempty"`
+	OfflineNotified   bool   `json:"-" bson:"offline_notified,omitempty"`
+	// the labels are sent by the agent at registration, the tags are managed by the api
+	Labels []string `json:"labels" bson:"labels,omitempty"`
+	Tags   []string `json:"tags" bson:"tags,omitempty"`
 }
 
 const (
 	raspCollectionName = "rasp"
+	// the rasp is considered to be offline if no heartbeat is received
+	// within heartbeat_interval + raspOfflineGrace seconds
+	raspOfflineGrace = 180
 )
 
 func init() {
@@ -74,6 +81,15 @@ func UpsertRaspById(id string, rasp *Rasp) (error) {
 	return mongo.UpsertId(raspCollectionName, id, rasp)
 }
 
+// UpdateRaspHeartbeat only sets the heartbeat fields, so that the tags set by the api at the same time are kept
+func UpdateRaspHeartbeat(id string, pluginVersion string, heartbeatTime int64) error {
+	update := bson.M{"last_heartbeat_time": heartbeatTime}
+	if pluginVersion != "" {
+		update["plugin_version"] = pluginVersion
+	}
+	return mongo.UpdateId(raspCollectionName, id, update)
+}
+
 func GetRaspByAppId(id string, page int, perpage int) (count int, result []*Rasp, err error) {
 	count, err = mongo.FindAll(raspCollectionName, bson.M{"app_id": id}, &result, perpage*(page-1), perpage)
 	if err == nil {
@@ -116,24 +132,27 @@ func FindRasp(selector *Rasp, page int, perpage int) (count int, result []*Rasp,
 		}
 		delete(bsonModel, "hostname")
 	}
+	// the agent is matched if it has all of the tags, either as tag or as label
+	delete(bsonModel, "labels")
+	delete(bsonModel, "tags")
+	if len(selector.Tags) > 0 {
+		tagConditions := make([]bson.M, 0, len(selector.Tags))
+		for _, tag := range selector.Tags {
+			tagConditions = append(tagConditions, bson.M{"$or": []bson.M{{"tags": tag}, {"labels": tag}}})
+		}
+		bsonModel["$and"] = tagConditions
+	}
 	if selector.Online != nil {
 		delete(bsonModel, "online")
-		if *selector.Online {
-			bsonModel["$where"] = "this.last_heartbeat_time+this.heartbeat_interval+180 >= " +
-				strconv.FormatInt(time.Now().Unix(), 10)
-		} else {
-			bsonModel["$where"] = "this.last_heartbeat_time+this.heartbeat_interval+180 < " +
-				strconv.FormatInt(time.Now().Unix(), 10)
-		}
+		bsonModel["$where"] = raspOnlineCondition(*selector.Online)
 	}
 	count, err = mongo.FindAllBySort(raspCollectionName, bsonModel, perpage*(page-1), perpage,
 		&result, "-register_time")
 	if err == nil {
 		for _, rasp := range result {
+			HandleRasp(rasp)
 			if selector.Online != nil {
 				rasp.Online = selector.Online
-			} else {
-				HandleRasp(rasp)
 			}
 		}
 	}
@@ -148,15 +167,69 @@ func GetRaspById(id string) (rasp *Rasp, err error) {
 	return
 }
 
+func raspOnlineCondition(online bool) string {
+	operator := " >= "
+	if !online {
+		operator = " < "
+	}
+	return "this.last_heartbeat_time+this.heartbeat_interval+" + strconv.Itoa(raspOfflineGrace) +
+		operator + strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+// FindRaspForOfflineAlarm returns the rasps which have gone offline but have not been notified yet
+// when online is false, otherwise the rasps which have been notified offline but come back online
+func FindRaspForOfflineAlarm(online bool) (result []*Rasp, err error) {
+	query := bson.M{"$where": raspOnlineCondition(online)}
+	if online {
+		query["offline_notified"] = true
+	} else {
+		query["offline_notified"] = bson.M{"$ne": true}
+	}
+	_, err = mongo.FindAll(raspCollectionName, query, &result, 0, 0)
+	if err == nil {
+		for _, rasp := range result {
+			HandleRasp(rasp)
+		}
+	}
+	return
+}
+
+func SetRaspOfflineNotified(ids []string, notified bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var update bson.M
+	if notified {
+		update = bson.M{"$set": bson.M{"offline_notified": true}}
+	} else {
+		update = bson.M{"$unset": bson.M{"offline_notified": ""}}
+	}
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	_, err := newSession.DB(mongo.DbName).C(raspCollectionName).UpdateAll(bson.M{"_id": bson.M{"$in": ids}}, update)
+	return err
+}
+
+// GetRaspExpiredTime returns the time when the rasp is considered to be offline
+func GetRaspExpiredTime(rasp *Rasp) int64 {
+	return rasp.LastHeartbeatTime + rasp.HeartbeatInterval + raspOfflineGrace
+}
+
 func HandleRasp(rasp *Rasp) {
 	var online bool
-	heartbeatInterval := rasp.HeartbeatInterval + 180
+	heartbeatInterval := rasp.HeartbeatInterval + raspOfflineGrace
 	if time.Now().Unix()-rasp.LastHeartbeatTime > heartbeatInterval {
 		online = false
 	} else {
 		online = true
 	}
 	rasp.Online = &online
+	if rasp.Labels == nil {
+		rasp.Labels = make([]string, 0)
+	}
+	if rasp.Tags == nil {
+		rasp.Tags = make([]string, 0)
+	}
 }
 
 func RemoveRaspById(id string) (err error) {
@@ -0,0 +1,258 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RaspGroup selects the agents of the app by tags, the selected agents get the app config
+// merged with the overrides of the group
+type RaspGroup struct {
+	Id    string `json:"id" bson:"_id"`
+	AppId string `json:"app_id" bson:"app_id"`
+	Name  string `json:"name" bson:"name"`
+	// the agent is selected if it has all of the tags, the labels sent at registration are matched as tags
+	Selector []string `json:"selector" bson:"selector"`
+	// the overrides of the group with higher priority take precedence
+	Priority        int                    `json:"priority" bson:"priority"`
+	GeneralConfig   map[string]interface{} `json:"general_config" bson:"general_config"`
+	WhitelistConfig []WhitelistConfigItem  `json:"whitelist_config" bson:"whitelist_config"`
+	CreateTime      int64                  `json:"create_time" bson:"create_time"`
+	UpdateTime      int64                  `json:"update_time" bson:"update_time"`
+}
+
+const (
+	raspGroupCollectionName = "rasp_group"
+
+	RaspTagsModeAdd    = "add"
+	RaspTagsModeRemove = "remove"
+	RaspTagsModeSet    = "set"
+
+	MaxRaspTagCount  = 64
+	MaxRaspTagLength = 128
+)
+
+func init() {
+	index := &mgo.Index{
+		Key:        []string{"app_id"},
+		Unique:     false,
+		Background: true,
+		Name:       "app_id",
+	}
+	err := mongo.CreateIndex(raspGroupCollectionName, index)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create app_id index for rasp_group collection", err)
+	}
+}
+
+func handleRaspGroup(group *RaspGroup) {
+	if group.Selector == nil {
+		group.Selector = make([]string, 0)
+	}
+	if group.GeneralConfig == nil {
+		group.GeneralConfig = make(map[string]interface{})
+	}
+	if group.WhitelistConfig == nil {
+		group.WhitelistConfig = make([]WhitelistConfigItem, 0)
+	}
+}
+
+func AddRaspGroup(group *RaspGroup) (*RaspGroup, error) {
+	group.Id = mongo.GenerateObjectId()
+	group.CreateTime = time.Now().UnixNano() / 1000000
+	group.UpdateTime = group.CreateTime
+	handleRaspGroup(group)
+	if err := mongo.Insert(raspGroupCollectionName, group); err != nil {
+		return nil, err
+	}
+	return group, touchAppConfig(group.AppId)
+}
+
+func UpdateRaspGroup(group *RaspGroup) (*RaspGroup, error) {
+	handleRaspGroup(group)
+	err := mongo.UpdateId(raspGroupCollectionName, group.Id, bson.M{
+		"name":             group.Name,
+		"selector":         group.Selector,
+		"priority":         group.Priority,
+		"general_config":   group.GeneralConfig,
+		"whitelist_config": group.WhitelistConfig,
+		"update_time":      time.Now().UnixNano() / 1000000,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if group, err = GetRaspGroupById(group.Id); err != nil {
+		return nil, err
+	}
+	return group, touchAppConfig(group.AppId)
+}
+
+func GetRaspGroupById(id string) (group *RaspGroup, err error) {
+	err = mongo.FindId(raspGroupCollectionName, id, &group)
+	if err == nil && group != nil {
+		handleRaspGroup(group)
+	}
+	return
+}
+
+// GetRaspGroupsByApp returns all groups of the app in the order of ascending priority
+func GetRaspGroupsByApp(appId string) (result []*RaspGroup, err error) {
+	_, err = mongo.FindAll(raspGroupCollectionName, bson.M{"app_id": appId}, &result, 0, 0,
+		"priority", "create_time")
+	if err == nil {
+		for _, group := range result {
+			handleRaspGroup(group)
+		}
+	}
+	if result == nil {
+		result = make([]*RaspGroup, 0)
+	}
+	return
+}
+
+func RemoveRaspGroupById(id string) (group *RaspGroup, err error) {
+	group, err = GetRaspGroupById(id)
+	if err != nil {
+		return
+	}
+	if err = mongo.RemoveId(raspGroupCollectionName, id); err != nil {
+		return
+	}
+	return group, touchAppConfig(group.AppId)
+}
+
+func RemoveRaspGroupByAppId(appId string) error {
+	return mongo.RemoveAll(raspGroupCollectionName, bson.M{"app_id": appId})
+}
+
+// SetRaspTags changes the tags of the agents of the app, it returns the count of the changed agents
+func SetRaspTags(appId string, raspIds []string, tags []string, mode string) (int, error) {
+	var update bson.M
+	switch mode {
+	case RaspTagsModeAdd:
+		update = bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": tags}}}
+	case RaspTagsModeRemove:
+		update = bson.M{"$pull": bson.M{"tags": bson.M{"$in": tags}}}
+	case RaspTagsModeSet:
+		update = bson.M{"$set": bson.M{"tags": tags}}
+	default:
+		return 0, errors.New("unknown mode of tags: " + mode)
+	}
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	info, err := newSession.DB(mongo.DbName).C(raspCollectionName).
+		UpdateAll(bson.M{"app_id": appId, "_id": bson.M{"$in": raspIds}}, update)
+	if err != nil {
+		return 0, err
+	}
+	// the agents fetch the config of their new groups with the next heartbeat
+	return info.Updated, touchAppConfig(appId)
+}
+
+// TouchRaspLabels makes the agents of the app fetch the config again if the labels of the agent change,
+// the groups are matched by the labels as well as the tags
+func TouchRaspLabels(appId string, oldLabels []string, labels []string) error {
+	if labelSet(oldLabels) == labelSet(labels) {
+		return nil
+	}
+	return touchAppConfig(appId)
+}
+
+func labelSet(labels []string) string {
+	set := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		set[label] = true
+	}
+	sorted := make([]string, 0, len(set))
+	for label := range set {
+		sorted = append(sorted, label)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, "\x00")
+}
+
+// touchAppConfig makes the agents of the app fetch the config again
+func touchAppConfig(appId string) error {
+	return mongo.UpdateId(appCollectionName, appId, bson.M{"config_time": time.Now().UnixNano()})
+}
+
+// Match checks whether the agent has all tags of the selector, the group with empty selector matches nothing
+func (group *RaspGroup) Match(rasp *Rasp) bool {
+	if len(group.Selector) == 0 {
+		return false
+	}
+	tags := make(map[string]bool, len(rasp.Tags)+len(rasp.Labels))
+	for _, tag := range rasp.Tags {
+		tags[tag] = true
+	}
+	for _, label := range rasp.Labels {
+		tags[label] = true
+	}
+	for _, tag := range group.Selector {
+		if !tags[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetRaspEffectiveConfig returns the config of the agent and the groups it belongs to,
+// the general config of the app is overridden by the groups in the order of ascending priority,
+// and the whitelist of the groups is merged into the whitelist of the app
+func GetRaspEffectiveConfig(app *App, rasp *Rasp) (generalConfig map[string]interface{},
+	whitelistConfig []WhitelistConfigItem, matched []*RaspGroup, err error) {
+	groups, err := GetRaspGroupsByApp(app.Id)
+	if err != nil {
+		return
+	}
+	generalConfig, whitelistConfig, matched = MergeRaspGroupConfig(app, rasp, groups)
+	return
+}
+
+// MergeRaspGroupConfig merges the config of the groups which match the agent into the copy of app config
+func MergeRaspGroupConfig(app *App, rasp *Rasp, groups []*RaspGroup) (map[string]interface{},
+	[]WhitelistConfigItem, []*RaspGroup) {
+	matched := make([]*RaspGroup, 0)
+	for _, group := range groups {
+		if group.Match(rasp) {
+			matched = append(matched, group)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Priority < matched[j].Priority
+	})
+	generalConfig := make(map[string]interface{}, len(app.GeneralConfig))
+	for key, value := range app.GeneralConfig {
+		generalConfig[key] = value
+	}
+	whitelistConfig := append(make([]WhitelistConfigItem, 0, len(app.WhitelistConfig)), app.WhitelistConfig...)
+	for _, group := range matched {
+		for key, value := range group.GeneralConfig {
+			generalConfig[key] = value
+		}
+		for i := range group.WhitelistConfig {
+			whitelistConfig, _ = MergeWhitelistConfig(whitelistConfig, &group.WhitelistConfig[i])
+		}
+	}
+	return generalConfig, whitelistConfig, matched
+}
@@ -15,46 +15,195 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
+	"io"
 	"rasp-cloud/mongo"
+	"rasp-cloud/tools"
+	"rasp-cloud/tools/tokenscope"
+	"time"
 )
 
+// Token is the api token, only the sha256 of the secret is stored and the secret is shown once on creation
 type Token struct {
-	Token       string `json:"token" bson:"_id"`
-	Description string `json:"description" bson:"description"`
+	Id          string   `json:"id" bson:"_id"`
+	Token       string   `json:"token,omitempty" bson:"-"`
+	Prefix      string   `json:"prefix" bson:"prefix"`
+	Description string   `json:"description" bson:"description"`
+	Scopes      []string `json:"scopes" bson:"scopes"`
+	// the token is limited to these apps, it is empty for all apps
+	AppIds []string `json:"app_ids" bson:"app_ids"`
+	// 0 means the token never expires
+	ExpireTime   int64  `json:"expire_time" bson:"expire_time"`
+	CreateTime   int64  `json:"create_time" bson:"create_time"`
+	CreateUser   string `json:"create_user" bson:"create_user"`
+	LastUsedTime int64  `json:"last_used_time" bson:"last_used_time"`
+	LastUsedIp   string `json:"last_used_ip" bson:"last_used_ip"`
 }
 
 const (
 	tokenCollectionName = "token"
 	AuthTokenName       = "X-OpenRASP-Token"
+	// the app which the alarm_ingest token reports alarms for
+	IngestAppIdKey  = "ingest_app_id"
+	tokenSecretSize = 32
+	// the last used time is updated at most once in this interval
+	tokenTouchInterval = time.Minute
+
+	TokenScopeAdmin        = tokenscope.ScopeAdmin
+	TokenScopeReadOnly     = tokenscope.ScopeReadOnly
+	TokenScopePluginDeploy = tokenscope.ScopePluginDeploy
+	TokenScopeAlarmIngest  = tokenscope.ScopeAlarmIngest
 )
 
+func init() {
+	// the tokens of the old version are stored in plaintext as the id and have the administrator role
+	var tokens []*Token
+	_, err := mongo.FindAll(tokenCollectionName, bson.M{"scopes": bson.M{"$exists": false}}, &tokens, 0, 0)
+	if err != nil {
+		tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get the tokens to be hashed", err)
+	}
+	for _, token := range tokens {
+		secret := token.Id
+		token.Id = tokenscope.Hash(secret)
+		token.Prefix = tokenscope.Prefix(secret)
+		token.Scopes = []string{TokenScopeAdmin}
+		if err = mongo.UpsertId(tokenCollectionName, token.Id, token); err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to hash the token "+token.Prefix, err)
+		}
+		if err = mongo.RemoveId(tokenCollectionName, secret); err != nil {
+			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to remove the plaintext token "+token.Prefix, err)
+		}
+	}
+}
+
 func GetAllToken(page int, perpage int) (count int, result []*Token, err error) {
-	count, err = mongo.FindAll(tokenCollectionName, nil, &result, perpage*(page-1), perpage)
+	count, err = mongo.FindAll(tokenCollectionName, nil, &result, perpage*(page-1), perpage, "-create_time")
 	return
 }
 
-func HasToken(token string) (bool, error) {
-	var result *Token
-	err := mongo.FindId(tokenCollectionName, token, &result)
-	if err != nil || result == nil {
-		return false, err
+func IsValidTokenScope(scope string) bool {
+	return tokenscope.IsValid(scope)
+}
+
+// GetUserByToken returns the user which the api token acts as for the path, the role of the user is
+// the highest one of the token scopes that allow the path, and it is limited to the apps of the token
+func GetUserByToken(secret string, path string, ip string) (*User, error) {
+	token, err := getValidToken(secret, ip)
+	if err != nil {
+		return nil, err
+	}
+	role := tokenscope.Role(token.Scopes, path, len(token.AppIds) > 0)
+	if role == "" {
+		return nil, errors.New("the token has no scope for " + path)
 	}
-	return true, err
+	user := &User{Name: "token:" + token.Prefix, AppRoles: make(map[string]string)}
+	if len(token.AppIds) == 0 {
+		user.Role = role
+	} else {
+		for _, appId := range token.AppIds {
+			user.AppRoles[appId] = role
+		}
+	}
+	return user, nil
 }
 
+// VerifyIngestToken checks that the token is allowed to report the alarms of the app to the path
+func VerifyIngestToken(secret string, appId string, path string, ip string) error {
+	token, err := getValidToken(secret, ip)
+	if err != nil {
+		return err
+	}
+	allowed := false
+	for _, scope := range token.Scopes {
+		allowed = allowed || (scope == TokenScopeAlarmIngest && tokenscope.Allows(scope, path))
+	}
+	if !allowed {
+		return errors.New("the token has no scope for " + path)
+	}
+	if len(token.AppIds) == 0 {
+		return nil
+	}
+	for _, id := range token.AppIds {
+		if id == appId {
+			return nil
+		}
+	}
+	return errors.New("the token has no access to app " + appId)
+}
+
+// AddToken generates the secret of the token, the secret is only returned by this call
 func AddToken(token *Token) (result *Token, err error) {
-	if token.Token == "" {
-		token.Token = generateOperationId()
+	if len(token.Scopes) == 0 {
+		return nil, errors.New("the token scopes can not be empty")
+	}
+	for _, scope := range token.Scopes {
+		if !IsValidTokenScope(scope) {
+			return nil, errors.New("invalid token scope: " + scope)
+		}
 	}
-	err = mongo.UpsertId(tokenCollectionName, token.Token, token)
+	now := time.Now().UnixNano() / 1000000
+	if token.ExpireTime != 0 && token.ExpireTime <= now {
+		return nil, errors.New("the expire_time of the token must be in the future")
+	}
+	data := make([]byte, tokenSecretSize)
+	if _, err = io.ReadFull(rand.Reader, data); err != nil {
+		return nil, err
+	}
+	token.Token = hex.EncodeToString(data)
+	token.Id = tokenscope.Hash(token.Token)
+	token.Prefix = tokenscope.Prefix(token.Token)
+	token.CreateTime = now
+	token.LastUsedTime = 0
+	token.LastUsedIp = ""
+	if token.AppIds == nil {
+		token.AppIds = []string{}
+	}
+	err = mongo.Insert(tokenCollectionName, token)
 	result = token
 	return
 }
 
+// RemoveToken removes the token by its id, the secret of the token is accepted as well
 func RemoveToken(tokenId string) (token *Token, err error) {
 	err = mongo.FindId(tokenCollectionName, tokenId, &token)
 	if err != nil {
-		return
+		tokenId = tokenscope.Hash(tokenId)
+		if err = mongo.FindId(tokenCollectionName, tokenId, &token); err != nil {
+			return
+		}
 	}
 	return token, mongo.RemoveId(tokenCollectionName, tokenId)
 }
+
+// GetTokenId returns the id of the token secret
+func GetTokenId(secret string) string {
+	return tokenscope.Hash(secret)
+}
+
+func getValidToken(secret string, ip string) (*Token, error) {
+	if secret == "" {
+		return nil, errors.New("the token can not be empty")
+	}
+	var token *Token
+	err := mongo.FindId(tokenCollectionName, tokenscope.Hash(secret), &token)
+	if err != nil || token == nil {
+		return nil, errors.New("the token does not exist")
+	}
+	now := time.Now()
+	nowMillis := now.UnixNano() / 1000000
+	if token.ExpireTime != 0 && token.ExpireTime <= nowMillis {
+		return nil, errors.New("the token " + token.Prefix + " has expired")
+	}
+	if nowMillis-token.LastUsedTime >= int64(tokenTouchInterval/time.Millisecond) || token.LastUsedIp != ip {
+		err = mongo.UpdateId(tokenCollectionName, token.Id,
+			bson.M{"last_used_time": nowMillis, "last_used_ip": ip})
+		if err != nil {
+			beego.Error("failed to update the last used time of token "+token.Prefix, err)
+		}
+	}
+	return token, nil
+}
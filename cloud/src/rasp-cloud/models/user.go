@@ -26,21 +26,52 @@ import (
 	"rasp-cloud/mongo"
 	"rasp-cloud/tools"
 	"regexp"
+	"time"
 )
 
 const (
 	userCollectionName = "user"
-	userName           = "openrasp"
+	defaultUserName    = "openrasp"
+	LoginUserKey       = "login_user"
+
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "readonly"
+
+	// the external users are created on the first login and have no password
+	UserSourceOidc = "oidc"
+	UserSourceLdap = "ldap"
 )
 
 type User struct {
-	Id       string `bson:"_id"`
-	Name     string `json:"name" bson:"name"`
-	Password string `json:"password" bson:"password"`
+	Id         string            `json:"id" bson:"_id"`
+	Name       string            `json:"name" bson:"name"`
+	Password   string            `json:"-" bson:"password"`
+	Role       string            `json:"role" bson:"role"`
+	AppRoles   map[string]string `json:"app_roles" bson:"app_roles"`
+	CreateTime int64             `json:"create_time" bson:"create_time"`
+	// the source of the external user, it is empty for the local user
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+	// the id of the external user in its source
+	Subject string `json:"-" bson:"subject,omitempty"`
+	// the two-factor authentication of login, the secret is confirmed by a code before it is enabled
+	TotpEnable        bool   `json:"totp_enable" bson:"totp_enable,omitempty"`
+	TotpSecret        string `json:"-" bson:"totp_secret,omitempty"`
+	TotpPendingSecret string `json:"-" bson:"totp_pending_secret,omitempty"`
+	// the sha256 of the unused recovery codes
+	TotpRecoveryCodes []string `json:"-" bson:"totp_recovery_codes,omitempty"`
+	// the step of the last accepted code, the codes can not be reused
+	TotpLastCounter int64 `json:"-" bson:"totp_last_counter,omitempty"`
 }
 
 var (
-	userId string
+	// the higher level a role has, the more operations it can do
+	roleLevels = map[string]int{
+		RoleReadOnly: 1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+	userNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.@\-]{1,64}$`)
 )
 
 func init() {
@@ -61,30 +92,29 @@ func init() {
 		if err != nil {
 			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create name index for user collection", err)
 		}
-		hash, err := generateHashedPassword("admin@123")
-		if err != nil {
-			tools.Panic(tools.ErrCodeGeneratePasswdFailed, "failed to generate the default hashed password", err)
-		}
-		userId = mongo.GenerateObjectId()
-		user := User{
-			Id:       userId,
-			Name:     userName,
-			Password: hash,
-		}
-		err = mongo.Insert(userCollectionName, user)
+		err = createDefaultUser("admin@123")
 		if err != nil {
 			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to create default user", err)
 		}
-
 	} else {
-		var user *User
-		err := mongo.FindOne(userCollectionName, bson.M{}, &user)
+		// the users created before the roles were introduced are all administrators
+		newSession := mongo.NewSession()
+		_, err = newSession.DB(mongo.DbName).C(userCollectionName).UpdateAll(
+			bson.M{"role": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"role": RoleAdmin}})
+		newSession.Close()
 		if err != nil {
-			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to get admin user", err)
+			tools.Panic(tools.ErrCodeMongoInitFailed, "failed to init the role of users", err)
 		}
-		userId = user.Id
 	}
 
+	if *environment.StartFlag.StartType == environment.StartTypeReset && *environment.StartFlag.User != "" {
+		err := resetUserTotp(*environment.StartFlag.User)
+		if err != nil {
+			tools.Panic(tools.ErrCodeResetUserFailed, "failed to reset the two-factor authentication", err)
+		}
+		beego.Info("reset the two-factor authentication of " + *environment.StartFlag.User + " successfully")
+		os.Exit(0)
+	}
 	if *environment.StartFlag.StartType == environment.StartTypeReset {
 		if *environment.StartFlag.Password == "" {
 			tools.Panic(tools.ErrCodeResetUserFailed, "the password can not be empty", err)
@@ -98,17 +128,42 @@ func init() {
 	}
 }
 
+func createDefaultUser(password string) error {
+	hash, err := generateHashedPassword(password)
+	if err != nil {
+		return errors.New("failed to generate the default hashed password: " + err.Error())
+	}
+	return mongo.Insert(userCollectionName, &User{
+		Id:         mongo.GenerateObjectId(),
+		Name:       defaultUserName,
+		Password:   hash,
+		Role:       RoleAdmin,
+		AppRoles:   make(map[string]string),
+		CreateTime: time.Now().UnixNano() / 1000000,
+	})
+}
+
 func resetUser(newPwd string) error {
 	err := validPassword(newPwd)
 	if err != nil {
 		return errors.New("invalid password: " + err.Error())
 	}
+	user, err := GetUserByName(defaultUserName)
+	if err == mgo.ErrNotFound {
+		return createDefaultUser(newPwd)
+	}
+	if err != nil {
+		return err
+	}
 	pwd, err := generateHashedPassword(newPwd)
 	if err != nil {
 		return errors.New("failed to generate password: " + err.Error())
 	}
-	err = mongo.UpdateId(userCollectionName, userId, bson.M{"password": pwd, "name": userName})
-	return err
+	err = mongo.UpdateId(userCollectionName, user.Id, bson.M{"password": pwd, "role": RoleAdmin})
+	if err != nil {
+		return err
+	}
+	return DisableTotp(user.Id)
 }
 
 func generateHashedPassword(password string) (string, error) {
@@ -137,42 +192,246 @@ func validPassword(password string) error {
 	return nil
 }
 
-func GetLoginUserName() (userName string, err error) {
-	var user *User
-	err = mongo.FindId(userCollectionName, userId, &user)
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole checks whether the user has the role for all apps
+func (user *User) HasRole(role string) bool {
+	return roleLevels[user.Role] >= roleLevels[role]
+}
+
+// HasAppRole checks whether the user has the role for the app,
+// the global role of the user takes precedence over the role of the app
+func (user *User) HasAppRole(appId string, role string) bool {
+	if user.HasRole(role) {
+		return true
+	}
+	if appRole, ok := user.AppRoles[appId]; ok {
+		return roleLevels[appRole] >= roleLevels[role]
+	}
+	return false
+}
+
+// GetAppIds returns the ids of apps which the user has been granted a role for
+func (user *User) GetAppIds() []string {
+	appIds := make([]string, 0, len(user.AppRoles))
+	for appId := range user.AppRoles {
+		appIds = append(appIds, appId)
+	}
+	return appIds
+}
+
+func handleUser(user *User) {
+	if user.AppRoles == nil {
+		user.AppRoles = make(map[string]string)
+	}
+}
+
+func GetUserById(id string) (user *User, err error) {
+	err = mongo.FindId(userCollectionName, id, &user)
+	if err == nil && user != nil {
+		handleUser(user)
+	}
+	return
+}
+
+func GetUserByName(name string) (user *User, err error) {
+	err = mongo.FindOne(userCollectionName, bson.M{"name": name}, &user)
+	if err == nil && user != nil {
+		handleUser(user)
+	}
+	return
+}
+
+func GetAllUser(page int, perpage int) (count int, result []*User, err error) {
+	count, err = mongo.FindAll(userCollectionName, nil, &result, perpage*(page-1), perpage, "name")
+	if err == nil {
+		for _, user := range result {
+			handleUser(user)
+		}
+	}
+	if result == nil {
+		result = make([]*User, 0)
+	}
+	return
+}
+
+func AddUser(name string, password string, role string, appRoles map[string]string) (user *User, err error) {
+	if !userNameRegex.MatchString(name) {
+		return nil, errors.New("the user name can only contain letters, numbers and '_.@-', " +
+			"and its length must be between [1, 64]")
+	}
+	if err = validPassword(password); err != nil {
+		return nil, errors.New("Password does not meet complexity requirements: " + err.Error())
+	}
+	if err = validUserRole(role, appRoles); err != nil {
+		return nil, err
+	}
+	if mongo.FindOne(userCollectionName, bson.M{"name": name}, &User{}) != mgo.ErrNotFound {
+		return nil, errors.New("duplicate user name")
+	}
+	hash, err := generateHashedPassword(password)
 	if err != nil {
-		return
+		return nil, errors.New("failed to generate password")
 	}
-	return user.Name, nil
+	user = &User{
+		Id:         mongo.GenerateObjectId(),
+		Name:       name,
+		Password:   hash,
+		Role:       role,
+		AppRoles:   appRoles,
+		CreateTime: time.Now().UnixNano() / 1000000,
+	}
+	handleUser(user)
+	err = mongo.Insert(userCollectionName, user)
+	return
 }
 
-func GetHashedLoginPassword() (pwd string, err error) {
-	var user *User
-	err = mongo.FindId(userCollectionName, userId, &user)
+func validUserRole(role string, appRoles map[string]string) error {
+	if role != "" && !IsValidRole(role) {
+		return errors.New("unknown role: " + role)
+	}
+	for appId, appRole := range appRoles {
+		if appRole != RoleOperator && appRole != RoleReadOnly {
+			return errors.New("the role of app " + appId + " must be " + RoleOperator + " or " + RoleReadOnly)
+		}
+		if _, err := GetAppById(appId); err != nil {
+			return errors.New("failed to get app " + appId + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func UpdateUserRole(id string, role string, appRoles map[string]string) (user *User, err error) {
+	if err = validUserRole(role, appRoles); err != nil {
+		return
+	}
+	user, err = GetUserById(id)
 	if err != nil {
 		return
 	}
-	return user.Password, nil
+	if user.Role == RoleAdmin && role != RoleAdmin {
+		if err = checkLastAdmin(); err != nil {
+			return
+		}
+	}
+	if appRoles == nil {
+		appRoles = make(map[string]string)
+	}
+	err = mongo.UpdateId(userCollectionName, id, bson.M{"role": role, "app_roles": appRoles})
+	if err != nil {
+		return
+	}
+	return GetUserById(id)
 }
 
-func VerifyUser(userName string, pwd string) error {
-	var user *User
-	err := mongo.FindId(userCollectionName, userId, &user)
+// RemoveAppRoles revokes the roles of the app from all users, it is called after the app is removed
+func RemoveAppRoles(appId string) error {
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	_, err := newSession.DB(mongo.DbName).C(userCollectionName).UpdateAll(
+		bson.M{"app_roles." + appId: bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"app_roles." + appId: ""}})
+	return err
+}
+
+func checkLastAdmin() error {
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	count, err := newSession.DB(mongo.DbName).C(userCollectionName).Find(bson.M{"role": RoleAdmin}).Count()
 	if err != nil {
 		return err
 	}
-	if userName != user.Name {
-		return errors.New("username is incorrect")
+	if count <= 1 {
+		return errors.New("keep at least one administrator")
 	}
-	return ComparePassword(user.Password, pwd)
+	return nil
 }
 
-func UpdatePassword(oldPwd string, newPwd string) error {
-	err := VerifyUser(userName, oldPwd)
+func RemoveUserById(id string) (user *User, err error) {
+	user, err = GetUserById(id)
 	if err != nil {
-		return errors.New("old password is incorrect")
+		return
+	}
+	if user.Role == RoleAdmin {
+		if err = checkLastAdmin(); err != nil {
+			return
+		}
+	}
+	err = mongo.RemoveId(userCollectionName, id)
+	if err != nil {
+		return
+	}
+	return user, RemoveCookieByUserId(id)
+}
+
+// VerifyUser verifies the password of the ldap user if ldap is enabled, the local user is verified
+// only if ldap is disabled or the 'LdapFallbackLocal' config is true
+func VerifyUser(userName string, pwd string) (*User, error) {
+	if ldapEnable {
+		user, err := verifyLdapUser(userName, pwd)
+		if err == nil || !ldapFallbackLocal {
+			return user, err
+		}
+		beego.Info("failed to verify the ldap user " + userName + ", fall back to the local user: " + err.Error())
+	}
+	if !localLoginEnable {
+		return nil, errors.New("the local login is disabled")
 	}
-	err = validPassword(newPwd)
+	user, err := GetUserByName(userName)
+	if err != nil {
+		return nil, errors.New("username is incorrect")
+	}
+	if user.Source != "" {
+		return nil, errors.New("the user must log in with " + user.Source)
+	}
+	return user, ComparePassword(user.Password, pwd)
+}
+
+// syncExternalUser returns the user of the subject in the source, the user is created on the first login
+// and its name and role are synchronized on each login, the roles of apps granted in the panel are kept
+func syncExternalUser(source string, subject string, name string, role string) (*User, error) {
+	var user *User
+	err := mongo.FindOne(userCollectionName, bson.M{"source": source, "subject": subject}, &user)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	if user == nil {
+		if role == "" {
+			return nil, errors.New("no panel role is granted to user " + name)
+		}
+		if mongo.FindOne(userCollectionName, bson.M{"name": name}, &User{}) != mgo.ErrNotFound {
+			return nil, errors.New("the user name " + name + " is used by another user")
+		}
+		user = &User{
+			Id:         mongo.GenerateObjectId(),
+			Name:       name,
+			Role:       role,
+			AppRoles:   make(map[string]string),
+			CreateTime: time.Now().UnixNano() / 1000000,
+			Source:     source,
+			Subject:    subject,
+		}
+		return user, mongo.Insert(userCollectionName, user)
+	}
+	handleUser(user)
+	if role == "" && len(user.AppRoles) == 0 {
+		return nil, errors.New("no panel role is granted to user " + name)
+	}
+	if name != user.Name &&
+		mongo.FindOne(userCollectionName, bson.M{"name": name}, &User{}) != mgo.ErrNotFound {
+		return nil, errors.New("the user name " + name + " is used by another user")
+	}
+	err = mongo.UpdateId(userCollectionName, user.Id, bson.M{"name": name, "role": role})
+	if err != nil {
+		return nil, err
+	}
+	return GetUserById(user.Id)
+}
+
+func ResetUserPassword(id string, newPwd string) error {
+	err := validPassword(newPwd)
 	if err != nil {
 		return errors.New("Password does not meet complexity requirements: " + err.Error())
 	}
@@ -180,6 +439,23 @@ func UpdatePassword(oldPwd string, newPwd string) error {
 	if err != nil {
 		return errors.New("failed to update new password")
 	}
-	err = mongo.UpdateId(userCollectionName, userId, bson.M{"password": pwd})
-	return err
+	if err = mongo.UpdateId(userCollectionName, id, bson.M{"password": pwd}); err != nil {
+		return err
+	}
+	// the sessions logged in with the old password are closed
+	return RemoveCookieByUserId(id)
+}
+
+func UpdatePassword(id string, oldPwd string, newPwd string) error {
+	user, err := GetUserById(id)
+	if err != nil {
+		return err
+	}
+	if user.Source != "" {
+		return errors.New("the password of " + user.Source + " user can not be updated")
+	}
+	if ComparePassword(user.Password, oldPwd) != nil {
+		return errors.New("old password is incorrect")
+	}
+	return ResetUserPassword(id, newPwd)
 }
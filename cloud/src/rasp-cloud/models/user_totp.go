@@ -0,0 +1,163 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"rasp-cloud/mongo"
+	"rasp-cloud/tools/totp"
+	"time"
+)
+
+// TotpEnrollment is the secret to be added to the authenticator app
+type TotpEnrollment struct {
+	Secret string `json:"secret"`
+	// the otpauth uri shown as the QR code
+	Uri string `json:"uri"`
+}
+
+const (
+	totpRecoveryCodeCount = 10
+)
+
+var (
+	ErrTotpRequired = errors.New("the totp code is required")
+	ErrTotpInvalid  = errors.New("the totp code is incorrect")
+)
+
+// EnrollTotp generates a pending secret for the user, it replaces the previous pending one
+// and takes effect after EnableTotp
+func EnrollTotp(id string) (*TotpEnrollment, error) {
+	user, err := GetUserById(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnable {
+		return nil, errors.New("the two-factor authentication is already enabled")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err = mongo.UpdateId(userCollectionName, id, bson.M{"totp_pending_secret": secret}); err != nil {
+		return nil, err
+	}
+	issuer := beego.AppConfig.DefaultString("TotpIssuer", "OpenRASP")
+	return &TotpEnrollment{Secret: secret, Uri: totp.ProvisioningURI(issuer, user.Name, secret)}, nil
+}
+
+// EnableTotp enables the pending secret if the code matches it, the recovery codes are returned only once
+func EnableTotp(id string, code string) ([]string, error) {
+	user, err := GetUserById(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpPendingSecret == "" {
+		return nil, errors.New("the two-factor authentication is not enrolled")
+	}
+	counter, ok := totp.Verify(user.TotpPendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrTotpInvalid
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	err = newSession.DB(mongo.DbName).C(userCollectionName).Update(
+		bson.M{"_id": id, "totp_pending_secret": user.TotpPendingSecret},
+		bson.M{
+			"$set": bson.M{"totp_enable": true, "totp_secret": user.TotpPendingSecret,
+				"totp_recovery_codes": hashes, "totp_last_counter": counter},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		})
+	if err == mgo.ErrNotFound {
+		return nil, errors.New("the two-factor authentication has been enrolled again")
+	}
+	return codes, err
+}
+
+// VerifyTotp verifies the code of authenticator app or a recovery code of the user,
+// both of them can only be used once
+func VerifyTotp(user *User, code string) error {
+	if !user.TotpEnable {
+		return nil
+	}
+	if code == "" {
+		return ErrTotpRequired
+	}
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	collection := newSession.DB(mongo.DbName).C(userCollectionName)
+	var err error
+	if counter, ok := totp.Verify(user.TotpSecret, code, time.Now()); ok {
+		err = collection.Update(
+			bson.M{"_id": user.Id, "$or": []bson.M{
+				{"totp_last_counter": bson.M{"$lt": counter}}, {"totp_last_counter": bson.M{"$exists": false}}}},
+			bson.M{"$set": bson.M{"totp_last_counter": counter}})
+	} else {
+		hash := totp.HashRecoveryCode(code)
+		err = collection.Update(bson.M{"_id": user.Id, "totp_recovery_codes": hash},
+			bson.M{"$pull": bson.M{"totp_recovery_codes": hash}})
+		if err == nil {
+			beego.Info("the recovery code of user " + user.Name + " is used")
+		}
+	}
+	if err == mgo.ErrNotFound {
+		return ErrTotpInvalid
+	}
+	return err
+}
+
+// RegenerateTotpRecoveryCodes replaces the recovery codes of the user
+func RegenerateTotpRecoveryCodes(id string) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, mongo.UpdateId(userCollectionName, id, bson.M{"totp_recovery_codes": hashes})
+}
+
+// DisableTotp removes the secrets and the recovery codes of the user
+func DisableTotp(id string) error {
+	newSession := mongo.NewSession()
+	defer newSession.Close()
+	return newSession.DB(mongo.DbName).C(userCollectionName).UpdateId(id, bson.M{"$unset": bson.M{
+		"totp_enable": "", "totp_secret": "", "totp_pending_secret": "",
+		"totp_recovery_codes": "", "totp_last_counter": ""}})
+}
+
+func resetUserTotp(name string) error {
+	user, err := GetUserByName(name)
+	if err != nil {
+		return errors.New("failed to get user " + name + ": " + err.Error())
+	}
+	return DisableTotp(user.Id)
+}
+
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	codes, err = totp.GenerateRecoveryCodes(totpRecoveryCodeCount)
+	if err != nil {
+		return
+	}
+	for _, code := range codes {
+		hashes = append(hashes, totp.HashRecoveryCode(code))
+	}
+	return
+}
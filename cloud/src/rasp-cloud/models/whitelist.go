@@ -0,0 +1,84 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package models
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const (
+	// the hook of whitelist which ignores all attack types
+	whitelistHookAll = "all"
+)
+
+// NewWhitelistItemFromAlarm derives the whitelist item that ignores the attack type of the alarm on its url,
+// the url of whitelist is the host and path without protocol and query string
+func NewWhitelistItemFromAlarm(alarm map[string]interface{}) (*WhitelistConfigItem, error) {
+	attackType, _ := alarm["attack_type"].(string)
+	if attackType == "" {
+		return nil, errors.New("the alarm has no attack_type")
+	}
+	alarmUrl, _ := alarm["url"].(string)
+	if alarmUrl == "" {
+		return nil, errors.New("the alarm has no url")
+	}
+	u, err := url.Parse(alarmUrl)
+	if err != nil {
+		return nil, errors.New("failed to parse the url of alarm: " + err.Error())
+	}
+	whitelistUrl := u.Host + u.EscapedPath()
+	if u.Host == "" {
+		// the url without protocol, such as www.example.com/index.php?id=1
+		whitelistUrl = strings.SplitN(strings.SplitN(alarmUrl, "?", 2)[0], "#", 2)[0]
+	}
+	if whitelistUrl == "" {
+		return nil, errors.New("the url of alarm is invalid: " + alarmUrl)
+	}
+	return &WhitelistConfigItem{Url: whitelistUrl, Hook: map[string]bool{attackType: true}}, nil
+}
+
+// MergeWhitelistConfig merges the item into the copy of config,
+// the hooks are added to the item with the same url, it returns false if the config covers the item already
+func MergeWhitelistConfig(config []WhitelistConfigItem, item *WhitelistConfigItem) ([]WhitelistConfigItem, bool) {
+	result := make([]WhitelistConfigItem, 0, len(config)+1)
+	merged := false
+	changed := false
+	for _, current := range config {
+		if current.Url == item.Url && !merged {
+			merged = true
+			hook := make(map[string]bool, len(current.Hook)+len(item.Hook))
+			for key, value := range current.Hook {
+				hook[key] = value
+			}
+			if !hook[whitelistHookAll] {
+				for key, value := range item.Hook {
+					if value && !hook[key] {
+						hook[key] = true
+						changed = true
+					}
+				}
+			}
+			current.Hook = hook
+		}
+		result = append(result, current)
+	}
+	if !merged {
+		result = append(result, *item)
+		changed = true
+	}
+	return result, changed
+}
@@ -34,6 +34,51 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"],
+        beego.ControllerComments{
+            Method: "AssignIncident",
+            Router: `/incident/assign`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"],
+        beego.ControllerComments{
+            Method: "CommentIncident",
+            Router: `/incident/comment`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"],
+        beego.ControllerComments{
+            Method: "GetIncident",
+            Router: `/incident/get`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"],
+        beego.ControllerComments{
+            Method: "SearchIncident",
+            Router: `/incident/search`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"],
+        beego.ControllerComments{
+            Method: "UpdateIncidentStatus",
+            Router: `/incident/status`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:AttackAlarmController"],
         beego.ControllerComments{
             Method: "Search",
@@ -52,4 +97,22 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:SpoolController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:SpoolController"],
+        beego.ControllerComments{
+            Method: "Replay",
+            Router: `/replay`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:SpoolController"] = append(beego.GlobalControllerRouter["rasp-cloud/controllers/api/fore_logs:SpoolController"],
+        beego.ControllerComments{
+            Method: "Stats",
+            Router: `/stats`,
+            AllowHTTPMethods: []string{"get","post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
 }
@@ -72,6 +72,11 @@ func InitRouter() {
 					&fore_logs.PolicyAlarmController{},
 				),
 			),
+			beego.NSNamespace("/spool",
+				beego.NSInclude(
+					&fore_logs.SpoolController{},
+				),
+			),
 		),
 		beego.NSNamespace("/app",
 			beego.NSInclude(
@@ -0,0 +1,124 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package codec encodes the values to json or yaml by their json tags,
+// so that the yaml documents have the same keys as the json ones
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FormatJson = "json"
+	FormatYaml = "yaml"
+)
+
+// Marshal encodes the value in the format, the yaml is converted from the json of value
+func Marshal(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case FormatJson:
+		return json.MarshalIndent(v, "", "    ")
+	case FormatYaml:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err = decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(fromJsonNumber(value))
+	default:
+		return nil, errors.New("unknown format: " + format)
+	}
+}
+
+// Unmarshal decodes the json or yaml document to the value, the json document starts with '{' or '['
+func Unmarshal(data []byte, v interface{}) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return json.Unmarshal(trimmed, v)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	value, err := toJsonValue(value)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// fromJsonNumber keeps the integers as integers in yaml
+func fromJsonNumber(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromJsonNumber(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJsonNumber(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// toJsonValue converts the maps decoded by yaml to the json objects
+func toJsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("the key of object must be a string, got %v", key)
+			}
+			converted, err := toJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = converted
+		}
+		return result, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := toJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,80 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package codec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	Url  string          `json:"url"`
+	Hook map[string]bool `json:"hook"`
+}
+
+type bundle struct {
+	Name      string                 `json:"name"`
+	Config    map[string]interface{} `json:"general_config"`
+	Whitelist []item                 `json:"whitelist_config"`
+}
+
+func TestMarshal(t *testing.T) {
+	value := &bundle{
+		Name:      "test",
+		Config:    map[string]interface{}{"block.status_code": 302, "plugin.filter": true, "ratio": 0.5},
+		Whitelist: []item{{Url: "www.example.com/admin", Hook: map[string]bool{"sql": true}}},
+	}
+	for _, format := range []string{FormatJson, FormatYaml} {
+		content, err := Marshal(value, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format == FormatYaml && !strings.Contains(string(content), "block.status_code: 302\n") {
+			t.Errorf("unexpected yaml:\n%s", content)
+		}
+		var result bundle
+		if err = Unmarshal(content, &result); err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{"block.status_code": float64(302), "plugin.filter": true, "ratio": 0.5}
+		if result.Name != "test" || !reflect.DeepEqual(result.Config, expected) ||
+			!reflect.DeepEqual(result.Whitelist, value.Whitelist) {
+			t.Errorf("unexpected result of %s: %+v", format, result)
+		}
+	}
+	if _, err := Marshal(value, "xml"); err == nil {
+		t.Error("expected error of unknown format")
+	}
+}
+
+func TestUnmarshalYaml(t *testing.T) {
+	var result map[string]interface{}
+	err := Unmarshal([]byte("algorithm_config:\n  meta:\n    all_log: false\n  ssrf:\n    domains: [a, {b: 1}]\n"),
+		&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"algorithm_config": map[string]interface{}{
+		"meta": map[string]interface{}{"all_log": false},
+		"ssrf": map[string]interface{}{"domains": []interface{}{"a", map[string]interface{}{"b": float64(1)}}},
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if err = Unmarshal([]byte("1: a\n"), &result); err == nil {
+		t.Error("expected error of non-string key")
+	}
+}
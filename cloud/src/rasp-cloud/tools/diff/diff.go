@@ -0,0 +1,262 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package diff computes the unified diff of texts and the structured diff of json objects
+package diff
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a changed key of the json object, the path of nested key is joined by dot
+type Change struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+
+	opEqual  = ' '
+	opDelete = '-'
+	opInsert = '+'
+)
+
+type edit struct {
+	op byte
+	// the line offsets of old and new text before the edit
+	oldLine int
+	newLine int
+	text    string
+}
+
+// Unified returns the unified diff of the texts with context lines around the changes,
+// it is empty if the texts are the same
+func Unified(oldName string, newName string, oldText string, newText string, context int) string {
+	if oldText == newText {
+		return ""
+	}
+	edits := lineEdits(splitLines(oldText), splitLines(newText))
+	var buffer bytes.Buffer
+	buffer.WriteString("--- " + oldName + "\n+++ " + newName + "\n")
+	for i := 0; i < len(edits); {
+		if edits[i].op == opEqual {
+			i++
+			continue
+		}
+		// the hunk is extended while the next change is close enough to share the context lines
+		last := i
+		for j := i + 1; j < len(edits) && j-last <= 2*context; j++ {
+			if edits[j].op != opEqual {
+				last = j
+			}
+		}
+		start := maxInt(i-context, 0)
+		end := minInt(last+context+1, len(edits))
+		writeHunk(&buffer, edits[start:end])
+		i = end
+	}
+	return buffer.String()
+}
+
+func writeHunk(buffer *bytes.Buffer, edits []edit) {
+	var oldCount, newCount int
+	for _, e := range edits {
+		if e.op != opInsert {
+			oldCount++
+		}
+		if e.op != opDelete {
+			newCount++
+		}
+	}
+	buffer.WriteString("@@ -" + hunkRange(edits[0].oldLine, oldCount) +
+		" +" + hunkRange(edits[0].newLine, newCount) + " @@\n")
+	for _, e := range edits {
+		buffer.WriteByte(e.op)
+		buffer.WriteString(e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			buffer.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange is 1-based, the start of empty range is the line before it
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return strconv.Itoa(start) + ",0"
+	}
+	if count == 1 {
+		return strconv.Itoa(start + 1)
+	}
+	return strconv.Itoa(start+1) + "," + strconv.Itoa(count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineEdits returns the shortest edit script from a to b with the Myers algorithm
+func lineEdits(a []string, b []string) []edit {
+	// the common prefix and suffix are trimmed to reduce the search space
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits := make([]edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, edit{op: opEqual, oldLine: i, newLine: i, text: a[i]})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := suffix; i > 0; i-- {
+		edits = append(edits, edit{op: opEqual, oldLine: len(a) - i, newLine: len(b) - i, text: a[len(a)-i]})
+	}
+	return edits
+}
+
+func myers(a []string, b []string, oldOffset int, newOffset int) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	// v[offset+k] is the furthest x on diagonal k
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] is the v of diagonals [-d-1, d+1] before the step d
+	trace := make([][]int, 0)
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, oldOffset, newOffset)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(a []string, b []string, trace [][]int, oldOffset int, newOffset int) []edit {
+	x, y := len(a), len(b)
+	edits := make([]edit, 0, len(a)+len(b))
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		get := func(k int) int {
+			return v[k+d+1]
+		}
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{op: opEqual, oldLine: oldOffset + x, newLine: newOffset + y, text: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, edit{op: opInsert, oldLine: oldOffset + x, newLine: newOffset + y, text: b[y]})
+			} else {
+				x--
+				edits = append(edits, edit{op: opDelete, oldLine: oldOffset + x, newLine: newOffset + y, text: a[x]})
+			}
+		}
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// Objects returns the changes from old to new sorted by path, the nested objects are compared recursively
+// and the other values, including arrays, are compared as a whole
+func Objects(old map[string]interface{}, new map[string]interface{}) []Change {
+	changes := make([]Change, 0)
+	compareObjects("", old, new, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func compareObjects(prefix string, old map[string]interface{}, new map[string]interface{}, changes *[]Change) {
+	for key, oldValue := range old {
+		path := prefix + key
+		newValue, ok := new[key]
+		if !ok {
+			*changes = append(*changes, Change{Path: path, Type: Removed, Old: oldValue})
+			continue
+		}
+		oldObject, oldIsObject := oldValue.(map[string]interface{})
+		newObject, newIsObject := newValue.(map[string]interface{})
+		if oldIsObject && newIsObject {
+			compareObjects(path+".", oldObject, newObject, changes)
+		} else if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, Change{Path: path, Type: Changed, Old: oldValue, New: newValue})
+		}
+	}
+	for key, newValue := range new {
+		if _, ok := old[key]; !ok {
+			*changes = append(*changes, Change{Path: prefix + key, Type: Added, New: newValue})
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,91 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	cases := []struct {
+		old      string
+		new      string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\n", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-a\n"},
+		{"a\nb", "a\nc", "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n" +
+			"\\ No newline at end of file\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\n2\nx\n4\n5\n6\n7\n8\n9\n10\ny\n12\n",
+			"--- a\n+++ b\n@@ -2,3 +2,3 @@\n 2\n-3\n+x\n 4\n@@ -10,3 +10,3 @@\n 10\n-11\n+y\n 12\n"},
+		{"1\n2\n3\n4\n5\n", "1\nx\n3\ny\n5\n",
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n-4\n+y\n 5\n"},
+	}
+	for _, c := range cases {
+		if result := Unified("a", "b", c.old, c.new, 1); result != c.expected {
+			t.Errorf("unexpected diff of %q and %q:\n%s", c.old, c.new, result)
+		}
+	}
+}
+
+func TestUnifiedApply(t *testing.T) {
+	old := "var a = 1\nvar b = 2\nvar c = 3\nvar d = 4\nvar e = 5\n"
+	new := "var a = 1\nvar c = 3\nvar b = 2\nvar d = 4\nvar f = 6\nvar e = 5\n"
+	var oldLines, newLines []string
+	for _, line := range strings.Split(Unified("a", "b", old, new, 3), "\n")[2:] {
+		if line == "" || strings.HasPrefix(line, "@@") {
+			continue
+		}
+		if line[0] != '+' {
+			oldLines = append(oldLines, line[1:])
+		}
+		if line[0] != '-' {
+			newLines = append(newLines, line[1:])
+		}
+	}
+	if strings.Join(oldLines, "\n")+"\n" != old || strings.Join(newLines, "\n")+"\n" != new {
+		t.Errorf("the diff can not rebuild the texts: %q, %q", oldLines, newLines)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	old := map[string]interface{}{
+		"meta":          map[string]interface{}{"all_log": true, "is_dev": false},
+		"sql_userinput": map[string]interface{}{"action": "block", "java": []interface{}{"a"}},
+		"removed":       1,
+	}
+	new := map[string]interface{}{
+		"meta":          map[string]interface{}{"all_log": false, "is_dev": false, "log_event": true},
+		"sql_userinput": map[string]interface{}{"action": "block", "java": []interface{}{"a", "b"}},
+		"added":         "x",
+	}
+	expected := []Change{
+		{Path: "added", Type: Added, New: "x"},
+		{Path: "meta.all_log", Type: Changed, Old: true, New: false},
+		{Path: "meta.log_event", Type: Added, New: true},
+		{Path: "removed", Type: Removed, Old: 1},
+		{Path: "sql_userinput.java", Type: Changed, Old: []interface{}{"a"}, New: []interface{}{"a", "b"}},
+	}
+	if changes := Objects(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if changes := Objects(nil, nil); len(changes) != 0 {
+		t.Errorf("unexpected changes of nil objects: %+v", changes)
+	}
+}
@@ -0,0 +1,387 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package kafka is a minimal kafka producer, it speaks Metadata v4 and Produce v3 with the v2 record batch,
+// which are supported by the kafka brokers since 0.11
+package kafka
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientId = "openrasp-cloud"
+	retryBackoff    = 250 * time.Millisecond
+	maxResponseSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrClosed   = errors.New("the kafka producer is closed")
+	ErrNoBroker = errors.New("no available kafka broker")
+)
+
+type Config struct {
+	// the bootstrap brokers, such as 127.0.0.1:9092
+	Brokers  []string
+	ClientId string
+	// the connections are encrypted if it is not nil
+	TLSConfig *tls.Config
+	// 0: no response, 1: the leader only, -1: all in-sync replicas
+	RequiredAcks int16
+	Timeout      time.Duration
+	MaxRetries   int
+}
+
+type Message struct {
+	// the messages with the same key are sent to the same partition,
+	// the messages without key are distributed in round robin
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time
+}
+
+type partition struct {
+	id     int32
+	leader int32
+}
+
+// Producer is safe for concurrent use, the messages are sent synchronously
+type Producer struct {
+	config        Config
+	mutex         sync.Mutex
+	correlationId int32
+	closed        bool
+	brokers       map[int32]string
+	conns         map[string]net.Conn
+	topics        map[string][]partition
+	counter       map[string]uint32
+}
+
+func NewProducer(config Config) (*Producer, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("the kafka brokers can not be empty")
+	}
+	if config.RequiredAcks < -1 || config.RequiredAcks > 1 {
+		return nil, errors.New("the required acks of kafka must be -1, 0 or 1")
+	}
+	if config.ClientId == "" {
+		config.ClientId = defaultClientId
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	return &Producer{
+		config:  config,
+		brokers: make(map[int32]string),
+		conns:   make(map[string]net.Conn),
+		topics:  make(map[string][]partition),
+		counter: make(map[string]uint32),
+	}, nil
+}
+
+// Send sends the messages to the topic, the partitions that fail are retried after refreshing the metadata
+func (p *Producer) Send(topic string, msgs ...*Message) (err error) {
+	if len(msgs) == 0 {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	now := time.Now()
+	for _, msg := range msgs {
+		if msg.Timestamp.IsZero() {
+			msg.Timestamp = now
+		}
+	}
+	pending := msgs
+	for attempt := 0; attempt <= p.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryBackoff * time.Duration(attempt))
+		}
+		if _, ok := p.topics[topic]; !ok {
+			if err = p.refreshMetadata(topic); err != nil {
+				continue
+			}
+		}
+		pending, err = p.produce(topic, pending)
+		if err == nil {
+			return nil
+		}
+		// the leaders may be changed
+		delete(p.topics, topic)
+	}
+	return err
+}
+
+func (p *Producer) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	for addr, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, addr)
+	}
+	return nil
+}
+
+func (p *Producer) partitionFor(topic string, msg *Message, partitions []partition) partition {
+	if msg.Key != nil {
+		hash := fnv.New32a()
+		hash.Write(msg.Key)
+		return partitions[hash.Sum32()%uint32(len(partitions))]
+	}
+	p.counter[topic]++
+	return partitions[p.counter[topic]%uint32(len(partitions))]
+}
+
+// produce returns the messages that are failed to send
+func (p *Producer) produce(topic string, msgs []*Message) ([]*Message, error) {
+	partitions := p.topics[topic]
+	leaders := make(map[int32]map[int32][]*Message)
+	for _, msg := range msgs {
+		part := p.partitionFor(topic, msg, partitions)
+		if leaders[part.leader] == nil {
+			leaders[part.leader] = make(map[int32][]*Message)
+		}
+		leaders[part.leader][part.id] = append(leaders[part.leader][part.id], msg)
+	}
+
+	var failed []*Message
+	var lastErr error
+	for leader, partitionMsgs := range leaders {
+		errs, err := p.produceToBroker(leader, topic, partitionMsgs)
+		if err != nil {
+			for _, msgs := range partitionMsgs {
+				failed = append(failed, msgs...)
+			}
+			lastErr = err
+			continue
+		}
+		for partitionId, err := range errs {
+			failed = append(failed, partitionMsgs[partitionId]...)
+			lastErr = err
+		}
+	}
+	return failed, lastErr
+}
+
+// produceToBroker returns the errors of the partitions, or the error of the request
+func (p *Producer) produceToBroker(leader int32, topic string,
+	partitionMsgs map[int32][]*Message) (map[int32]error, error) {
+	addr, ok := p.brokers[leader]
+	if !ok {
+		return nil, errors.New("unknown kafka broker: " + strconv.Itoa(int(leader)))
+	}
+	body := &encoder{}
+	body.putNullableString(nil)
+	body.putInt16(p.config.RequiredAcks)
+	body.putInt32(int32(p.config.Timeout / time.Millisecond))
+	body.putInt32(1)
+	body.putString(topic)
+	body.putInt32(int32(len(partitionMsgs)))
+	for partitionId, msgs := range partitionMsgs {
+		body.putInt32(partitionId)
+		body.putBytes(encodeRecordBatch(msgs))
+	}
+	response, err := p.roundTrip(addr, apiKeyProduce, produceVersion, body.buf, p.config.RequiredAcks != 0)
+	if err != nil || p.config.RequiredAcks == 0 {
+		return nil, err
+	}
+
+	errs := make(map[int32]error)
+	d := &decoder{buf: response}
+	for i, topicCount := 0, d.arrayLen(); i < topicCount; i++ {
+		d.string()
+		for j, partitionCount := 0, d.arrayLen(); j < partitionCount; j++ {
+			partitionId := d.int32()
+			errCode := d.int16()
+			d.int64()
+			d.int64()
+			if errCode != 0 {
+				errs[partitionId] = KError(errCode)
+			}
+		}
+	}
+	d.int32()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return errs, nil
+}
+
+func (p *Producer) refreshMetadata(topic string) error {
+	body := &encoder{}
+	body.putInt32(1)
+	body.putString(topic)
+	body.putBool(true)
+
+	// the known brokers are preferred to the bootstrap brokers
+	var addrs []string
+	for _, addr := range p.brokers {
+		addrs = append(addrs, addr)
+	}
+	addrs = append(addrs, p.config.Brokers...)
+	var lastErr error = ErrNoBroker
+	for _, addr := range addrs {
+		response, err := p.roundTrip(addr, apiKeyMetadata, metadataVersion, body.buf, true)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return p.handleMetadata(topic, response)
+	}
+	return lastErr
+}
+
+func (p *Producer) handleMetadata(topic string, response []byte) error {
+	d := &decoder{buf: response}
+	d.int32()
+	brokers := make(map[int32]string)
+	for i, count := 0, d.arrayLen(); i < count; i++ {
+		nodeId := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string()
+		brokers[nodeId] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string()
+	d.int32()
+	var topicErr error = KError(3)
+	var partitions []partition
+	for i, count := 0, d.arrayLen(); i < count; i++ {
+		errCode := d.int16()
+		name := d.string()
+		d.bool()
+		var current []partition
+		for j, partitionCount := 0, d.arrayLen(); j < partitionCount; j++ {
+			partitionErr := d.int16()
+			id := d.int32()
+			leader := d.int32()
+			for k, replicaCount := 0, d.arrayLen(); k < replicaCount; k++ {
+				d.int32()
+			}
+			for k, isrCount := 0, d.arrayLen(); k < isrCount; k++ {
+				d.int32()
+			}
+			// the partitions without leader are skipped
+			if partitionErr == 0 && leader >= 0 {
+				current = append(current, partition{id: id, leader: leader})
+			}
+		}
+		if name != topic {
+			continue
+		}
+		if errCode != 0 {
+			topicErr = KError(errCode)
+		} else if len(current) == 0 {
+			topicErr = KError(5)
+		} else {
+			topicErr = nil
+			partitions = current
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(brokers) > 0 {
+		p.brokers = brokers
+	}
+	if topicErr != nil {
+		return topicErr
+	}
+	p.topics[topic] = partitions
+	return nil
+}
+
+func (p *Producer) getConn(addr string) (conn net.Conn, err error) {
+	if conn, ok := p.conns[addr]; ok {
+		return conn, nil
+	}
+	dialer := &net.Dialer{Timeout: p.config.Timeout}
+	if p.config.TLSConfig != nil {
+		config := p.config.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, config)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.conns[addr] = conn
+	return conn, nil
+}
+
+func (p *Producer) roundTrip(addr string, apiKey int16, apiVersion int16, body []byte,
+	expectResponse bool) (response []byte, err error) {
+	conn, err := p.getConn(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+			delete(p.conns, addr)
+		}
+	}()
+	p.correlationId++
+	correlationId := p.correlationId
+	request := &encoder{}
+	request.putInt32(0)
+	request.putInt16(apiKey)
+	request.putInt16(apiVersion)
+	request.putInt32(correlationId)
+	request.putString(p.config.ClientId)
+	request.buf = append(request.buf, body...)
+	binary.BigEndian.PutUint32(request.buf, uint32(len(request.buf)-4))
+
+	conn.SetDeadline(time.Now().Add(p.config.Timeout))
+	if _, err = conn.Write(request.buf); err != nil {
+		return nil, err
+	}
+	if !expectResponse {
+		return nil, nil
+	}
+	var header [8]byte
+	if _, err = io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if size < 4 || size > maxResponseSize {
+		return nil, errMalformedResponse
+	}
+	if int32(binary.BigEndian.Uint32(header[4:])) != correlationId {
+		return nil, errors.New("unexpected correlation id of the kafka response")
+	}
+	response = make([]byte, size-4)
+	if _, err = io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,371 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker is an in-process stand-in of a single kafka broker
+type fakeBroker struct {
+	t          *testing.T
+	listener   net.Listener
+	topic      string
+	partitions int32
+
+	mutex sync.Mutex
+	// the number of produce requests to reject with NOT_LEADER_FOR_PARTITION
+	failProduce int
+	metadataReq int
+	records     map[int32][]*Message
+}
+
+func newFakeBroker(t *testing.T, topic string, partitions int32) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &fakeBroker{
+		t:          t,
+		listener:   listener,
+		topic:      topic,
+		partitions: partitions,
+		records:    make(map[int32][]*Message),
+	}
+	go broker.serve()
+	return broker
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) close() {
+	b.listener.Close()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		d := &decoder{buf: request}
+		apiKey := d.int16()
+		apiVersion := d.int16()
+		correlationId := d.int32()
+		d.string()
+		response := &encoder{}
+		response.putInt32(0)
+		response.putInt32(correlationId)
+		switch {
+		case apiKey == apiKeyMetadata && apiVersion == metadataVersion:
+			b.handleMetadata(d, response)
+		case apiKey == apiKeyProduce && apiVersion == produceVersion:
+			b.handleProduce(d, response)
+		default:
+			b.t.Errorf("unexpected request: api key %d, version %d", apiKey, apiVersion)
+			return
+		}
+		if d.err != nil {
+			b.t.Errorf("malformed request: %v", d.err)
+			return
+		}
+		binary.BigEndian.PutUint32(response.buf, uint32(len(response.buf)-4))
+		if _, err := conn.Write(response.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) handleMetadata(d *decoder, response *encoder) {
+	var topics []string
+	for i, count := 0, d.arrayLen(); i < count; i++ {
+		topics = append(topics, d.string())
+	}
+	if !d.bool() {
+		b.t.Error("expect allow_auto_topic_creation")
+	}
+	b.mutex.Lock()
+	b.metadataReq++
+	b.mutex.Unlock()
+
+	host, port, _ := net.SplitHostPort(b.addr())
+	portNum, _ := strconv.Atoi(port)
+	response.putInt32(0)
+	response.putInt32(1)
+	response.putInt32(0)
+	response.putString(host)
+	response.putInt32(int32(portNum))
+	response.putNullableString(nil)
+	response.putNullableString(nil)
+	response.putInt32(0)
+	response.putInt32(int32(len(topics)))
+	for _, topic := range topics {
+		if topic != b.topic {
+			response.putInt16(3)
+			response.putString(topic)
+			response.putBool(false)
+			response.putInt32(0)
+			continue
+		}
+		response.putInt16(0)
+		response.putString(topic)
+		response.putBool(false)
+		response.putInt32(b.partitions)
+		for i := int32(0); i < b.partitions; i++ {
+			response.putInt16(0)
+			response.putInt32(i)
+			response.putInt32(0)
+			response.putInt32(1)
+			response.putInt32(0)
+			response.putInt32(1)
+			response.putInt32(0)
+		}
+	}
+}
+
+func (b *fakeBroker) handleProduce(d *decoder, response *encoder) {
+	if d.int16() != -1 {
+		b.t.Error("the transactional id should be null")
+	}
+	d.int16()
+	d.int32()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var errCode int16
+	if b.failProduce > 0 {
+		b.failProduce--
+		errCode = 6
+	}
+	topicCount := d.arrayLen()
+	response.putInt32(int32(topicCount))
+	for i := 0; i < topicCount; i++ {
+		topic := d.string()
+		response.putString(topic)
+		partitionCount := d.arrayLen()
+		response.putInt32(int32(partitionCount))
+		for j := 0; j < partitionCount; j++ {
+			partitionId := d.int32()
+			msgs := b.decodeRecordBatch(d.bytes())
+			if errCode == 0 {
+				b.records[partitionId] = append(b.records[partitionId], msgs...)
+			}
+			response.putInt32(partitionId)
+			response.putInt16(errCode)
+			response.putInt64(int64(len(b.records[partitionId])))
+			response.putInt64(-1)
+		}
+	}
+	response.putInt32(0)
+}
+
+func (b *fakeBroker) decodeRecordBatch(data []byte) []*Message {
+	d := &decoder{buf: data}
+	d.int64()
+	length := d.int32()
+	d.int32()
+	if magic := d.int8(); magic != recordBatchMagic {
+		b.t.Errorf("unexpected magic: %d", magic)
+	}
+	crc := uint32(d.int32())
+	if d.err != nil || int(length) != len(data)-12 {
+		b.t.Errorf("unexpected batch length: %d", length)
+		return nil
+	}
+	if crc32.Checksum(data[d.off:], crc32cTable) != crc {
+		b.t.Error("the crc of the record batch mismatches")
+	}
+	d.int16()
+	lastOffsetDelta := d.int32()
+	firstTimestamp := d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+	count := d.int32()
+	if lastOffsetDelta != count-1 {
+		b.t.Errorf("unexpected last offset delta: %d", lastOffsetDelta)
+	}
+	var msgs []*Message
+	for i := int32(0); i < count; i++ {
+		length := d.varint()
+		start := d.off
+		d.int8()
+		timestampDelta := d.varint()
+		if offsetDelta := d.varint(); offsetDelta != int64(i) {
+			b.t.Errorf("unexpected offset delta: %d", offsetDelta)
+		}
+		key := d.varintBytes()
+		value := d.varintBytes()
+		if headers := d.varint(); headers != 0 {
+			b.t.Errorf("unexpected headers: %d", headers)
+		}
+		if int64(d.off-start) != length {
+			b.t.Errorf("unexpected record length: %d", length)
+		}
+		msgs = append(msgs, &Message{
+			Key:       key,
+			Value:     value,
+			Timestamp: time.Unix(0, (firstTimestamp+timestampDelta)*int64(time.Millisecond)),
+		})
+	}
+	if d.err != nil || d.remaining() != 0 {
+		b.t.Errorf("malformed record batch: %v", d.err)
+	}
+	return msgs
+}
+
+func (b *fakeBroker) metadataRequests() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.metadataReq
+}
+
+func (b *fakeBroker) received() map[string]int32 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	result := make(map[string]int32)
+	for partitionId, msgs := range b.records {
+		for _, msg := range msgs {
+			result[string(msg.Value)] = partitionId
+		}
+	}
+	return result
+}
+
+func TestSend(t *testing.T) {
+	broker := newFakeBroker(t, "alarm", 3)
+	defer broker.close()
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, RequiredAcks: 1, MaxRetries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	var msgs []*Message
+	for i := 0; i < 6; i++ {
+		msgs = append(msgs, &Message{Value: []byte("alarm-" + strconv.Itoa(i))})
+	}
+	if err = producer.Send("alarm", msgs...); err != nil {
+		t.Fatal(err)
+	}
+	keyed := []*Message{
+		{Key: []byte("app"), Value: []byte("keyed-0")},
+		{Key: []byte("app"), Value: []byte("keyed-1")},
+	}
+	if err = producer.Send("alarm", keyed...); err != nil {
+		t.Fatal(err)
+	}
+
+	received := broker.received()
+	if len(received) != 8 {
+		t.Fatalf("expect 8 messages, got %v", received)
+	}
+	partitions := make(map[int32]bool)
+	for i := 0; i < 6; i++ {
+		partitionId, ok := received["alarm-"+strconv.Itoa(i)]
+		if !ok {
+			t.Fatalf("the message alarm-%d is lost", i)
+		}
+		partitions[partitionId] = true
+	}
+	if len(partitions) != 3 {
+		t.Errorf("the messages without key should be distributed to all partitions: %v", received)
+	}
+	if received["keyed-0"] != received["keyed-1"] {
+		t.Errorf("the messages with the same key should be in the same partition: %v", received)
+	}
+	if requests := broker.metadataRequests(); requests != 1 {
+		t.Errorf("the metadata should be cached, got %d requests", requests)
+	}
+}
+
+func TestSendRetry(t *testing.T) {
+	broker := newFakeBroker(t, "alarm", 1)
+	defer broker.close()
+	broker.failProduce = 1
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, RequiredAcks: -1, MaxRetries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	if err = producer.Send("alarm", &Message{Value: []byte("retried")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := broker.received()["retried"]; !ok {
+		t.Fatal("the message is not retried")
+	}
+	if requests := broker.metadataRequests(); requests != 2 {
+		t.Errorf("the metadata should be refreshed after the failure, got %d requests", requests)
+	}
+
+	broker.failProduce = 2
+	err = producer.Send("alarm", &Message{Value: []byte("failed")})
+	if kerr, ok := err.(KError); !ok || kerr != 6 {
+		t.Fatalf("expect not leader error, got %v", err)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	broker := newFakeBroker(t, "alarm", 1)
+	defer broker.close()
+	producer, err := NewProducer(Config{Brokers: []string{broker.addr()}, RequiredAcks: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = producer.Send("unknown", &Message{Value: []byte("x")}); err != KError(3) {
+		t.Fatalf("expect unknown topic error, got %v", err)
+	}
+	producer.Close()
+	if err = producer.Send("alarm", &Message{Value: []byte("x")}); err != ErrClosed {
+		t.Fatalf("expect ErrClosed, got %v", err)
+	}
+
+	broker.close()
+	producer, err = NewProducer(Config{Brokers: []string{broker.addr()}, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	if err = producer.Send("alarm", &Message{Value: []byte("x")}); err == nil {
+		t.Fatal("expect an error when the broker is down")
+	}
+	if _, err = NewProducer(Config{}); err == nil {
+		t.Fatal("expect an error without brokers")
+	}
+}
@@ -0,0 +1,280 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+)
+
+const (
+	apiKeyProduce  = 0
+	apiKeyMetadata = 3
+
+	produceVersion  = 3
+	metadataVersion = 4
+
+	recordBatchMagic = 2
+)
+
+var (
+	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errMalformedResponse = errors.New("malformed kafka response")
+)
+
+// KError is the error code returned by the kafka broker
+type KError int16
+
+func (err KError) Error() string {
+	switch err {
+	case 3:
+		return "kafka server error: unknown topic or partition"
+	case 5:
+		return "kafka server error: leader not available"
+	case 6:
+		return "kafka server error: not leader for partition"
+	case 7:
+		return "kafka server error: request timed out"
+	case 10:
+		return "kafka server error: message too large"
+	case 19, 20:
+		return "kafka server error: not enough replicas"
+	case 29:
+		return "kafka server error: topic authorization failed"
+	}
+	return "kafka server error: code " + strconv.Itoa(int(err))
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) putInt8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) putInt16(v int16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *encoder) putInt32(v int32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) putInt64(v int64) {
+	e.putInt32(int32(v >> 32))
+	e.putInt32(int32(v))
+}
+
+func (e *encoder) putBool(v bool) {
+	if v {
+		e.putInt8(1)
+	} else {
+		e.putInt8(0)
+	}
+}
+
+// putVarint writes the zigzag encoded varint used in the record batch
+func (e *encoder) putVarint(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	e.buf = append(e.buf, tmp[:n]...)
+}
+
+func (e *encoder) putString(v string) {
+	e.putInt16(int16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) putNullableString(v *string) {
+	if v == nil {
+		e.putInt16(-1)
+		return
+	}
+	e.putString(*v)
+}
+
+func (e *encoder) putBytes(v []byte) {
+	e.putInt32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) putVarintBytes(v []byte) {
+	if v == nil {
+		e.putVarint(-1)
+		return
+	}
+	e.putVarint(int64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// decoder records the first error, the following reads return zero values
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf) - d.off
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.remaining() < n {
+		d.err = errMalformedResponse
+		return nil
+	}
+	result := d.buf[d.off : d.off+n]
+	d.off += n
+	return result
+}
+
+func (d *decoder) int8() int8 {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) int16() int16 {
+	b := d.take(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.take(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.take(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) bool() bool {
+	return d.int8() != 0
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.off:])
+	if n <= 0 {
+		d.err = errMalformedResponse
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *decoder) varintBytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen returns the length of the array, the null array is regarded as empty
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	// every element has one byte at least
+	if int(n) > d.remaining() {
+		d.err = errMalformedResponse
+		return 0
+	}
+	return int(n)
+}
+
+// encodeRecordBatch encodes the messages as a RecordBatch of magic v2 without compression
+func encodeRecordBatch(msgs []*Message) []byte {
+	firstTimestamp := msgs[0].Timestamp.UnixNano() / 1000000
+	maxTimestamp := firstTimestamp
+	records := &encoder{}
+	for i, msg := range msgs {
+		timestamp := msg.Timestamp.UnixNano() / 1000000
+		if timestamp > maxTimestamp {
+			maxTimestamp = timestamp
+		}
+		record := &encoder{}
+		record.putInt8(0)
+		record.putVarint(timestamp - firstTimestamp)
+		record.putVarint(int64(i))
+		record.putVarintBytes(msg.Key)
+		record.putVarintBytes(msg.Value)
+		// no headers
+		record.putVarint(0)
+		records.putVarint(int64(len(record.buf)))
+		records.buf = append(records.buf, record.buf...)
+	}
+
+	// the crc covers the bytes from the attributes to the end
+	body := &encoder{}
+	body.putInt16(0)
+	body.putInt32(int32(len(msgs) - 1))
+	body.putInt64(firstTimestamp)
+	body.putInt64(maxTimestamp)
+	// no producer id, epoch and sequence, the producer is not idempotent
+	body.putInt64(-1)
+	body.putInt16(-1)
+	body.putInt32(-1)
+	body.putInt32(int32(len(msgs)))
+	body.buf = append(body.buf, records.buf...)
+
+	batch := &encoder{buf: make([]byte, 0, len(body.buf)+21)}
+	batch.putInt64(0)
+	batch.putInt32(int32(4 + 1 + 4 + len(body.buf)))
+	batch.putInt32(-1)
+	batch.putInt8(recordBatchMagic)
+	batch.putInt32(int32(crc32.Checksum(body.buf, crc32cTable)))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf
+}
@@ -0,0 +1,213 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package ldap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// packet is a BER element, the value of constructed element is its children
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte
+	children    []*packet
+}
+
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+	flagConstructed  = 0x20
+
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+
+	// the max size of a message, it protects the client from the malformed lengths
+	maxPacketSize = 16 * 1024 * 1024
+)
+
+var (
+	errMalformedPacket = errors.New("malformed ldap packet")
+)
+
+func newConstructed(class byte, tag byte, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newPrimitive(class byte, tag byte, value []byte) *packet {
+	return &packet{class: class, tag: tag, value: value}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+func newString(value string) *packet {
+	return newPrimitive(classUniversal, tagOctetString, []byte(value))
+}
+
+func newBoolean(value bool) *packet {
+	if value {
+		return newPrimitive(classUniversal, tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{0x00})
+}
+
+func newInteger(tag byte, value int64) *packet {
+	// the minimal two's complement form
+	data := []byte{byte(value)}
+	for value > 127 || value < -128 {
+		value >>= 8
+		data = append([]byte{byte(value)}, data...)
+	}
+	return newPrimitive(classUniversal, tag, data)
+}
+
+func (p *packet) encode() []byte {
+	value := p.value
+	if p.constructed {
+		var buffer bytes.Buffer
+		for _, child := range p.children {
+			buffer.Write(child.encode())
+		}
+		value = buffer.Bytes()
+	}
+	identifier := p.class | p.tag
+	if p.constructed {
+		identifier |= flagConstructed
+	}
+	result := []byte{identifier}
+	if len(value) < 0x80 {
+		result = append(result, byte(len(value)))
+	} else {
+		var length []byte
+		for n := len(value); n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		result = append(result, 0x80|byte(len(length)))
+		result = append(result, length...)
+	}
+	return append(result, value...)
+}
+
+// readPacket reads an element from the stream
+func readPacket(reader io.Reader) (*packet, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 {
+			return nil, errMalformedPacket
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range data {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacketSize {
+		return nil, errMalformedPacket
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return nil, err
+	}
+	return decodeValue(header[0], value)
+}
+
+// decodePacket decodes the first element of data and returns the remaining data
+func decodePacket(data []byte) (*packet, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errMalformedPacket
+	}
+	length := int(data[1])
+	offset := 2
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 || len(data) < 2+size {
+			return nil, nil, errMalformedPacket
+		}
+		length = 0
+		for _, b := range data[2 : 2+size] {
+			length = length<<8 | int(b)
+		}
+		offset += size
+	}
+	if length < 0 || len(data)-offset < length {
+		return nil, nil, errMalformedPacket
+	}
+	p, err := decodeValue(data[0], data[offset:offset+length])
+	return p, data[offset+length:], err
+}
+
+func decodeValue(identifier byte, value []byte) (*packet, error) {
+	p := &packet{class: identifier & 0xc0, constructed: identifier&flagConstructed != 0, tag: identifier & 0x1f}
+	if p.tag == 0x1f {
+		return nil, errMalformedPacket
+	}
+	if !p.constructed {
+		p.value = value
+		return p, nil
+	}
+	for len(value) > 0 {
+		child, rest, err := decodePacket(value)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		value = rest
+	}
+	return p, nil
+}
+
+func (p *packet) is(class byte, tag byte) bool {
+	return p.class == class && p.tag == tag
+}
+
+func (p *packet) child(index int) (*packet, error) {
+	if index >= len(p.children) {
+		return nil, errMalformedPacket
+	}
+	return p.children[index], nil
+}
+
+func (p *packet) int() (int64, error) {
+	if p.constructed || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errMalformedPacket
+	}
+	value := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		value = value<<8 | int64(b)
+	}
+	return value, nil
+}
+
+func (p *packet) string() string {
+	return string(p.value)
+}
@@ -0,0 +1,203 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	filterAnd            = 0
+	filterOr             = 1
+	filterNot            = 2
+	filterEqualityMatch  = 3
+	filterSubstrings     = 4
+	filterGreaterOrEqual = 5
+	filterLessOrEqual    = 6
+	filterPresent        = 7
+	filterApproxMatch    = 8
+
+	substringInitial = 0
+	substringAny     = 1
+	substringFinal   = 2
+)
+
+// EscapeFilter escapes the value in the filter, such as the user name
+func EscapeFilter(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' || c == '*' || c == '(' || c == ')' || c == 0 {
+			builder.WriteString("\\" + hex.EncodeToString([]byte{c}))
+		} else {
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// EscapeDN escapes the value of an attribute in the distinguished name
+func EscapeDN(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(",+\"\\<>;=", c) >= 0,
+			i == 0 && (c == ' ' || c == '#'), i == len(value)-1 && c == ' ':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case c == 0:
+			builder.WriteString("\\00")
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// compileFilter compiles the string filter of RFC 4515, the extensible match is not supported
+func compileFilter(filter string) (*packet, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	p, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, errors.New("invalid filter " + filter + ": " + err.Error())
+	}
+	if rest != "" {
+		return nil, errors.New("invalid filter " + filter + ": unexpected " + rest)
+	}
+	return p, nil
+}
+
+// parseFilter parses a parenthesized filter and returns the remaining text
+func parseFilter(filter string) (*packet, string, error) {
+	if len(filter) < 2 || filter[0] != '(' {
+		return nil, "", errors.New("missing '('")
+	}
+	switch filter[1] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if filter[1] == '|' {
+			tag = filterOr
+		}
+		p := newConstructed(classContext, tag)
+		rest := filter[2:]
+		for strings.HasPrefix(rest, "(") {
+			child, remaining, err := parseFilter(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, child)
+			rest = remaining
+		}
+		if len(p.children) == 0 || !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("invalid filter list")
+		}
+		return p, rest[1:], nil
+	case '!':
+		child, rest, err := parseFilter(filter[2:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("missing ')'")
+		}
+		return newConstructed(classContext, filterNot, child), rest[1:], nil
+	}
+	end := strings.IndexByte(filter, ')')
+	if end < 0 {
+		return nil, "", errors.New("missing ')'")
+	}
+	p, err := parseItem(filter[1:end])
+	return p, filter[end+1:], err
+}
+
+func parseItem(item string) (*packet, error) {
+	index := strings.IndexByte(item, '=')
+	if index <= 0 {
+		return nil, errors.New("missing '=' in " + item)
+	}
+	attribute := item[:index]
+	value := item[index+1:]
+	tag := byte(filterEqualityMatch)
+	switch attribute[len(attribute)-1] {
+	case '~':
+		tag = filterApproxMatch
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	}
+	if tag != filterEqualityMatch {
+		attribute = attribute[:len(attribute)-1]
+	}
+	if attribute == "" || strings.ContainsAny(attribute, "()*\\ ") {
+		return nil, errors.New("invalid attribute in " + item)
+	}
+	if tag == filterEqualityMatch && value == "*" {
+		return newPrimitive(classContext, filterPresent, []byte(attribute)), nil
+	}
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		substrings := newSequence()
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			unescaped, err := unescapeValue(part)
+			if err != nil {
+				return nil, err
+			}
+			partTag := byte(substringAny)
+			if i == 0 {
+				partTag = substringInitial
+			} else if i == len(parts)-1 {
+				partTag = substringFinal
+			}
+			substrings.children = append(substrings.children, newPrimitive(classContext, partTag, unescaped))
+		}
+		return newConstructed(classContext, filterSubstrings, newString(attribute), substrings), nil
+	}
+	unescaped, err := unescapeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return newConstructed(classContext, tag, newString(attribute),
+		newPrimitive(classUniversal, tagOctetString, unescaped)), nil
+}
+
+func unescapeValue(value string) ([]byte, error) {
+	result := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			result = append(result, value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return nil, errors.New("invalid escape in " + value)
+		}
+		b, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return nil, errors.New("invalid escape in " + value)
+		}
+		result = append(result, b[0])
+		i += 2
+	}
+	return result, nil
+}
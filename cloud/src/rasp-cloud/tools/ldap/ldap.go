@@ -0,0 +1,357 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package ldap is a minimal LDAP v3 client for the authentication of panel users
+//
+// It supports the simple bind, search and StartTLS operations, the operations are sent one by one.
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conn is a connection to the LDAP server
+type Conn struct {
+	conn net.Conn
+	// the host name of server, it is verified by StartTLS
+	host      string
+	timeout   time.Duration
+	mutex     sync.Mutex
+	messageId int64
+}
+
+// SearchRequest searches the entries under the base, all attributes are returned if Attributes is empty
+type SearchRequest struct {
+	BaseDn     string
+	Scope      int
+	Filter     string
+	Attributes []string
+	SizeLimit  int
+}
+
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Error is the error result of the server
+type Error struct {
+	ResultCode int
+	Message    string
+}
+
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+
+	ResultSuccess            = 0
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+
+	appBindRequest        = 0
+	appBindResponse       = 1
+	appUnbindRequest      = 2
+	appSearchRequest      = 3
+	appSearchResultEntry  = 4
+	appSearchResultDone   = 5
+	appSearchResultRef    = 19
+	appExtendedRequest    = 23
+	appExtendedResponse   = 24
+	startTlsOid           = "1.3.6.1.4.1.1466.20037"
+	protocolVersion       = 3
+	neverDerefAliases     = 0
+	defaultTimeout        = 10 * time.Second
+	ldapsDefaultPort      = "636"
+	ldapDefaultPort       = "389"
+	searchTimeLimitSecond = 10
+)
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return "ldap result code " + strconv.Itoa(e.ResultCode)
+	}
+	return "ldap result code " + strconv.Itoa(e.ResultCode) + ": " + e.Message
+}
+
+// IsResultCode checks whether the err is the result of the server with the code
+func IsResultCode(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.ResultCode == code
+}
+
+// Dial connects to the server of url, which is ldap://host[:port] or ldaps://host[:port],
+// the tlsConfig is used by ldaps, its ServerName is set to the host if it is empty
+func Dial(serverUrl string, tlsConfig *tls.Config, timeout time.Duration) (*Conn, error) {
+	parsed, err := url.Parse(serverUrl)
+	if err != nil {
+		return nil, errors.New("invalid ldap url: " + err.Error())
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	host := parsed.Host
+	switch parsed.Scheme {
+	case "ldap":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), ldapDefaultPort)
+		}
+		conn, err := net.DialTimeout("tcp", host, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return &Conn{conn: conn, host: parsed.Hostname(), timeout: timeout}, nil
+	case "ldaps":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), ldapsDefaultPort)
+		}
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", host,
+			withServerName(tlsConfig, parsed.Hostname()))
+		if err != nil {
+			return nil, err
+		}
+		return &Conn{conn: conn, host: parsed.Hostname(), timeout: timeout}, nil
+	}
+	return nil, errors.New("the scheme of ldap url must be ldap or ldaps: " + serverUrl)
+}
+
+func withServerName(tlsConfig *tls.Config, serverName string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = serverName
+	}
+	return tlsConfig
+}
+
+// StartTLS upgrades the connection to TLS, the ServerName of tlsConfig is set to the host of server if it is empty
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.conn.(*tls.Conn); ok {
+		return errors.New("the connection is already using tls")
+	}
+	request := newConstructed(classApplication, appExtendedRequest,
+		newPrimitive(classContext, 0, []byte(startTlsOid)))
+	response, err := c.request(request, appExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err = checkResult(response); err != nil {
+		return errors.New("failed to start tls: " + err.Error())
+	}
+	tlsConn := tls.Client(c.conn, withServerName(tlsConfig, c.host))
+	tlsConn.SetDeadline(time.Now().Add(c.timeout))
+	if err = tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	return nil
+}
+
+// Bind authenticates with the simple password, the empty password is rejected since the server
+// treats it as an anonymous bind which always succeeds
+func (c *Conn) Bind(dn string, password string) error {
+	if password == "" {
+		return &Error{ResultCode: ResultInvalidCredentials, Message: "the password can not be empty"}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	request := newConstructed(classApplication, appBindRequest,
+		newInteger(tagInteger, protocolVersion),
+		newString(dn),
+		newPrimitive(classContext, 0, []byte(password)))
+	response, err := c.request(request, appBindResponse)
+	if err != nil {
+		return err
+	}
+	return checkResult(response)
+}
+
+// Search returns the entries matching the filter, the referrals are ignored
+func (c *Conn) Search(searchRequest *SearchRequest) ([]*Entry, error) {
+	filter, err := compileFilter(searchRequest.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attributes := newSequence()
+	for _, attribute := range searchRequest.Attributes {
+		attributes.children = append(attributes.children, newString(attribute))
+	}
+	request := newConstructed(classApplication, appSearchRequest,
+		newString(searchRequest.BaseDn),
+		newInteger(tagEnumerated, int64(searchRequest.Scope)),
+		newInteger(tagEnumerated, neverDerefAliases),
+		newInteger(tagInteger, int64(searchRequest.SizeLimit)),
+		newInteger(tagInteger, searchTimeLimitSecond),
+		newBoolean(false),
+		filter,
+		attributes)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	messageId, err := c.send(request)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0)
+	for {
+		response, err := c.receive(messageId)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case response.is(classApplication, appSearchResultEntry):
+			entry, err := parseEntry(response)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case response.is(classApplication, appSearchResultRef):
+		case response.is(classApplication, appSearchResultDone):
+			err = checkResult(response)
+			if IsResultCode(err, ResultSizeLimitExceeded) {
+				return entries, nil
+			}
+			return entries, err
+		default:
+			return nil, errMalformedPacket
+		}
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.send(newPrimitive(classApplication, appUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+// GetAttribute returns the first value of the attribute, the name is case insensitive
+func (entry *Entry) GetAttribute(name string) string {
+	values := entry.GetAttributes(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (entry *Entry) GetAttributes(name string) []string {
+	for key, values := range entry.Attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// request sends the operation and returns the response operation of the tag
+func (c *Conn) request(operation *packet, responseTag byte) (*packet, error) {
+	messageId, err := c.send(operation)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.receive(messageId)
+	if err != nil {
+		return nil, err
+	}
+	if !response.is(classApplication, responseTag) {
+		return nil, errMalformedPacket
+	}
+	return response, nil
+}
+
+func (c *Conn) send(operation *packet) (int64, error) {
+	c.messageId++
+	message := newSequence(newInteger(tagInteger, c.messageId), operation)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(message.encode())
+	return c.messageId, err
+}
+
+// receive returns the operation of the next message, the unsolicited notifications are rejected
+func (c *Conn) receive(messageId int64) (*packet, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	message, err := readPacket(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	if !message.is(classUniversal, tagSequence) || len(message.children) < 2 {
+		return nil, errMalformedPacket
+	}
+	id, err := message.children[0].int()
+	if err != nil {
+		return nil, err
+	}
+	if id != messageId {
+		operation := message.children[1]
+		if id == 0 && operation.is(classApplication, appExtendedResponse) {
+			if err = checkResult(operation); err != nil {
+				return nil, errors.New("the connection is closed by server: " + err.Error())
+			}
+		}
+		return nil, errors.New("unexpected message id " + strconv.FormatInt(id, 10))
+	}
+	return message.children[1], nil
+}
+
+// checkResult checks the LDAPResult at the beginning of the response
+func checkResult(response *packet) error {
+	if len(response.children) < 3 {
+		return errMalformedPacket
+	}
+	code, err := response.children[0].int()
+	if err != nil {
+		return err
+	}
+	if code != ResultSuccess {
+		return &Error{ResultCode: int(code), Message: response.children[2].string()}
+	}
+	return nil
+}
+
+func parseEntry(response *packet) (*Entry, error) {
+	name, err := response.child(0)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := response.child(1)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{DN: name.string(), Attributes: make(map[string][]string)}
+	for _, attribute := range attributes.children {
+		if len(attribute.children) < 2 {
+			return nil, errMalformedPacket
+		}
+		values := make([]string, 0, len(attribute.children[1].children))
+		for _, value := range attribute.children[1].children {
+			values = append(values, value.string())
+		}
+		entry.Attributes[attribute.children[0].string()] = values
+	}
+	return entry, nil
+}
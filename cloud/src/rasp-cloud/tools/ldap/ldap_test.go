@@ -0,0 +1,340 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package ldap
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer is an in-process stand-in of the LDAP server
+type testServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	passwords map[string]string
+	entries   []*Entry
+	// the operations received over tls
+	tlsOperations []string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testServer{
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{generateCertificate(t)}},
+		passwords: map[string]string{"uid=alice,ou=people,dc=example,dc=com": "alice@123"},
+		entries: []*Entry{
+			{DN: "uid=alice,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+				"uid": {"alice"}, "cn": {"Alice Liddell"}, "objectClass": {"person"}}},
+			{DN: "uid=bob,ou=people,dc=example,dc=com", Attributes: map[string][]string{
+				"uid": {"bob"}, "cn": {"Bob (admin)"}, "objectClass": {"person"}}},
+			{DN: "cn=rasp-admins,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+				"cn": {"rasp-admins"}, "objectClass": {"groupOfNames"},
+				"member": {"uid=alice,ou=people,dc=example,dc=com"}}},
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *testServer) url() string {
+	return "ldap://" + server.listener.Addr().String()
+}
+
+func (server *testServer) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+	}()
+	for {
+		message, err := readPacket(conn)
+		if err != nil || len(message.children) < 2 {
+			return
+		}
+		id, _ := message.children[0].int()
+		operation := message.children[1]
+		reply := func(operation *packet) {
+			conn.Write(newSequence(newInteger(tagInteger, id), operation).encode())
+		}
+		result := func(tag byte, code int64, children ...*packet) *packet {
+			return newConstructed(classApplication, tag, append([]*packet{newInteger(tagEnumerated, code),
+				newString(""), newString("")}, children...)...)
+		}
+		if _, ok := conn.(*tls.Conn); ok {
+			server.tlsOperations = append(server.tlsOperations, string('0'+operation.tag))
+		}
+		switch operation.tag {
+		case appBindRequest:
+			code := int64(ResultInvalidCredentials)
+			if password, ok := server.passwords[operation.children[1].string()]; ok &&
+				password == operation.children[2].string() {
+				code = ResultSuccess
+			}
+			reply(result(appBindResponse, code))
+		case appUnbindRequest:
+			return
+		case appExtendedRequest:
+			if operation.children[0].string() != startTlsOid {
+				reply(result(appExtendedResponse, 2))
+				continue
+			}
+			reply(result(appExtendedResponse, ResultSuccess))
+			tlsConn := tls.Server(conn, server.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+		case appSearchRequest:
+			base := strings.ToLower(operation.children[0].string())
+			scope, _ := operation.children[1].int()
+			for _, entry := range server.entries {
+				dn := strings.ToLower(entry.DN)
+				inScope := dn == base
+				if scope == ScopeSingleLevel {
+					inScope = strings.SplitN(dn, ",", 2)[len(strings.SplitN(dn, ",", 2))-1] == base && dn != base
+				} else if scope == ScopeWholeSubtree {
+					inScope = dn == base || strings.HasSuffix(dn, ","+base)
+				}
+				if !inScope || !matchFilter(operation.children[6], entry) {
+					continue
+				}
+				attributes := newSequence()
+				for name, values := range entry.Attributes {
+					set := newConstructed(classUniversal, tagSet)
+					for _, value := range values {
+						set.children = append(set.children, newString(value))
+					}
+					attributes.children = append(attributes.children, newSequence(newString(name), set))
+				}
+				reply(newConstructed(classApplication, appSearchResultEntry, newString(entry.DN), attributes))
+			}
+			reply(result(appSearchResultDone, ResultSuccess))
+		}
+	}
+}
+
+func matchFilter(filter *packet, entry *Entry) bool {
+	switch filter.tag {
+	case filterAnd:
+		for _, child := range filter.children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !matchFilter(filter.children[0], entry)
+	case filterPresent:
+		return len(entry.GetAttributes(filter.string())) > 0
+	case filterEqualityMatch:
+		for _, value := range entry.GetAttributes(filter.children[0].string()) {
+			if strings.EqualFold(value, filter.children[1].string()) {
+				return true
+			}
+		}
+	case filterSubstrings:
+		for _, value := range entry.GetAttributes(filter.children[0].string()) {
+			value = strings.ToLower(value)
+			matched := true
+			for _, part := range filter.children[1].children {
+				text := strings.ToLower(part.string())
+				index := strings.Index(value, text)
+				if index < 0 || (part.tag == substringInitial && index != 0) ||
+					(part.tag == substringFinal && !strings.HasSuffix(value, text)) {
+					matched = false
+					break
+				}
+				value = value[index+len(text):]
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func generateCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestBindAndSearch(t *testing.T) {
+	server := newTestServer(t)
+	defer server.listener.Close()
+	conn, err := Dial(server.url(), nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.Bind("uid=alice,ou=people,dc=example,dc=com", "wrong"); !IsResultCode(err, ResultInvalidCredentials) {
+		t.Errorf("expected invalid credentials, got %v", err)
+	}
+	if err = conn.Bind("uid=alice,ou=people,dc=example,dc=com", ""); !IsResultCode(err, ResultInvalidCredentials) {
+		t.Errorf("expected the empty password to be rejected, got %v", err)
+	}
+	if err = conn.Bind("uid=alice,ou=people,dc=example,dc=com", "alice@123"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := conn.Search(&SearchRequest{BaseDn: "dc=example,dc=com", Scope: ScopeWholeSubtree,
+		Filter: "(&(objectClass=person)(uid=" + EscapeFilter("alice") + "))"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].DN != "uid=alice,ou=people,dc=example,dc=com" ||
+		entries[0].GetAttribute("CN") != "Alice Liddell" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	entries, err = conn.Search(&SearchRequest{BaseDn: "ou=groups,dc=example,dc=com", Scope: ScopeWholeSubtree,
+		Filter: "(&(cn=rasp-*)(member=" + EscapeFilter(entries[0].DN) + "))"})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("unexpected group entries: %+v, %v", entries, err)
+	}
+	// the wildcard in the user name is escaped
+	entries, err = conn.Search(&SearchRequest{BaseDn: "dc=example,dc=com", Scope: ScopeWholeSubtree,
+		Filter: "(uid=" + EscapeFilter("*") + ")"})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("unexpected entries of escaped filter: %+v, %v", entries, err)
+	}
+	entries, err = conn.Search(&SearchRequest{BaseDn: "dc=example,dc=com", Scope: ScopeWholeSubtree,
+		Filter: "(cn=" + EscapeFilter("Bob (admin)") + ")"})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("unexpected entries of parenthesized value: %+v, %v", entries, err)
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	server := newTestServer(t)
+	defer server.listener.Close()
+	conn, err := Dial(server.url(), nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.StartTLS(nil); err == nil {
+		t.Error("expected the self-signed certificate to be rejected")
+	}
+	conn.Close()
+
+	pool := x509.NewCertPool()
+	certificate, _ := x509.ParseCertificate(server.tlsConfig.Certificates[0].Certificate[0])
+	pool.AddCert(certificate)
+	conn, err = Dial(server.url(), &tls.Config{RootCAs: pool}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.StartTLS(&tls.Config{RootCAs: pool}); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Bind("uid=alice,ou=people,dc=example,dc=com", "alice@123"); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.tlsOperations) != 1 || server.tlsOperations[0] != string('0'+appBindRequest) {
+		t.Errorf("the bind is not sent over tls: %v", server.tlsOperations)
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	valid := []string{"uid=alice", "(&(a=1)(|(b=2)(!(c=3))))", "(cn=*)", "(cn=a*b*c)", "(cn=*b)",
+		"(age>=18)", "(cn~=alice)", `(cn=\28x\29)`}
+	for _, filter := range valid {
+		if _, err := compileFilter(filter); err != nil {
+			t.Errorf("unexpected error of %s: %v", filter, err)
+		}
+	}
+	invalid := []string{"", "(uid=alice", "(&)", "(=x)", "(uid=alice))", `(cn=\2)`, "(&(a=1)"}
+	for _, filter := range invalid {
+		if _, err := compileFilter(filter); err == nil {
+			t.Errorf("expected error of %q", filter)
+		}
+	}
+	p, _ := compileFilter("(cn=a*b)")
+	expected := newConstructed(classContext, filterSubstrings, newString("cn"), newSequence(
+		newPrimitive(classContext, substringInitial, []byte("a")),
+		newPrimitive(classContext, substringFinal, []byte("b"))))
+	if !bytes.Equal(p.encode(), expected.encode()) {
+		t.Errorf("unexpected substrings filter: %x", p.encode())
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if result := EscapeFilter(`a*(b)\`); result != `a\2a\28b\29\5c` {
+		t.Errorf("unexpected filter escape: %s", result)
+	}
+	if result := EscapeDN(" a,b=c+\"d\" "); result != `\ a\,b\=c\+\"d\"\ ` {
+		t.Errorf("unexpected dn escape: %s", result)
+	}
+}
+
+func TestBer(t *testing.T) {
+	for _, value := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		p, rest, err := decodePacket(newInteger(tagInteger, value).encode())
+		if err != nil || len(rest) != 0 {
+			t.Fatal(err)
+		}
+		if result, _ := p.int(); result != value {
+			t.Errorf("unexpected integer: %d, expected %d", result, value)
+		}
+	}
+	long := newString(strings.Repeat("x", 300))
+	p, _, err := decodePacket(newSequence(long, newBoolean(true)).encode())
+	if err != nil || len(p.children) != 2 || p.children[0].string() != long.string() {
+		t.Errorf("unexpected long packet: %v", err)
+	}
+	if _, _, err = decodePacket([]byte{0x30, 0x05, 0x04}); err == nil {
+		t.Error("expected error of truncated packet")
+	}
+}
@@ -0,0 +1,397 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package oidc is the relying party of the OpenID Connect authorization code flow with PKCE
+//
+// The metadata of the provider is discovered from the issuer, the id token must be signed with RS256
+// by a key in the jwks of the provider.
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the client registered in the provider
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+	// http.DefaultClient is used if it is nil
+	HttpClient *http.Client
+}
+
+// Metadata is the part of the discovery document used by the client
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// Token is the response of the token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Claims are the claims of the verified id token
+type Claims map[string]interface{}
+
+type Provider struct {
+	config   Config
+	metadata Metadata
+	mutex    sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	// the jwks is refreshed at most once in the interval when an unknown key id is met
+	keysTime time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// the max response size of the provider
+	maxResponseSize = 1024 * 1024
+	// the allowed clock skew between the provider and the client
+	clockSkew           = time.Minute
+	keysRefreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid id token")
+)
+
+// NewProvider discovers the metadata of the provider, the issuer in the metadata must be the configured one
+func NewProvider(config Config) (*Provider, error) {
+	if config.Issuer == "" || config.ClientId == "" || config.RedirectUrl == "" {
+		return nil, errors.New("the issuer, client id and redirect url can not be empty")
+	}
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid"}
+	}
+	provider := &Provider{config: config}
+	err := provider.getJson(strings.TrimSuffix(config.Issuer, "/")+discoveryPath, &provider.metadata)
+	if err != nil {
+		return nil, errors.New("failed to discover the provider: " + err.Error())
+	}
+	if provider.metadata.Issuer != config.Issuer {
+		return nil, errors.New("the issuer of provider is " + provider.metadata.Issuer +
+			", expected " + config.Issuer)
+	}
+	if provider.metadata.AuthorizationEndpoint == "" || provider.metadata.TokenEndpoint == "" ||
+		provider.metadata.JwksUri == "" {
+		return nil, errors.New("the provider does not support the authorization code flow")
+	}
+	return provider, nil
+}
+
+func (provider *Provider) Metadata() Metadata {
+	return provider.metadata
+}
+
+// RandomString returns the url safe base64 encoded random bytes, it is used for the state, nonce and verifier
+func RandomString(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// NewVerifier returns a PKCE code verifier of 43 characters
+func NewVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// Challenge is the S256 code challenge of the verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is the url of the provider to redirect the user to
+func (provider *Provider) AuthCodeURL(state string, nonce string, verifier string) string {
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", provider.config.ClientId)
+	values.Set("redirect_uri", provider.config.RedirectUrl)
+	values.Set("scope", strings.Join(provider.config.Scopes, " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", Challenge(verifier))
+	values.Set("code_challenge_method", "S256")
+	endpoint := provider.metadata.AuthorizationEndpoint
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + values.Encode()
+	}
+	return endpoint + "?" + values.Encode()
+}
+
+// Exchange redeems the authorization code for the tokens, the client authenticates with
+// client_secret_basic if the client secret is configured
+func (provider *Provider) Exchange(code string, verifier string) (*Token, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", provider.config.RedirectUrl)
+	values.Set("code_verifier", verifier)
+	if provider.config.ClientSecret == "" {
+		values.Set("client_id", provider.config.ClientId)
+	}
+	request, err := http.NewRequest(http.MethodPost, provider.metadata.TokenEndpoint,
+		strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.config.ClientId), url.QueryEscape(provider.config.ClientSecret))
+	}
+	var token *Token
+	if err = provider.doJson(request, &token); err != nil {
+		return nil, errors.New("failed to exchange the code: " + err.Error())
+	}
+	if token == nil || token.IdToken == "" {
+		return nil, errors.New("failed to exchange the code: the id token is absent")
+	}
+	return token, nil
+}
+
+// VerifyIdToken verifies the signature, issuer, audience, expiry and nonce of the id token
+func (provider *Provider) VerifyIdToken(rawToken string, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, errors.New("unsupported signing algorithm of id token: " + header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := provider.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature); err != nil {
+		return nil, errors.New("invalid signature of id token")
+	}
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.String("iss") != provider.config.Issuer {
+		return nil, errors.New("unexpected issuer of id token: " + claims.String("iss"))
+	}
+	if !claims.hasAudience(provider.config.ClientId) {
+		return nil, errors.New("the id token is not issued to the client")
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok || now.Add(-clockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("the id token has expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(iat), 0)) {
+		return nil, errors.New("the id token is issued in the future")
+	}
+	if claims.String("nonce") != nonce {
+		return nil, errors.New("unexpected nonce of id token")
+	}
+	if claims.String("sub") == "" {
+		return nil, errors.New("the subject of id token is absent")
+	}
+	return claims, nil
+}
+
+// String returns the claim if it is a string
+func (claims Claims) String(name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// Strings returns the claim as a list, such as the groups, a string claim is a list with one item
+func (claims Claims) Strings(name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				result = append(result, text)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func (claims Claims) hasAudience(clientId string) bool {
+	for _, audience := range claims.Strings("aud") {
+		if audience == clientId {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, result interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err = json.Unmarshal(data, result); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// getKey returns the key of the id, the jwks is refreshed if the key is unknown,
+// such as the provider has rotated its keys
+func (provider *Provider) getKey(kid string) (*rsa.PublicKey, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if key := provider.findKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(provider.keysTime) < keysRefreshInterval {
+		return nil, errors.New("unknown key of id token: " + kid)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := provider.getJson(provider.metadata.JwksUri, &jwks); err != nil {
+		return nil, errors.New("failed to get the jwks of provider: " + err.Error())
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, item := range jwks.Keys {
+		if item.Kty != "RSA" || (item.Use != "" && item.Use != "sig") {
+			continue
+		}
+		key, err := parseRsaKey(item)
+		if err != nil {
+			return nil, err
+		}
+		keys[item.Kid] = key
+	}
+	provider.keys = keys
+	provider.keysTime = time.Now()
+	if key := provider.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("unknown key of id token: " + kid)
+}
+
+// findKey accepts an empty key id if the jwks has only one key
+func (provider *Provider) findKey(kid string) *rsa.PublicKey {
+	if key, ok := provider.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func parseRsaKey(key jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, errors.New("invalid modulus of key " + key.Kid)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent of key " + key.Kid)
+	}
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+}
+
+func (provider *Provider) getJson(url string, result interface{}) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	return provider.doJson(request, result)
+}
+
+func (provider *Provider) doJson(request *http.Request, result interface{}) error {
+	response, err := provider.config.HttpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		var body struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		json.Unmarshal(data, &body)
+		message := "http status " + strconv.Itoa(response.StatusCode)
+		if body.Error != "" {
+			message += ", " + body.Error
+			if body.ErrorDescription != "" {
+				message += ": " + body.ErrorDescription
+			}
+		}
+		return errors.New(message)
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,245 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientId     = "openrasp"
+	testClientSecret = "secret"
+	testRedirectUrl  = "http://127.0.0.1:8086/v1/user/oidc/callback"
+)
+
+// mockProvider is a minimal provider which issues a code for each authorization request
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	mutex  sync.Mutex
+	codes  map[string]url.Values
+	claims map[string]interface{}
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{key: key, kid: "key1", codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                mock.server.URL,
+			AuthorizationEndpoint: mock.server.URL + "/authorize",
+			TokenEndpoint:         mock.server.URL + "/token",
+			JwksUri:               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{{
+			Kty: "RSA", Kid: mock.kid, Use: "sig",
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", mock.token)
+	mock.server = httptest.NewServer(mux)
+	return mock
+}
+
+// authorize is the consent of user, it returns the code of the authorization url
+func (mock *mockProvider) authorize(authUrl string) string {
+	parsed, _ := url.Parse(authUrl)
+	code, _ := RandomString(16)
+	mock.mutex.Lock()
+	mock.codes[code] = parsed.Query()
+	mock.mutex.Unlock()
+	return code
+}
+
+func (mock *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(description string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": description})
+	}
+	r.ParseForm()
+	clientId, clientSecret, _ := r.BasicAuth()
+	if clientId != testClientId || clientSecret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	mock.mutex.Lock()
+	params, ok := mock.codes[r.PostForm.Get("code")]
+	delete(mock.codes, r.PostForm.Get("code"))
+	mock.mutex.Unlock()
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+		fail("unknown code")
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != params.Get("redirect_uri") {
+		fail("redirect_uri mismatch")
+		return
+	}
+	if params.Get("code_challenge_method") != "S256" ||
+		Challenge(r.PostForm.Get("code_verifier")) != params.Get("code_challenge") {
+		fail("PKCE verification failed")
+		return
+	}
+	claims := map[string]interface{}{
+		"iss": mock.server.URL, "aud": params.Get("client_id"), "sub": "1001",
+		"nonce": params.Get("nonce"), "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "alice", "groups": []string{"rasp-admin", "dev"},
+	}
+	for name, value := range mock.claims {
+		claims[name] = value
+	}
+	json.NewEncoder(w).Encode(Token{AccessToken: "access", TokenType: "Bearer",
+		IdToken: mock.sign(claims, mock.kid), ExpiresIn: 3600})
+}
+
+func (mock *mockProvider) sign(claims map[string]interface{}, kid string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	content := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(content))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, mock.key, crypto.SHA256, sum[:])
+	return content + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (mock *mockProvider) newProvider(t *testing.T) *Provider {
+	provider, err := NewProvider(Config{Issuer: mock.server.URL, ClientId: testClientId,
+		ClientSecret: testClientSecret, RedirectUrl: testRedirectUrl, Scopes: []string{"openid", "groups"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestChallenge(t *testing.T) {
+	// the example of RFC 7636 appendix B
+	if challenge := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); challenge !=
+		"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("unexpected challenge: %s", challenge)
+	}
+	verifier, err := NewVerifier()
+	if err != nil || len(verifier) != 43 {
+		t.Errorf("unexpected verifier: %q, %v", verifier, err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.server.Close()
+	provider := mock.newProvider(t)
+	authUrl := provider.AuthCodeURL("state1", "nonce1", "verifier-verifier-verifier-verifier-verifier")
+	if !strings.HasPrefix(authUrl, mock.server.URL+"/authorize?") ||
+		!strings.Contains(authUrl, "scope=openid+groups") || !strings.Contains(authUrl, "state=state1") {
+		t.Errorf("unexpected auth url: %s", authUrl)
+	}
+
+	code := mock.authorize(authUrl)
+	if _, err := provider.Exchange(code, "wrong-verifier-wrong-verifier-wrong-verifier"); err == nil ||
+		!strings.Contains(err.Error(), "PKCE") {
+		t.Errorf("expected PKCE error, got %v", err)
+	}
+	code = mock.authorize(authUrl)
+	token, err := provider.Exchange(code, "verifier-verifier-verifier-verifier-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := provider.VerifyIdToken(token.IdToken, "nonce1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.String("preferred_username") != "alice" || claims.String("sub") != "1001" ||
+		strings.Join(claims.Strings("groups"), ",") != "rasp-admin,dev" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+	if _, err = provider.VerifyIdToken(token.IdToken, "nonce2"); err == nil {
+		t.Error("expected nonce error")
+	}
+	// the code can only be used once
+	if _, err = provider.Exchange(code, "verifier-verifier-verifier-verifier-verifier"); err == nil {
+		t.Error("expected error of the used code")
+	}
+}
+
+func TestVerifyIdToken(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.server.Close()
+	provider := mock.newProvider(t)
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"iss": mock.server.URL, "aud": []string{"other", testClientId},
+			"sub": "1001", "nonce": "n", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	if _, err := provider.VerifyIdToken(mock.sign(valid(), mock.kid), "n"); err != nil {
+		t.Errorf("unexpected error of valid token: %v", err)
+	}
+	cases := map[string]func(claims map[string]interface{}){
+		"issuer":   func(claims map[string]interface{}) { claims["iss"] = "http://evil" },
+		"audience": func(claims map[string]interface{}) { claims["aud"] = "other" },
+		"expired":  func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"subject":  func(claims map[string]interface{}) { delete(claims, "sub") },
+	}
+	for name, modify := range cases {
+		claims := valid()
+		modify(claims)
+		if _, err := provider.VerifyIdToken(mock.sign(claims, mock.kid), "n"); err == nil {
+			t.Errorf("expected %s error", name)
+		}
+	}
+	token := mock.sign(valid(), mock.kid)
+	parts := strings.Split(token, ".")
+	tampered := valid()
+	tampered["sub"] = "admin"
+	payload, _ := json.Marshal(tampered)
+	if _, err := provider.VerifyIdToken(parts[0]+"."+base64.RawURLEncoding.EncodeToString(payload)+"."+parts[2],
+		"n"); err == nil {
+		t.Error("expected signature error")
+	}
+	if _, err := provider.VerifyIdToken(mock.sign(valid(), "unknown"), "n"); err == nil {
+		t.Error("expected unknown key error")
+	}
+	if _, err := provider.VerifyIdToken("not a token", "n"); err != ErrInvalidToken {
+		t.Errorf("unexpected error of malformed token: %v", err)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.server.Close()
+	if _, err := NewProvider(Config{Issuer: mock.server.URL + "/", ClientId: testClientId,
+		RedirectUrl: testRedirectUrl}); err == nil {
+		t.Error("expected issuer mismatch error")
+	}
+	if _, err := NewProvider(Config{Issuer: mock.server.URL}); err == nil {
+		t.Error("expected config error")
+	}
+}
@@ -0,0 +1,90 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package realip gets the client ip of a request, the X-Forwarded-For header is only trusted
+// when the request comes from a trusted proxy, otherwise any client could forge its ip
+package realip
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// ParseTrustedProxies parses the comma separated ips and CIDRs of the trusted proxies
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, errors.New("invalid trusted proxy: " + item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, errors.New("invalid trusted proxy: " + item)
+		}
+		result = append(result, network)
+	}
+	return result, nil
+}
+
+// ClientIp returns the ip of the remote address, or the nearest untrusted ip of the X-Forwarded-For header
+// if the remote address is a trusted proxy, the ips appended by the trusted proxies are skipped
+func ClientIp(remoteAddr string, forwardedFor string, trusted []*net.IPNet) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrusted(ip, trusted) || forwardedFor == "" {
+		return ip
+	}
+	items := strings.Split(forwardedFor, ",")
+	for i := len(items) - 1; i >= 0; i-- {
+		item := strings.TrimSpace(items[i])
+		if net.ParseIP(item) == nil {
+			// the header before an invalid item is forged
+			return ip
+		}
+		ip = item
+		if !isTrusted(item, trusted) {
+			return item
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package realip
+
+import "testing"
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.1,::1 ,")
+	if err != nil || len(trusted) != 3 {
+		t.Fatalf("unexpected trusted proxies: %v, %v", trusted, err)
+	}
+	if !isTrusted("10.1.2.3", trusted) || !isTrusted("192.168.1.1", trusted) || !isTrusted("::1", trusted) {
+		t.Error("expected the ips to be trusted")
+	}
+	if isTrusted("192.168.1.2", trusted) || isTrusted("11.0.0.1", trusted) {
+		t.Error("expected the ips to be untrusted")
+	}
+	for _, invalid := range []string{"10.0.0.0/33", "localhost"} {
+		if _, err = ParseTrustedProxies(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+	cases := []struct {
+		remoteAddr   string
+		forwardedFor string
+		expected     string
+	}{
+		// the header of an untrusted client is ignored
+		{"1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},
+		{"[2001:db8::1]:80", "5.6.7.8", "2001:db8::1"},
+		{"10.0.0.1:80", "", "10.0.0.1"},
+		{"10.0.0.1:80", "5.6.7.8", "5.6.7.8"},
+		// the client can only forge the items before the ip appended by the trusted proxy
+		{"10.0.0.1:80", "9.9.9.9, 5.6.7.8", "5.6.7.8"},
+		{"10.0.0.1:80", "5.6.7.8, 10.0.0.2", "5.6.7.8"},
+		{"10.0.0.1:80", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1:80", "5.6.7.8, bad", "10.0.0.1"},
+	}
+	for _, item := range cases {
+		if result := ClientIp(item.remoteAddr, item.forwardedFor, trusted); result != item.expected {
+			t.Errorf("unexpected client ip of %s %q: %s, expected %s",
+				item.remoteAddr, item.forwardedFor, result, item.expected)
+		}
+	}
+	if result := ClientIp("1.2.3.4:80", "5.6.7.8", nil); result != "1.2.3.4" {
+		t.Errorf("unexpected client ip without trusted proxies: %s", result)
+	}
+}
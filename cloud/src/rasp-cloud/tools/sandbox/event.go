@@ -0,0 +1,123 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Event is a check event of the agent, it is checked by the callbacks of its hook type
+type Event struct {
+	Id      string                 `json:"id"`
+	Hook    string                 `json:"hook"`
+	Params  map[string]interface{} `json:"params"`
+	Context map[string]interface{} `json:"context"`
+}
+
+// EventResult is the decision of the plugin on the event
+type EventResult struct {
+	Action  string    `json:"action"`
+	Results []*Result `json:"results"`
+}
+
+var actionLevels = map[string]int{ActionIgnore: 0, ActionLog: 1, ActionBlock: 2}
+
+// EventFromAlarm rebuilds the check event from the attack alarm, the request context is rebuilt from
+// the request fields of alarm, so the headers other than user-agent and referer are lost
+func EventFromAlarm(alarm map[string]interface{}, language string) (*Event, error) {
+	hook, _ := alarm["attack_type"].(string)
+	if hook == "" {
+		return nil, errors.New("the alarm has no attack_type")
+	}
+	params, _ := alarm["attack_params"].(map[string]interface{})
+	if params == nil {
+		return nil, errors.New("the alarm has no attack_params")
+	}
+	alarmUrl := alarmString(alarm, "url")
+	header := map[string]interface{}{}
+	parameter := map[string]interface{}{}
+	if u, err := url.Parse(alarmUrl); err == nil {
+		if u.Host != "" {
+			header["host"] = u.Host
+		}
+		addParameters(parameter, u.Query())
+	}
+	if userAgent := alarmString(alarm, "user_agent"); userAgent != "" {
+		header["user-agent"] = userAgent
+	}
+	if referer := alarmString(alarm, "referer"); referer != "" {
+		header["referer"] = referer
+	}
+	body := alarmString(alarm, "body")
+	jsonBody := map[string]interface{}{}
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		json.Unmarshal([]byte(body), &jsonBody)
+	} else if values, err := url.ParseQuery(body); err == nil {
+		addParameters(parameter, values)
+	}
+	id, _ := alarm["id"].(string)
+	return &Event{
+		Id:     id,
+		Hook:   hook,
+		Params: params,
+		Context: map[string]interface{}{
+			"url":        alarmUrl,
+			"path":       alarmString(alarm, "path"),
+			"method":     strings.ToLower(alarmString(alarm, "request_method")),
+			"remoteAddr": alarmString(alarm, "attack_source"),
+			"header":     header,
+			"parameter":  parameter,
+			"json":       jsonBody,
+			"body":       body,
+			"server": map[string]interface{}{
+				"language": language,
+				"name":     alarmString(alarm, "server_type"),
+				"version":  alarmString(alarm, "server_version"),
+			},
+		},
+	}, nil
+}
+
+// Run checks the event with the callbacks of its hook type, the action is the most severe one of the results
+func (s *Sandbox) Run(event *Event) (*EventResult, error) {
+	results, err := s.Check(event.Hook, event.Params, event.Context)
+	if err != nil {
+		return nil, err
+	}
+	action := ActionIgnore
+	for _, result := range results {
+		if actionLevels[result.Action] > actionLevels[action] {
+			action = result.Action
+		}
+	}
+	return &EventResult{Action: action, Results: results}, nil
+}
+
+func alarmString(alarm map[string]interface{}, key string) string {
+	value, _ := alarm[key].(string)
+	return value
+}
+
+func addParameters(parameter map[string]interface{}, values url.Values) {
+	for key, value := range values {
+		if current, ok := parameter[key].([]string); ok {
+			value = append(current, value...)
+		}
+		parameter[key] = value
+	}
+}
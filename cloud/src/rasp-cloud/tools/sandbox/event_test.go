@@ -0,0 +1,90 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package sandbox
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventFromAlarm(t *testing.T) {
+	alarm := map[string]interface{}{
+		"id":             "alarm-1",
+		"attack_type":    "sql",
+		"attack_params":  map[string]interface{}{"server": "mysql", "query": "SELECT 1"},
+		"url":            "http://www.example.com/index.php?id=1&id=2",
+		"path":           "/index.php",
+		"request_method": "POST",
+		"user_agent":     "curl/7.0",
+		"attack_source":  "10.0.0.1",
+		"body":           "name=a",
+		"server_type":    "apache",
+	}
+	event, err := EventFromAlarm(alarm, "php")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Id != "alarm-1" || event.Hook != "sql" || event.Params["query"] != "SELECT 1" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	expected := map[string]interface{}{"id": []string{"1", "2"}, "name": []string{"a"}}
+	if !reflect.DeepEqual(event.Context["parameter"], expected) {
+		t.Errorf("unexpected parameter: %v", event.Context["parameter"])
+	}
+	header := event.Context["header"].(map[string]interface{})
+	if header["host"] != "www.example.com" || header["user-agent"] != "curl/7.0" {
+		t.Errorf("unexpected header: %v", header)
+	}
+	if event.Context["method"] != "post" || event.Context["server"].(map[string]interface{})["language"] != "php" {
+		t.Errorf("unexpected context: %v", event.Context)
+	}
+
+	alarm["body"] = `{"name": "a"}`
+	if event, err = EventFromAlarm(alarm, "php"); err != nil {
+		t.Fatal(err)
+	}
+	if event.Context["json"].(map[string]interface{})["name"] != "a" {
+		t.Errorf("unexpected json: %v", event.Context["json"])
+	}
+
+	delete(alarm, "attack_params")
+	if _, err = EventFromAlarm(alarm, "php"); err == nil {
+		t.Error("expected error without attack_params")
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, err := Load([]byte(`var plugin = new RASP('a')
+plugin.register('sql', function () { return {action: 'log'} })
+plugin.register('sql', function (params) { if (params.query == 'x') throw new Attack('x') })
+`), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, action := range map[string]string{"x": ActionBlock, "y": ActionLog} {
+		result, err := s.Run(&Event{Hook: "sql", Params: map[string]interface{}{"query": query}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Action != action || len(result.Results) != 2 {
+			t.Errorf("unexpected result of %s: %+v", query, result)
+		}
+	}
+	result, err := s.Run(&Event{Hook: "command", Params: map[string]interface{}{}})
+	if err != nil || result.Action != ActionIgnore || len(result.Results) != 0 {
+		t.Errorf("unexpected result of command: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,63 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package sandbox
+
+// the benign events used to validate the check callbacks
+var (
+	SampleContext = map[string]interface{}{
+		"url":         "http://www.example.com/index.jsp?id=1",
+		"path":        "/index.jsp",
+		"method":      "get",
+		"querystring": "id=1",
+		"protocol":    "http",
+		"remoteAddr":  "127.0.0.1",
+		"appBasePath": "/var/www",
+		"header": map[string]interface{}{
+			"host":       "www.example.com",
+			"user-agent": "Mozilla/5.0",
+		},
+		"parameter": map[string]interface{}{
+			"id": []string{"1"},
+		},
+		"json": map[string]interface{}{},
+		"body": "",
+		"server": map[string]interface{}{
+			"language": "java",
+			"name":     "tomcat",
+			"version":  "8.5",
+			"os":       "Linux",
+		},
+	}
+
+	SampleParams = map[string]map[string]interface{}{
+		"request":         {},
+		"sql":             {"server": "mysql", "query": "SELECT name FROM users WHERE id = 1"},
+		"command":         {"command": "ls -l /tmp", "stack": []string{}},
+		"directory":       {"path": "/tmp", "realpath": "/tmp", "stack": []string{}},
+		"readFile":        {"path": "/tmp/a.txt", "realpath": "/tmp/a.txt"},
+		"writeFile":       {"path": "/tmp/a.txt", "realpath": "/tmp/a.txt", "content": "hello"},
+		"deleteFile":      {"path": "/tmp/a.txt", "realpath": "/tmp/a.txt"},
+		"fileUpload":      {"name": "file", "filename": "a.txt", "content": "hello"},
+		"rename":          {"source": "/tmp/a.txt", "dest": "/tmp/b.txt"},
+		"copy":            {"source": "/tmp/a.txt", "dest": "/tmp/b.txt"},
+		"include":         {"url": "/var/www/a.jsp", "function": "include", "realpath": "/var/www/a.jsp"},
+		"xxe":             {"entity": "http://www.example.com/a.dtd"},
+		"ognl":            {"expression": "name"},
+		"deserialization": {"clazz": "java.lang.String"},
+		"ssrf": {"url": "http://www.example.com/", "hostname": "www.example.com",
+			"ip": []string{"93.184.216.34"}, "function": "url.openConnection"},
+		"webdav": {"source": "/tmp/a.txt", "dest": "/tmp/b.txt"},
+	}
+)
@@ -0,0 +1,422 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package sandbox runs the plugin of agents in an otto vm with a stub RASP api,
+// so that the plugin can be validated and tested before it is pushed to the agents
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robertkrimen/otto"
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Check is a check callback registered by the plugin
+type Check struct {
+	Plugin string `json:"plugin" bson:"plugin"`
+	Hook   string `json:"hook" bson:"hook"`
+}
+
+// Result is the result of a check callback, it is the same as the result of agents
+type Result struct {
+	Plugin     string `json:"plugin"`
+	Action     string `json:"action"`
+	Message    string `json:"message"`
+	Confidence int    `json:"confidence"`
+	// the error thrown by the check callback, the action is ignore in this case
+	Error string `json:"error,omitempty"`
+}
+
+type Sandbox struct {
+	vm       *otto.Otto
+	timeout  time.Duration
+	checks   []*check
+	warnings []string
+	logs     []string
+	broken   bool
+}
+
+type check struct {
+	Check
+	callback otto.Value
+}
+
+const (
+	ActionBlock  = "block"
+	ActionLog    = "log"
+	ActionIgnore = "ignore"
+
+	maxLogs = 100
+	// the regular expression which never matches
+	neverMatchPattern = `[^\s\S]`
+)
+
+var (
+	ErrTimeout = errors.New("the execution of plugin timed out")
+	// CheckPoints are the hook types supported by the agents
+	CheckPoints = []string{"request", "requestEnd", "sql", "sql_exception", "sqlSlowQuery", "command",
+		"directory", "readFile", "writeFile", "deleteFile", "fileUpload", "rename", "copy", "link", "include",
+		"xxe", "ognl", "deserialization", "ssrf", "ssrfRedirect", "webdav", "eval", "loadLibrary", "response"}
+
+	errInterrupted = errors.New("interrupted")
+	// otto only supports es5, the top level declarations with const or let are treated as var
+	declarationRegex = regexp.MustCompile(`(?m)^(\s*)(?:const|let)(\s)`)
+	// otto takes the identifier in the next line as the flags of the regular expression literal
+	// at the end of line, so the semicolon is added after the assigned regular expression
+	regExpAssignmentRegex = regexp.MustCompile(`(?m)(=[ \t]*/(?:\\.|\[(?:\\.|[^\]\\\n])*\]|[^/\\\n\[])+/[gimuy]*)[ \t]*$`)
+	regExpFlagsRegex      = regexp.MustCompile(`^[gimuy]*$`)
+)
+
+// the stub of RASP api provided by the agents
+const prelude = `
+var RASP = function (name) {
+    if (typeof name !== 'string' || name.length == 0) {
+        throw new TypeError('Plugin name must be a string')
+    }
+    this.name = name
+}
+RASP.prototype.register = function (checkPoint, checkProcess) {
+    if (typeof checkPoint !== 'string' || checkPoint.length == 0) {
+        throw new TypeError('Check point name must be a string')
+    }
+    if (typeof checkProcess !== 'function') {
+        throw new TypeError('Check process must be a function')
+    }
+    __rasp_register(this.name, checkPoint, checkProcess)
+}
+RASP.prototype.log = function () {
+    __rasp_log('[' + this.name + ']', Array.prototype.slice.call(arguments))
+}
+RASP.prototype.request = function () {}
+RASP.prototype.getCache = function () {}
+RASP.prototype.setCache = function () {}
+RASP.get_jsengine = function () { return 'v8' }
+RASP.config_set = function () {}
+RASP.sql_tokenize = function (query) { return JSON.parse(__rasp_tokenize('sql', String(query))) }
+RASP.cmd_tokenize = function (cmd) { return JSON.parse(__rasp_tokenize('cmd', String(cmd))) }
+
+var Attack = function (message) {
+    this.name = 'Attack'
+    this.message = message
+}
+Attack.prototype = Object.create(Error.prototype)
+var PluginError = function (message) {
+    this.name = 'PluginError'
+    this.message = message
+}
+PluginError.prototype = Object.create(Error.prototype)
+
+var console = {
+    log: function () { __rasp_log('[console]', Array.prototype.slice.call(arguments)) }
+}
+console.info = console.warn = console.error = console.log
+
+if (!String.prototype.startsWith) {
+    String.prototype.startsWith = function (search, position) {
+        position = position || 0
+        return this.substr(position, search.length) === search
+    }
+}
+if (!String.prototype.endsWith) {
+    String.prototype.endsWith = function (search, length) {
+        if (length === undefined || length > this.length) {
+            length = this.length
+        }
+        return this.substring(length - search.length, length) === search
+    }
+}
+if (!String.prototype.includes) {
+    String.prototype.includes = function (search, start) {
+        return this.indexOf(search, start || 0) !== -1
+    }
+}
+if (!Array.prototype.includes) {
+    Array.prototype.includes = function (search) {
+        return this.indexOf(search) !== -1
+    }
+}
+if (!Number.isInteger) {
+    Number.isInteger = function (value) {
+        return typeof value === 'number' && isFinite(value) && Math.floor(value) === value
+    }
+}
+if (!Object.values) {
+    Object.values = function (obj) {
+        return Object.keys(obj).map(function (key) { return obj[key] })
+    }
+}
+if (!Object.assign) {
+    Object.assign = function (target) {
+        for (var i = 1; i < arguments.length; i++) {
+            var source = arguments[i] || {}
+            Object.keys(source).forEach(function (key) { target[key] = source[key] })
+        }
+        return target
+    }
+}
+
+function __rasp_check(checkProcess, params, context) {
+    var result
+    try {
+        result = checkProcess(JSON.parse(params), JSON.parse(context))
+    } catch (e) {
+        if (e instanceof Attack) {
+            result = {action: 'block', message: e.message}
+        } else {
+            throw e
+        }
+    }
+    result = (result && typeof result === 'object') ? result : {}
+    return JSON.stringify({
+        action: String(result.action || 'ignore'),
+        message: String(result.message || ''),
+        confidence: Number(result.confidence) || 0
+    })
+}
+`
+
+// Load runs the plugin in a new sandbox, the plugin and each check callback must finish in timeout
+func Load(content []byte, timeout time.Duration) (*Sandbox, error) {
+	source := declarationRegex.ReplaceAllString(string(content), "${1}var${2}")
+	source = regExpAssignmentRegex.ReplaceAllString(source, "${1};")
+	// the plugin is wrapped in a function by the agents
+	source = "(function(){\n" + source + "\n})()"
+	// the regular expressions which are not supported by re2 fail at runtime instead of load time
+	program, err := parser.ParseFile(nil, "plugin.js", source, parser.IgnoreRegExpErrors)
+	if err != nil {
+		return nil, errors.New("syntax error: " + err.Error())
+	}
+	s := &Sandbox{vm: otto.New(), timeout: timeout}
+	visitor := &regExpVisitor{sandbox: s}
+	ast.Walk(visitor, program)
+	if visitor.err != nil {
+		return nil, visitor.err
+	}
+	s.vm.Set("__rasp_register", s.register)
+	s.vm.Set("__rasp_log", s.log)
+	s.vm.Set("__rasp_tokenize", s.tokenize)
+	if _, err = s.vm.Run(prelude); err != nil {
+		return nil, errors.New("failed to init sandbox: " + err.Error())
+	}
+	if _, err = s.run(func() (otto.Value, error) { return s.vm.Run(program) }); err != nil {
+		return nil, errors.New("failed to run plugin: " + err.Error())
+	}
+	if len(s.checks) == 0 {
+		s.warn("the plugin does not register any check")
+	}
+	return s, nil
+}
+
+// Validate runs each check callback with a benign sample event,
+// the errors thrown by the callbacks are warnings since the samples can not cover all fields
+func (s *Sandbox) Validate() error {
+	for _, hook := range s.Hooks() {
+		params, ok := SampleParams[hook]
+		if !ok {
+			continue
+		}
+		results, err := s.Check(hook, params, SampleContext)
+		if err != nil {
+			return errors.New("failed to run the check of " + hook + ": " + err.Error())
+		}
+		for _, result := range results {
+			if result.Error != "" {
+				s.warn("the check of " + hook + " in " + result.Plugin + " throws an error: " + result.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// Check runs the check callbacks of the hook type with the event in the order of registration
+func (s *Sandbox) Check(hook string, params map[string]interface{},
+	context map[string]interface{}) ([]*Result, error) {
+	if s.broken {
+		return nil, ErrTimeout
+	}
+	paramsContent, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	contextContent, err := json.Marshal(context)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*Result, 0)
+	for _, c := range s.checks {
+		if c.Hook != hook {
+			continue
+		}
+		result := &Result{Plugin: c.Plugin}
+		value, err := s.run(func() (otto.Value, error) {
+			return s.vm.Call("__rasp_check", nil, c.callback, string(paramsContent), string(contextContent))
+		})
+		if err == ErrTimeout {
+			// the state of vm is unknown after interruption
+			s.broken = true
+			return nil, ErrTimeout
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(value.String()), result)
+		}
+		if err != nil {
+			result.Action = ActionIgnore
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Checks returns the check callbacks in the order of registration
+func (s *Sandbox) Checks() []Check {
+	result := make([]Check, 0, len(s.checks))
+	for _, c := range s.checks {
+		result = append(result, c.Check)
+	}
+	return result
+}
+
+// Hooks returns the sorted hook types which have check callbacks
+func (s *Sandbox) Hooks() []string {
+	exists := make(map[string]bool)
+	result := make([]string, 0)
+	for _, c := range s.checks {
+		if !exists[c.Hook] {
+			exists[c.Hook] = true
+			result = append(result, c.Hook)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (s *Sandbox) Warnings() []string {
+	return append([]string{}, s.warnings...)
+}
+
+// Logs returns the first logs printed by the plugin
+func (s *Sandbox) Logs() []string {
+	return append([]string{}, s.logs...)
+}
+
+func (s *Sandbox) run(f func() (otto.Value, error)) (value otto.Value, err error) {
+	defer func() {
+		if caught := recover(); caught != nil {
+			if caught == errInterrupted {
+				err = ErrTimeout
+				return
+			}
+			panic(caught)
+		}
+	}()
+	s.vm.Interrupt = make(chan func(), 1)
+	timer := time.AfterFunc(s.timeout, func() {
+		s.vm.Interrupt <- func() {
+			panic(errInterrupted)
+		}
+	})
+	defer timer.Stop()
+	return f()
+}
+
+func (s *Sandbox) register(call otto.FunctionCall) otto.Value {
+	plugin := call.Argument(0).String()
+	hook := call.Argument(1).String()
+	if !isCheckPoint(hook) {
+		s.warn("unknown check point '" + hook + "' is ignored in " + plugin)
+		return otto.UndefinedValue()
+	}
+	s.checks = append(s.checks, &check{Check: Check{Plugin: plugin, Hook: hook}, callback: call.Argument(2)})
+	return otto.UndefinedValue()
+}
+
+func (s *Sandbox) log(call otto.FunctionCall) otto.Value {
+	if len(s.logs) >= maxLogs {
+		return otto.UndefinedValue()
+	}
+	items := []string{call.Argument(0).String()}
+	if args, err := call.Argument(1).Export(); err == nil {
+		if args, ok := args.([]interface{}); ok {
+			for _, arg := range args {
+				items = append(items, fmt.Sprint(arg))
+			}
+		}
+	}
+	s.logs = append(s.logs, strings.Join(items, " "))
+	return otto.UndefinedValue()
+}
+
+func (s *Sandbox) tokenize(call otto.FunctionCall) otto.Value {
+	var tokens []Token
+	if call.Argument(0).String() == "sql" {
+		tokens = TokenizeSql(call.Argument(1).String())
+	} else {
+		tokens = TokenizeCmd(call.Argument(1).String())
+	}
+	content, _ := json.Marshal(tokens)
+	value, _ := otto.ToValue(string(content))
+	return value
+}
+
+func (s *Sandbox) warn(warning string) {
+	for _, item := range s.warnings {
+		if item == warning {
+			return
+		}
+	}
+	s.warnings = append(s.warnings, warning)
+}
+
+// regExpVisitor replaces the regular expression literals which are not supported by re2,
+// such as lookahead and backreference, so that the plugin can be loaded
+type regExpVisitor struct {
+	sandbox *Sandbox
+	err     error
+}
+
+func (v *regExpVisitor) Enter(node ast.Node) ast.Visitor {
+	if literal, ok := node.(*ast.RegExpLiteral); ok {
+		if !regExpFlagsRegex.MatchString(literal.Flags) && v.err == nil {
+			v.err = errors.New("invalid flags of regular expression " + literal.Literal +
+				", add a semicolon after the regular expression")
+		}
+		if _, err := parser.TransformRegExp(literal.Pattern); err != nil {
+			v.sandbox.warn("the regular expression " + literal.Literal +
+				" is not supported by the sandbox, it never matches: " + err.Error())
+			literal.Pattern = neverMatchPattern
+			literal.Literal = "/" + neverMatchPattern + "/" + literal.Flags
+		}
+	}
+	return v
+}
+
+func (v *regExpVisitor) Exit(node ast.Node) {
+}
+
+func isCheckPoint(hook string) bool {
+	for _, item := range CheckPoints {
+		if item == hook {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package sandbox
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPlugin = `const plugin_version = '2019-0101-0000'
+const plugin_name = 'test'
+
+var plugin = new RASP(plugin_name)
+var lookahead = /^(?!foo)bar/
+
+plugin.register('sql', function (params, context) {
+    if (params.query.indexOf('sleep(') >= 0) {
+        return {action: 'block', message: 'sleep in query', confidence: 90}
+    }
+    if (params.query.startsWith('DROP')) {
+        throw new Attack('drop table')
+    }
+    if (params.query == 'error') {
+        return params.missing.field
+    }
+    if (lookahead.test(params.query)) {
+        return {action: 'log', message: 'never'}
+    }
+    if (params.query == 'loop') {
+        while (true) {}
+    }
+    return {action: 'ignore'}
+})
+plugin.register('command', function (params, context) {
+    var tokens = RASP.cmd_tokenize(params.command)
+    plugin.log('command tokens', tokens.length)
+    return tokens.length > 3 ? {action: 'log', message: 'long command'} : clean
+})
+plugin.register('unknown_hook', function () {})
+var clean = {action: 'ignore'}
+`
+
+func TestLoad(t *testing.T) {
+	s, err := Load([]byte(testPlugin), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hooks := s.Hooks(); !reflect.DeepEqual(hooks, []string{"command", "sql"}) {
+		t.Errorf("unexpected hooks: %v", hooks)
+	}
+	checks := s.Checks()
+	if len(checks) != 2 || checks[0] != (Check{Plugin: "test", Hook: "sql"}) {
+		t.Errorf("unexpected checks: %v", checks)
+	}
+	if warnings := s.Warnings(); len(warnings) != 2 || !strings.Contains(warnings[0], "(?!foo)") ||
+		!strings.Contains(warnings[1], "unknown_hook") {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	if err = s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	cases := map[string]string{
+		"syntax error":         "var plugin = new RASP('test'",
+		"failed to run plugin": "var plugin = new RASP('test'); undefinedFunction()",
+		"timed out":            "var plugin = new RASP('test'); while (true) {}",
+		"invalid flags":        "var plugin = new RASP('test')\nfoo(/a/\nplugin.register('sql', function () {}))",
+	}
+	for expected, content := range cases {
+		_, err := Load([]byte(content), 100*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error with %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestLoadWithoutCheck(t *testing.T) {
+	s, err := Load([]byte("var plugin = new RASP('test')\nreturn\nplugin.register('sql', function () {})"),
+		time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Checks()) != 0 || len(s.Warnings()) != 1 {
+		t.Errorf("unexpected checks %v or warnings %v", s.Checks(), s.Warnings())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s, err := Load([]byte(testPlugin), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		hook   string
+		params map[string]interface{}
+		action string
+		error  bool
+	}{
+		{"sql", map[string]interface{}{"query": "SELECT sleep(5)"}, ActionBlock, false},
+		{"sql", map[string]interface{}{"query": "DROP TABLE users"}, ActionBlock, false},
+		{"sql", map[string]interface{}{"query": "SELECT 1"}, ActionIgnore, false},
+		{"sql", map[string]interface{}{"query": "error"}, ActionIgnore, true},
+		{"command", map[string]interface{}{"command": "cat /etc/passwd | grep root"}, ActionLog, false},
+		{"command", map[string]interface{}{"command": "ls"}, ActionIgnore, false},
+	}
+	for _, c := range cases {
+		results, err := s.Check(c.hook, c.params, SampleContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		if results[0].Action != c.action || (results[0].Error != "") != c.error {
+			t.Errorf("unexpected result of %v: %+v", c.params, results[0])
+		}
+	}
+	if logs := s.Logs(); len(logs) != 2 || logs[0] != "[test] command tokens 5" {
+		t.Errorf("unexpected logs: %v", logs)
+	}
+	if results, err := s.Check("directory", nil, nil); err != nil || len(results) != 0 {
+		t.Errorf("expected no result of directory, got %v, %v", results, err)
+	}
+	if _, err = s.Check("sql", map[string]interface{}{"query": "loop"}, SampleContext); err != ErrTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if _, err = s.Check("sql", map[string]interface{}{"query": "SELECT 1"}, SampleContext); err != ErrTimeout {
+		t.Errorf("expected the timed out sandbox to be broken, got %v", err)
+	}
+}
+
+func TestOfficialPlugin(t *testing.T) {
+	content, err := ioutil.ReadFile("../../../../../plugins/official/plugin.js")
+	if err != nil {
+		t.Skip("the official plugin is not found: " + err.Error())
+	}
+	s, err := Load(content, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if warnings := s.Warnings(); len(warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	context := map[string]interface{}{
+		"url":       "http://www.example.com/index.php?id=1",
+		"parameter": map[string]interface{}{"id": []string{"1 union select password from users"}},
+		"header":    map[string]interface{}{},
+		"server":    map[string]interface{}{"language": "php"},
+	}
+	results, err := s.Check("sql", map[string]interface{}{
+		"server": "mysql",
+		"query":  "SELECT name FROM users WHERE id = 1 union select password from users",
+	}, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].Action == ActionIgnore {
+		t.Errorf("expected the sql injection to be detected, got %+v", results)
+	}
+}
+
+func TestTokenizeSql(t *testing.T) {
+	tokens := TokenizeSql("SELECT * FROM `t` WHERE a='x''y' -- c\n/* d */ AND b<=1")
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.Text)
+	}
+	expected := []string{"SELECT", "*", "FROM", "`t`", "WHERE", "a", "=", "'x''y'", "-- c", "/* d */",
+		"AND", "b", "<=", "1"}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Errorf("unexpected tokens: %q", texts)
+	}
+	if tokens[0] != (Token{Start: 0, Stop: 6, Text: "SELECT"}) {
+		t.Errorf("unexpected offsets: %+v", tokens[0])
+	}
+}
+
+func TestTokenizeCmd(t *testing.T) {
+	tokens := TokenizeCmd(`cat "/etc/a b"|grep x&&echo $(id) >> /tmp/log;ls\ -l`)
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.Text)
+	}
+	expected := []string{"cat", `"/etc/a b"`, "|", "grep", "x", "&&", "echo", "$(", "id", ")", ">>", "/tmp/log",
+		";", `ls\ -l`}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Errorf("unexpected tokens: %q", texts)
+	}
+}
@@ -0,0 +1,150 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package sandbox
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is the same as the token of RASP.sql_tokenize and RASP.cmd_tokenize,
+// the offsets are in characters and stop is the offset after the last character
+type Token struct {
+	Start int    `json:"start"`
+	Stop  int    `json:"stop"`
+	Text  string `json:"text"`
+}
+
+var (
+	sqlOperators = []string{"<=>", "<=", ">=", "<>", "!=", "||", "&&", ":=", "<<", ">>"}
+	cmdOperators = []string{"&&", "||", ">>", "$(", ";", "|", "&", ">", "<", "`", "(", ")"}
+)
+
+// TokenizeSql splits the sql query into words, quoted strings, comments and operators
+func TokenizeSql(query string) []Token {
+	chars := []rune(query)
+	tokens := make([]Token, 0)
+	for i := 0; i < len(chars); {
+		c := chars[i]
+		start := i
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '#' || (c == '-' && hasPrefix(chars[i:], "--")):
+			for i < len(chars) && chars[i] != '\n' {
+				i++
+			}
+		case c == '/' && hasPrefix(chars[i:], "/*"):
+			i += 2
+			for i < len(chars) && !hasPrefix(chars[i:], "*/") {
+				i++
+			}
+			i = minInt(i+2, len(chars))
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(chars, i, c != '`')
+		case isSqlWordChar(c):
+			for i < len(chars) && isSqlWordChar(chars[i]) {
+				i++
+			}
+		default:
+			i += maxInt(operatorLength(chars[i:], sqlOperators), 1)
+		}
+		tokens = append(tokens, Token{Start: start, Stop: i, Text: string(chars[start:i])})
+	}
+	return tokens
+}
+
+// TokenizeCmd splits the shell command into words, quoted strings and operators
+func TokenizeCmd(cmd string) []Token {
+	chars := []rune(cmd)
+	tokens := make([]Token, 0)
+	for i := 0; i < len(chars); {
+		c := chars[i]
+		start := i
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '\'' || c == '"':
+			i = skipQuoted(chars, i, c == '"')
+		case operatorLength(chars[i:], cmdOperators) > 0:
+			i += operatorLength(chars[i:], cmdOperators)
+		default:
+			for i < len(chars) && !unicode.IsSpace(chars[i]) && chars[i] != '\'' && chars[i] != '"' &&
+				operatorLength(chars[i:], cmdOperators) == 0 {
+				if chars[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i = minInt(i, len(chars))
+		}
+		tokens = append(tokens, Token{Start: start, Stop: i, Text: string(chars[start:i])})
+	}
+	return tokens
+}
+
+// skipQuoted returns the offset after the closing quote, the quote is escaped by doubling it
+// or by backslash if escapable, the unterminated string ends at the end of input
+func skipQuoted(chars []rune, start int, escapable bool) int {
+	quote := chars[start]
+	for i := start + 1; i < len(chars); i++ {
+		if escapable && chars[i] == '\\' {
+			i++
+			continue
+		}
+		if chars[i] == quote {
+			if i+1 < len(chars) && chars[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(chars)
+}
+
+// operatorLength returns the length of the operator at the start of chars, it is 0 if there is none
+func operatorLength(chars []rune, operators []string) int {
+	for _, operator := range operators {
+		if hasPrefix(chars, operator) {
+			return len(operator)
+		}
+	}
+	return 0
+}
+
+func isSqlWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '$' || c == '@' || c == '.'
+}
+
+func hasPrefix(chars []rune, prefix string) bool {
+	return strings.HasPrefix(string(chars[:minInt(len(chars), len(prefix))]), prefix)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,343 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package schema validates the json config with the typed schema, which can be inferred from the default config
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeAny     = "any"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+)
+
+var (
+	// the values of the action keys in algorithm config
+	ActionValues = []interface{}{"block", "log", "ignore"}
+)
+
+// Schema is the type of json value, the value of any type is accepted if Type is TypeAny
+type Schema struct {
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Minimum     *float64      `json:"minimum,omitempty"`
+	Maximum     *float64      `json:"maximum,omitempty"`
+	MaxLength   *int          `json:"max_length,omitempty"`
+	// the regular expression of string value
+	Pattern string `json:"pattern,omitempty"`
+	// the key of object can be absent if it is optional
+	Optional bool `json:"optional,omitempty"`
+	// the schema of array items
+	Items *Schema `json:"items,omitempty"`
+	// the schemas of object keys, the unknown keys are rejected unless AdditionalProperties is true
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties bool               `json:"additional_properties,omitempty"`
+}
+
+// Error is the validation error of a value, Path is the dotted path of it, such as sql_policy.feature.no_hex
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Errors are all validation errors sorted by path
+type Errors []*Error
+
+// Options changes the validation of all values
+type Options struct {
+	// the unknown keys of objects are accepted
+	AllowUnknownKeys bool
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return "'" + e.Path + "' " + e.Message
+}
+
+func (errs Errors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Infer returns the schema of the default value:
+// the key named action must be one of ActionValues, the integer must be an integer,
+// the non-negative number must be non-negative, the array items have the type of its first item,
+// and the other values must have the same type as the default value
+func Infer(value interface{}) *Schema {
+	return infer("", value)
+}
+
+func infer(key string, value interface{}) *Schema {
+	if number, ok := toFloat(value); ok {
+		value = number
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		schema := &Schema{Type: TypeObject, Properties: make(map[string]*Schema, len(v))}
+		for k, item := range v {
+			schema.Properties[k] = infer(k, item)
+		}
+		return schema
+	case []interface{}:
+		schema := &Schema{Type: TypeArray, Items: &Schema{Type: TypeAny}}
+		if len(v) > 0 {
+			schema.Items = infer("", v[0])
+			for _, item := range v[1:] {
+				if infer("", item).Type != schema.Items.Type {
+					schema.Items = &Schema{Type: TypeAny}
+					break
+				}
+			}
+		}
+		return schema
+	case string:
+		schema := &Schema{Type: TypeString}
+		if key == "action" {
+			schema.Enum = ActionValues
+		}
+		return schema
+	case float64:
+		schema := &Schema{Type: TypeNumber}
+		if v == math.Trunc(v) {
+			schema.Type = TypeInteger
+		}
+		if v >= 0 {
+			minimum := float64(0)
+			schema.Minimum = &minimum
+		}
+		return schema
+	case bool:
+		return &Schema{Type: TypeBoolean}
+	default:
+		return &Schema{Type: TypeAny}
+	}
+}
+
+// Float returns the pointer of v, it is used to set Minimum and Maximum
+func Float(v float64) *float64 {
+	return &v
+}
+
+// Int returns the pointer of v, it is used to set MaxLength
+func Int(v int) *int {
+	return &v
+}
+
+// Validate returns the Errors if the value does not match the schema
+func (s *Schema) Validate(value interface{}, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+	errs := make(Errors, 0)
+	s.validate("", value, options, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Path < errs[j].Path
+	})
+	return errs
+}
+
+func (s *Schema) validate(path string, value interface{}, options *Options, errs *Errors) {
+	addError := func(message string) {
+		*errs = append(*errs, &Error{Path: path, Message: message})
+	}
+	if s.Type == TypeAny {
+		return
+	}
+	if number, ok := toFloat(value); ok {
+		value = number
+	}
+	if value == nil {
+		addError("must be " + article(s.Type) + ", got null")
+		return
+	}
+	switch s.Type {
+	case TypeObject:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			addError("must be an object, got " + typeOf(value))
+			return
+		}
+		for key, property := range s.Properties {
+			item, ok := object[key]
+			if !ok {
+				if property.Optional {
+					continue
+				}
+				*errs = append(*errs, &Error{Path: join(path, key), Message: "is required"})
+				continue
+			}
+			property.validate(join(path, key), item, options, errs)
+		}
+		if !s.AdditionalProperties && !options.AllowUnknownKeys {
+			for key := range object {
+				if _, ok := s.Properties[key]; !ok {
+					*errs = append(*errs, &Error{Path: join(path, key), Message: "is an unknown key"})
+				}
+			}
+		}
+	case TypeArray:
+		array, ok := value.([]interface{})
+		if !ok {
+			addError("must be an array, got " + typeOf(value))
+			return
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				s.Items.validate(path+"["+strconv.Itoa(i)+"]", item, options, errs)
+			}
+		}
+	case TypeString:
+		text, ok := value.(string)
+		if !ok {
+			addError("must be a string, got " + typeOf(value))
+			return
+		}
+		if s.MaxLength != nil && len(text) > *s.MaxLength {
+			addError("must be at most " + strconv.Itoa(*s.MaxLength) + " bytes, got " + strconv.Itoa(len(text)))
+			return
+		}
+		if s.Pattern != "" {
+			if matched, err := regexp.MatchString(s.Pattern, text); err != nil || !matched {
+				addError("must match the pattern " + strconv.Quote(s.Pattern) + ", got " + formatValue(value))
+				return
+			}
+		}
+	case TypeNumber, TypeInteger:
+		number, ok := value.(float64)
+		if !ok {
+			addError("must be " + article(s.Type) + ", got " + typeOf(value))
+			return
+		}
+		if s.Type == TypeInteger && number != math.Trunc(number) {
+			addError("must be an integer, got " + formatValue(value))
+			return
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			addError("must be greater than or equal to " + formatValue(*s.Minimum) + ", got " + formatValue(value))
+			return
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			addError("must be less than or equal to " + formatValue(*s.Maximum) + ", got " + formatValue(value))
+			return
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			addError("must be a boolean, got " + typeOf(value))
+			return
+		}
+	}
+	if len(s.Enum) > 0 {
+		for _, item := range s.Enum {
+			if item == value {
+				return
+			}
+		}
+		values := make([]string, 0, len(s.Enum))
+		for _, item := range s.Enum {
+			values = append(values, formatValue(item))
+		}
+		addError("must be one of " + strings.Join(values, ", ") + ", got " + formatValue(value))
+	}
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// toFloat converts the numbers to float64, the numbers decoded from json are float64 already
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func typeOf(value interface{}) string {
+	if number, ok := toFloat(value); ok {
+		value = number
+	}
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "an integer"
+		}
+		return "a number"
+	case bool:
+		return "a boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func article(t string) string {
+	if t == TypeObject || t == TypeArray || t == TypeInteger {
+		return "an " + t
+	}
+	return "a " + t
+}
+
+func formatValue(value interface{}) string {
+	if number, ok := toFloat(value); ok {
+		value = number
+	}
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,126 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const defaultConfig = `{
+	"meta": {"all_log": false},
+	"sql_userinput": {"name": "sql", "action": "block", "min_length": 15, "pre_filter": "select"},
+	"ssrf_common": {"action": "block", "domains": [".ceye.io", ".xip.io"]},
+	"xss": {"ratio": 0.5, "offset": -1.5, "extra": null}
+}`
+
+func parse(t *testing.T, content string) map[string]interface{} {
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestValidate(t *testing.T) {
+	schema := Infer(parse(t, defaultConfig))
+	cases := []struct {
+		config   string
+		expected string
+	}{
+		{`{"meta": {"all_log": true},
+			"sql_userinput": {"name": "sql", "action": "log", "min_length": 10, "pre_filter": ""},
+			"ssrf_common": {"action": "ignore", "domains": []},
+			"xss": {"ratio": 1, "offset": -2.5, "extra": [1]}}`, ""},
+		{`{"meta": {"all_log": 1},
+			"sql_userinput": {"name": "sql", "action": 42, "min_length": 1.5, "pre_filter": null},
+			"ssrf_common": {"action": "deny", "domains": [".ceye.io", 1]},
+			"xss": {"ratio": -0.5, "offset": "1", "extra": null}}`,
+			"'meta.all_log' must be a boolean, got an integer; " +
+				"'sql_userinput.action' must be a string, got an integer; " +
+				"'sql_userinput.min_length' must be an integer, got 1.5; " +
+				"'sql_userinput.pre_filter' must be a string, got null; " +
+				"'ssrf_common.action' must be one of \"block\", \"log\", \"ignore\", got \"deny\"; " +
+				"'ssrf_common.domains[1]' must be a string, got an integer; " +
+				"'xss.offset' must be a number, got a string; " +
+				"'xss.ratio' must be greater than or equal to 0, got -0.5"},
+		{`{"meta": {"all_log": true, "is_dev": true}, "sql_userinput": [], "xss": {}, "unknown": {}}`,
+			"'meta.is_dev' is an unknown key; " +
+				"'sql_userinput' must be an object, got an array; " +
+				"'ssrf_common' is required; " +
+				"'unknown' is an unknown key; " +
+				"'xss.extra' is required; " +
+				"'xss.offset' is required; " +
+				"'xss.ratio' is required"},
+	}
+	for _, c := range cases {
+		err := schema.Validate(parse(t, c.config), nil)
+		if (err == nil && c.expected != "") || (err != nil && err.Error() != c.expected) {
+			t.Errorf("unexpected error of %s:\n%v", c.config, err)
+		}
+	}
+	if err := schema.Validate(nil, nil); err == nil || err.Error() != "must be an object, got null" {
+		t.Errorf("unexpected error of null: %v", err)
+	}
+}
+
+func TestValidateUnknownKeys(t *testing.T) {
+	schema := Infer(parse(t, `{"meta": {"all_log": false}}`))
+	config := parse(t, `{"meta": {"all_log": false, "is_dev": true}, "new_algorithm": {"action": "log"}}`)
+	if err := schema.Validate(config, &Options{AllowUnknownKeys: true}); err != nil {
+		t.Errorf("unexpected error with unknown keys allowed: %v", err)
+	}
+	schema.Properties["meta"].AdditionalProperties = true
+	err := schema.Validate(config, nil)
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 || errs[0].Path != "new_algorithm" {
+		t.Errorf("unexpected error with additional properties of meta: %v", err)
+	}
+}
+
+func TestValidateGoNumbers(t *testing.T) {
+	schema := Infer(map[string]interface{}{"timeout": 30, "ratio": float32(0.5)})
+	if schema.Properties["timeout"].Type != TypeInteger || schema.Properties["ratio"].Type != TypeNumber {
+		t.Errorf("unexpected schema: %+v", schema.Properties)
+	}
+	if err := schema.Validate(map[string]interface{}{"timeout": int64(10), "ratio": 1}, nil); err != nil {
+		t.Error(err)
+	}
+	err := schema.Validate(map[string]interface{}{"timeout": -1, "ratio": 1}, nil)
+	if err == nil || err.Error() != "'timeout' must be greater than or equal to 0, got -1" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateOptional(t *testing.T) {
+	schema := &Schema{Type: TypeObject, Properties: map[string]*Schema{
+		"syslog.url":      {Type: TypeString, Optional: true, MaxLength: Int(16), Pattern: `^$|^(tcp|udp)://`},
+		"syslog.facility": {Type: TypeInteger, Optional: true, Minimum: Float(0), Maximum: Float(23)},
+	}}
+	if err := schema.Validate(map[string]interface{}{}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := schema.Validate(map[string]interface{}{"syslog.url": "", "syslog.facility": 23}, nil); err != nil {
+		t.Error(err)
+	}
+	err := schema.Validate(map[string]interface{}{"syslog.url": "http://a", "syslog.facility": 24}, nil)
+	if err == nil || err.Error() != "'syslog.facility' must be less than or equal to 23, got 24; "+
+		"'syslog.url' must match the pattern \"^$|^(tcp|udp)://\", got \"http://a\"" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = schema.Validate(map[string]interface{}{"syslog.url": "tcp://www.example.com:514"}, nil)
+	if err == nil || err.Error() != "'syslog.url' must be at most 16 bytes, got 25" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package signature verifies the ed25519 signatures of plugins
+//
+// The signature is the base64 encoded ed25519 signature of the plugin file, it is uploaded as a detached
+// file or appended to the plugin file as the last line:
+//
+//	// openrasp-signature: <base64 signature>
+//
+// in which case the signed content is the file before that line, so the signed file must end with a newline.
+package signature
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	CommentPrefix = "// openrasp-signature:"
+)
+
+var (
+	// the DER header of ed25519 public key in PKIX form, the key follows it
+	pkixPrefix = []byte{0x30, 0x2a, 0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x70, 0x03, 0x21, 0x00}
+
+	ErrNoTrustedKey     = errors.New("no trusted public key is configured")
+	ErrInvalidSignature = errors.New("the signature is not signed by any trusted public key")
+)
+
+// ParsePublicKey parses the base64 encoded ed25519 public key, it is either the raw 32 bytes key
+// or the PKIX form, which is the content of the pem file exported by 'openssl pkey -pubout'
+func ParsePublicKey(text string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, errors.New("failed to decode the public key: " + err.Error())
+	}
+	if len(data) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(data), nil
+	}
+	if len(data) == len(pkixPrefix)+ed25519.PublicKeySize && bytes.HasPrefix(data, pkixPrefix) {
+		return ed25519.PublicKey(data[len(pkixPrefix):]), nil
+	}
+	return nil, errors.New("the public key is not an ed25519 key")
+}
+
+// ParsePublicKeys parses the public keys separated by comma, the empty items are ignored
+func ParsePublicKeys(text string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0)
+	for _, item := range strings.Split(text, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, err := ParsePublicKey(item)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Fingerprint is the base64 encoded sha256 of the public key, such as SHA256:xxx
+func Fingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// SplitComment returns the content before the signature comment and the signature in it,
+// the signature is empty if the last line of content is not the signature comment
+func SplitComment(content []byte) ([]byte, string) {
+	trimmed := bytes.TrimRight(content, " \t\r\n")
+	start := bytes.LastIndexByte(trimmed, '\n') + 1
+	line := string(trimmed[start:])
+	if !strings.HasPrefix(line, CommentPrefix) {
+		return content, ""
+	}
+	return content[:start], strings.TrimSpace(line[len(CommentPrefix):])
+}
+
+// Verify returns the fingerprint of the trusted key which signs the content
+func Verify(keys []ed25519.PublicKey, content []byte, signature string) (string, error) {
+	if len(keys) == 0 {
+		return "", ErrNoTrustedKey
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return "", errors.New("failed to decode the signature: " + err.Error())
+	}
+	if len(data) != ed25519.SignatureSize {
+		return "", errors.New("the length of signature must be 64 bytes")
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, content, data) {
+			return Fingerprint(key), nil
+		}
+	}
+	return "", ErrInvalidSignature
+}
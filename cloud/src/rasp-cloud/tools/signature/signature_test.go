@@ -0,0 +1,103 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package signature
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func generateKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey, privateKey
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	publicKey, _ := generateKey(t)
+	raw := base64.StdEncoding.EncodeToString(publicKey)
+	pkix := base64.StdEncoding.EncodeToString(append(append([]byte{}, pkixPrefix...), publicKey...))
+	keys, err := ParsePublicKeys(" " + raw + ",," + pkix + " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !bytes.Equal(keys[0], publicKey) || !bytes.Equal(keys[1], publicKey) {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	if keys, err = ParsePublicKeys(""); err != nil || len(keys) != 0 {
+		t.Errorf("unexpected keys of empty config: %v, %v", keys, err)
+	}
+	for _, text := range []string{"not base64", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err = ParsePublicKey(text); err == nil {
+			t.Errorf("expected error of %q", text)
+		}
+	}
+	// generated by 'openssl genpkey -algorithm ed25519 | openssl pkey -pubout'
+	if _, err = ParsePublicKey("MCowBQYDK2VwAyEABe2qRDU+VaHdxGG/VJSJk06sXmkizxlcVByeptnlkEA="); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitComment(t *testing.T) {
+	cases := []struct {
+		content   string
+		body      string
+		signature string
+	}{
+		{"var a = 1\n// openrasp-signature: abc\n", "var a = 1\n", "abc"},
+		{"var a = 1\n// openrasp-signature: abc \r\n\n", "var a = 1\n", "abc"},
+		{"// openrasp-signature: abc", "", "abc"},
+		{"var a = 1\n", "var a = 1\n", ""},
+		{"// openrasp-signature: abc\nvar a = 1\n", "// openrasp-signature: abc\nvar a = 1\n", ""},
+	}
+	for _, c := range cases {
+		body, signature := SplitComment([]byte(c.content))
+		if string(body) != c.body || signature != c.signature {
+			t.Errorf("unexpected result of %q: %q, %q", c.content, body, signature)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	publicKey, privateKey := generateKey(t)
+	otherKey, _ := generateKey(t)
+	content := []byte("const plugin_version = '2019-0101-0000'\n")
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content))
+
+	fingerprint, err := Verify([]ed25519.PublicKey{otherKey, publicKey}, content, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != Fingerprint(publicKey) || fingerprint == Fingerprint(otherKey) {
+		t.Errorf("unexpected fingerprint: %s", fingerprint)
+	}
+	if _, err = Verify([]ed25519.PublicKey{otherKey}, content, signature); err != ErrInvalidSignature {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+	if _, err = Verify([]ed25519.PublicKey{publicKey}, append(content, ' '), signature); err != ErrInvalidSignature {
+		t.Errorf("expected invalid signature of changed content, got %v", err)
+	}
+	if _, err = Verify(nil, content, signature); err != ErrNoTrustedKey {
+		t.Errorf("expected no trusted key, got %v", err)
+	}
+	if _, err = Verify([]ed25519.PublicKey{publicKey}, content, "YWJj"); err == nil {
+		t.Error("expected error of short signature")
+	}
+}
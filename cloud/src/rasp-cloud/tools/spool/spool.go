@@ -0,0 +1,614 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package spool is a disk backed FIFO queue made of append-only segment files.
+//
+// Every record is stored as: length (4 bytes) | crc32 (4 bytes) | unix millis (8 bytes) | payload,
+// and the position of the first unconsumed record is saved in the checkpoint file,
+// so the records that are not committed will be replayed after restart.
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerSize         = 16
+	segmentSuffix      = ".seg"
+	checkpointFile     = "checkpoint"
+	quarantineFile     = "quarantine"
+	maxRecordSize      = 64 * 1024 * 1024
+	defaultSegmentSize = 32 * 1024 * 1024
+)
+
+var (
+	ErrFull           = errors.New("the spool is full")
+	ErrRecordTooLarge = errors.New("the record is too large")
+	ErrClosed         = errors.New("the spool is closed")
+	// the quarantine file is limited to the max size of the spool, the poison records beyond it are dropped
+	ErrQuarantineFull = errors.New("the quarantine file of the spool is full")
+)
+
+// PoisonError is returned by the handler of Drain for the records that can never be handled,
+// such as the records rejected by the server, they are moved to the quarantine file instead of being retried
+type PoisonError struct {
+	Err error
+}
+
+func (e *PoisonError) Error() string {
+	return "poison records: " + e.Err.Error()
+}
+
+func Poison(err error) error {
+	return &PoisonError{Err: err}
+}
+
+func IsPoison(err error) bool {
+	_, ok := err.(*PoisonError)
+	return ok
+}
+
+// Position is the position of a record in the spool
+type Position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type Stats struct {
+	// the count and size of records which have not been committed
+	PendingRecords int64 `json:"pending_records"`
+	PendingBytes   int64 `json:"pending_bytes"`
+	Segments       int   `json:"segments"`
+	MaxBytes       int64 `json:"max_bytes"`
+	// the time lag of the oldest pending record, unit millisecond
+	LagMillis int64 `json:"lag_millis"`
+	Appended  int64 `json:"appended"`
+	Committed int64 `json:"committed"`
+	Rejected  int64 `json:"rejected"`
+	// the count of records moved to the quarantine file
+	Quarantined int64 `json:"quarantined"`
+	// the size of the quarantine file and the count of poison records dropped because it is full
+	QuarantineBytes   int64 `json:"quarantine_bytes"`
+	QuarantineDropped int64 `json:"quarantine_dropped"`
+}
+
+type Spool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mutex       sync.Mutex
+	closed      bool
+	segments    []uint64
+	sizes       map[uint64]int64
+	writer      *os.File
+	readPos     Position
+	pending     int64
+	appended    int64
+	committed   int64
+	rejected    int64
+	quarantined int64
+	// the size of the quarantine file
+	quarantineBytes   int64
+	quarantineDropped int64
+}
+
+// Open opens the spool in the dir, the dir is created if it does not exist,
+// maxBytes limits the total size of segment files and segmentBytes limits the size of a segment
+func Open(dir string, maxBytes int64, segmentBytes int64) (*Spool, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = defaultSegmentSize
+	}
+	if maxBytes < segmentBytes {
+		return nil, errors.New("the max size of spool must not be less than the size of segment")
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+		sizes:        make(map[uint64]int64),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(filepath.Join(dir, quarantineFile)); err == nil {
+		s.quarantineBytes = info.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+func (s *Spool) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, checkpointFile))
+	if err == nil {
+		if err = json.Unmarshal(content, &s.readPos); err != nil {
+			return errors.New("failed to decode the spool checkpoint: " + err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// the segments before the checkpoint have been consumed
+	for len(s.segments) > 0 && s.segments[0] < s.readPos.Segment {
+		os.Remove(s.segmentPath(s.segments[0]))
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) == 0 || s.segments[0] != s.readPos.Segment {
+		s.readPos = Position{}
+		if len(s.segments) > 0 {
+			s.readPos.Segment = s.segments[0]
+		}
+	}
+
+	for _, id := range s.segments {
+		// a torn write at the end of a segment is dropped
+		size, count, err := scanSegment(s.segmentPath(id), s.startOffset(id))
+		if err != nil {
+			return err
+		}
+		s.sizes[id] = size
+		s.pending += count
+	}
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, 1)
+		s.readPos = Position{Segment: 1}
+	}
+	return s.openWriter()
+}
+
+func (s *Spool) startOffset(id uint64) int64 {
+	if id == s.readPos.Segment {
+		return s.readPos.Offset
+	}
+	return 0
+}
+
+// scanSegment truncates the invalid tail of the segment, and returns the valid size
+// and the count of records after the offset
+func scanSegment(path string, offset int64) (size int64, count int64, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	var pos int64
+	for {
+		_, length, err := readRecordAt(file, pos, false)
+		if err != nil {
+			break
+		}
+		if pos >= offset {
+			count++
+		}
+		pos += headerSize + int64(length)
+	}
+	if err = file.Truncate(pos); err != nil {
+		return 0, 0, err
+	}
+	return pos, count, nil
+}
+
+// readRecordAt reads the record at the offset, the payload is returned only if withPayload is true
+func readRecordAt(file *os.File, offset int64, withPayload bool) (header []byte, length uint32, err error) {
+	header = make([]byte, headerSize)
+	if _, err = file.ReadAt(header, offset); err != nil {
+		return nil, 0, err
+	}
+	length = binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, 0, errors.New("invalid record length")
+	}
+	payload := make([]byte, length)
+	if _, err = file.ReadAt(payload, offset+headerSize); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("invalid record checksum")
+	}
+	if withPayload {
+		header = append(header, payload...)
+	}
+	return header, length, nil
+}
+
+func (s *Spool) openWriter() error {
+	id := s.segments[len(s.segments)-1]
+	file, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.writer = file
+	if _, ok := s.sizes[id]; !ok {
+		s.sizes[id] = 0
+	}
+	return nil
+}
+
+func (s *Spool) totalBytes() int64 {
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+	return total
+}
+
+// Append appends the records to the spool, ErrFull is returned and nothing is written
+// if the records exceed the max size of the spool
+func (s *Spool) Append(records ...[]byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.append(records)
+}
+
+func (s *Spool) append(records [][]byte) error {
+	if s.closed {
+		return ErrClosed
+	}
+	var size int64
+	for _, record := range records {
+		if len(record) > maxRecordSize {
+			s.rejected++
+			return ErrRecordTooLarge
+		}
+		size += headerSize + int64(len(record))
+	}
+	if s.totalBytes()+size > s.maxBytes {
+		s.rejected += int64(len(records))
+		return ErrFull
+	}
+	now := nowMillis()
+	for _, record := range records {
+		current := s.segments[len(s.segments)-1]
+		if s.sizes[current] > 0 && s.sizes[current]+headerSize+int64(len(record)) > s.segmentBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			current = s.segments[len(s.segments)-1]
+		}
+		buf := make([]byte, headerSize+len(record))
+		binary.BigEndian.PutUint32(buf[0:4], uint32(len(record)))
+		binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(record))
+		binary.BigEndian.PutUint64(buf[8:16], uint64(now))
+		copy(buf[headerSize:], record)
+		if _, err := s.writer.Write(buf); err != nil {
+			return err
+		}
+		s.sizes[current] += int64(len(buf))
+		s.pending++
+		s.appended++
+	}
+	return s.writer.Sync()
+}
+
+func (s *Spool) rotate() error {
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+	s.segments = append(s.segments, s.segments[len(s.segments)-1]+1)
+	return s.openWriter()
+}
+
+// Peek reads at most max records from the oldest one without consuming them,
+// the returned position should be passed to Commit after the records are handled
+func (s *Spool) Peek(max int) ([][]byte, Position, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil, s.readPos, ErrClosed
+	}
+	var records [][]byte
+	pos := s.readPos
+	for len(records) < max {
+		if pos.Offset >= s.sizes[pos.Segment] {
+			next, ok := s.nextSegment(pos.Segment)
+			if !ok {
+				break
+			}
+			pos = Position{Segment: next}
+			continue
+		}
+		file, err := os.Open(s.segmentPath(pos.Segment))
+		if err != nil {
+			return nil, s.readPos, err
+		}
+		for len(records) < max && pos.Offset < s.sizes[pos.Segment] {
+			record, length, err := readRecordAt(file, pos.Offset, true)
+			if err != nil {
+				file.Close()
+				return nil, s.readPos, errors.New("failed to read spool segment " +
+					strconv.FormatUint(pos.Segment, 10) + ": " + err.Error())
+			}
+			records = append(records, record[headerSize:])
+			pos.Offset += headerSize + int64(length)
+		}
+		file.Close()
+	}
+	return records, pos, nil
+}
+
+func (s *Spool) nextSegment(id uint64) (uint64, bool) {
+	for _, segment := range s.segments {
+		if segment > id {
+			return segment, true
+		}
+	}
+	return 0, false
+}
+
+// Commit consumes the records before the position, the fully consumed segments are removed
+func (s *Spool) Commit(pos Position) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	count, err := s.countRecords(s.readPos, pos)
+	if err != nil {
+		return err
+	}
+	// start a new segment when everything is consumed, so that the old one can be removed
+	last := s.segments[len(s.segments)-1]
+	if s.pending == count && pos.Segment == last && pos.Offset > 0 && pos.Offset == s.sizes[last] {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+		pos = Position{Segment: s.segments[len(s.segments)-1]}
+	}
+	content, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(s.dir, checkpointFile+".tmp")
+	if err = ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, filepath.Join(s.dir, checkpointFile)); err != nil {
+		return err
+	}
+	s.readPos = pos
+	s.pending -= count
+	s.committed += count
+	// the segment being written is never removed
+	for len(s.segments) > 1 && s.segments[0] < pos.Segment {
+		os.Remove(s.segmentPath(s.segments[0]))
+		delete(s.sizes, s.segments[0])
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+func (s *Spool) countRecords(from Position, to Position) (int64, error) {
+	var count int64
+	for from.Segment < to.Segment || (from.Segment == to.Segment && from.Offset < to.Offset) {
+		end := s.sizes[from.Segment]
+		if from.Segment == to.Segment {
+			end = to.Offset
+		}
+		if from.Offset >= end {
+			next, ok := s.nextSegment(from.Segment)
+			if !ok {
+				break
+			}
+			from = Position{Segment: next}
+			continue
+		}
+		file, err := os.Open(s.segmentPath(from.Segment))
+		if err != nil {
+			return 0, err
+		}
+		header := make([]byte, headerSize)
+		for from.Offset < end {
+			if _, err = file.ReadAt(header, from.Offset); err != nil {
+				file.Close()
+				return 0, err
+			}
+			from.Offset += headerSize + int64(binary.BigEndian.Uint32(header[0:4]))
+			count++
+		}
+		file.Close()
+	}
+	return count, nil
+}
+
+// Drain passes at most max records to the handler and commits them if it succeeds. When the handler returns
+// a PoisonError, the records are handled one by one to find out the poison ones, which are moved to the
+// quarantine file and committed, so that they do not block the records behind them. The other errors of
+// the handler are returned without commit, and the caller should retry later.
+func (s *Spool) Drain(max int, handler func(records [][]byte) error) (int, error) {
+	records, pos, err := s.Peek(max)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	err = handler(records)
+	if err == nil {
+		return len(records), s.Commit(pos)
+	}
+	if !IsPoison(err) {
+		return 0, err
+	}
+	if len(records) == 1 {
+		if err = s.Quarantine(records); err != nil && err != ErrQuarantineFull {
+			return 0, err
+		}
+		return 1, s.Commit(pos)
+	}
+	for i := range records {
+		if _, err = s.Drain(1, handler); err != nil {
+			return i, err
+		}
+	}
+	return len(records), nil
+}
+
+// Quarantine appends the records that can never be handled to the quarantine file, one record per line,
+// ErrQuarantineFull is returned and the records are dropped if the file exceeds the max size of the spool
+func (s *Spool) Quarantine(records [][]byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	var size int64
+	for _, record := range records {
+		size += int64(len(record)) + 1
+	}
+	if s.quarantineBytes+size > s.maxBytes {
+		s.quarantineDropped += int64(len(records))
+		return ErrQuarantineFull
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, quarantineFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, record := range records {
+		if _, err = file.Write(append(append([]byte{}, record...), '\n')); err != nil {
+			return err
+		}
+		s.quarantineBytes += int64(len(record)) + 1
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	s.quarantined += int64(len(records))
+	return nil
+}
+
+// Replay appends the records of the quarantine file to the spool again and removes the file,
+// it is used after the cause of the rejection is fixed, nothing is changed if the spool is full
+func (s *Spool) Replay() (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	path := filepath.Join(s.dir, quarantineFile)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var records [][]byte
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			records = append(records, []byte(line))
+		}
+	}
+	if err = s.append(records); err != nil {
+		return 0, err
+	}
+	if err = os.Remove(path); err != nil {
+		return 0, err
+	}
+	s.quarantineBytes = 0
+	return len(records), nil
+}
+
+func (s *Spool) Stats() Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := Stats{
+		PendingRecords:    s.pending,
+		Segments:          len(s.segments),
+		MaxBytes:          s.maxBytes,
+		Appended:          s.appended,
+		Committed:         s.committed,
+		Rejected:          s.rejected,
+		Quarantined:       s.quarantined,
+		QuarantineBytes:   s.quarantineBytes,
+		QuarantineDropped: s.quarantineDropped,
+	}
+	stats.PendingBytes = s.totalBytes() - s.readPos.Offset
+	if s.pending > 0 {
+		if oldest, err := s.oldestTime(); err == nil {
+			stats.LagMillis = nowMillis() - oldest
+		}
+	}
+	return stats
+}
+
+func (s *Spool) oldestTime() (int64, error) {
+	pos := s.readPos
+	for pos.Offset >= s.sizes[pos.Segment] {
+		next, ok := s.nextSegment(pos.Segment)
+		if !ok {
+			return 0, io.EOF
+		}
+		pos = Position{Segment: next}
+	}
+	file, err := os.Open(s.segmentPath(pos.Segment))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	header := make([]byte, headerSize)
+	if _, err = file.ReadAt(header, pos.Offset); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(header[8:16])), nil
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / 1000000
+}
+
+func (s *Spool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.writer.Close()
+}
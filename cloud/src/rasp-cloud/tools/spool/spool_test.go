@@ -0,0 +1,310 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package spool
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func tempSpoolDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestAppendPeekCommit(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, 1024*1024, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < 10; i++ {
+		if err := s.Append([]byte("record-" + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := s.Stats(); stats.PendingRecords != 10 || stats.Segments < 2 {
+		t.Fatalf("unexpected stats after append: %+v", stats)
+	}
+
+	records, pos, err := s.Peek(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || string(records[0]) != "record-0" || string(records[3]) != "record-3" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+	// peek without commit returns the same records
+	again, _, err := s.Peek(1)
+	if err != nil || string(again[0]) != "record-0" {
+		t.Fatalf("peek should not consume records: %q, %v", again, err)
+	}
+	if err = s.Commit(pos); err != nil {
+		t.Fatal(err)
+	}
+	records, pos, err = s.Peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || string(records[0]) != "record-4" {
+		t.Fatalf("unexpected records after commit: %q", records)
+	}
+	if err = s.Commit(pos); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.Stats(); stats.PendingRecords != 0 || stats.Committed != 10 || stats.Segments != 1 {
+		t.Fatalf("unexpected stats after commit: %+v", stats)
+	}
+}
+
+func TestReplayAfterReopen(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, 1024*1024, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.Append([]byte("alarm-" + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, pos, err := s.Peek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Commit(pos); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// simulate a torn write at the end of the last segment
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	last := matches[len(matches)-1]
+	file, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 0, 0, 9, 1, 2})
+	file.Close()
+
+	s, err = Open(dir, 1024*1024, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	records, _, err := s.Peek(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || string(records[0]) != "alarm-2" || string(records[2]) != "alarm-4" {
+		t.Fatalf("unexpected replayed records: %q", records)
+	}
+	if stats := s.Stats(); stats.PendingRecords != 3 {
+		t.Fatalf("unexpected pending records: %+v", stats)
+	}
+	if err = s.Append([]byte("alarm-5")); err != nil {
+		t.Fatal(err)
+	}
+	records, _, err = s.Peek(100)
+	if err != nil || len(records) != 4 || string(records[3]) != "alarm-5" {
+		t.Fatalf("unexpected records after append: %q, %v", records, err)
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	record := make([]byte, 30)
+	for i := 0; i < 2; i++ {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Append(record); err != ErrFull {
+		t.Fatalf("expect ErrFull, got %v", err)
+	}
+	if stats := s.Stats(); stats.Rejected != 1 || stats.PendingRecords != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	_, pos, err := s.Peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Commit(pos); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(record); err != nil {
+		t.Fatalf("the spool should accept records after commit: %v", err)
+	}
+}
+
+func TestDrainPoison(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, 1024*1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, record := range []string{"ok-0", "bad-1", "ok-2", "bad-3"} {
+		if err := s.Append([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	available := false
+	var handled []string
+	handler := func(records [][]byte) error {
+		if !available {
+			return errors.New("connection refused")
+		}
+		for _, record := range records {
+			if strings.HasPrefix(string(record), "bad") {
+				return Poison(errors.New("no bulk actions"))
+			}
+		}
+		for _, record := range records {
+			handled = append(handled, string(record))
+		}
+		return nil
+	}
+
+	// the transient error is retried later, nothing is committed
+	if count, err := s.Drain(10, handler); err == nil || IsPoison(err) || count != 0 {
+		t.Fatalf("expect the transient error, got %d, %v", count, err)
+	}
+	if stats := s.Stats(); stats.PendingRecords != 4 || stats.Quarantined != 0 {
+		t.Fatalf("unexpected stats after the transient error: %+v", stats)
+	}
+
+	// the poison records are quarantined and do not block the others
+	available = true
+	if count, err := s.Drain(10, handler); err != nil || count != 4 {
+		t.Fatalf("unexpected result of drain: %d, %v", count, err)
+	}
+	if len(handled) != 2 || handled[0] != "ok-0" || handled[1] != "ok-2" {
+		t.Fatalf("unexpected handled records: %q", handled)
+	}
+	if stats := s.Stats(); stats.PendingRecords != 0 || stats.Quarantined != 2 || stats.Committed != 4 {
+		t.Fatalf("unexpected stats after drain: %+v", stats)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, quarantineFile))
+	if err != nil || string(content) != "bad-1\nbad-3\n" {
+		t.Fatalf("unexpected quarantine file: %q, %v", content, err)
+	}
+	if err := s.Append([]byte("ok-4")); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := s.Drain(10, handler); err != nil || count != 1 || handled[2] != "ok-4" {
+		t.Fatalf("the spool should be drained after the poison records: %d, %v", count, err)
+	}
+}
+
+func TestDrainRequeue(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, 1024*1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, record := range []string{"ok-0", "busy-1", "bad-2"} {
+		if err := s.Append([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the handler appends the busy records again and quarantines the rejected ones,
+	// so that the handled records are committed without being handled twice
+	count, err := s.Drain(10, func(records [][]byte) error {
+		for _, record := range records {
+			if strings.HasPrefix(string(record), "busy") {
+				if err := s.Append(record); err != nil {
+					return err
+				}
+			} else if strings.HasPrefix(string(record), "bad") {
+				if err := s.Quarantine([][]byte{record}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Fatalf("unexpected result of drain: %d, %v", count, err)
+	}
+	records, _, err := s.Peek(10)
+	if err != nil || len(records) != 1 || string(records[0]) != "busy-1" {
+		t.Fatalf("unexpected records after drain: %q, %v", records, err)
+	}
+	if stats := s.Stats(); stats.Quarantined != 1 || stats.PendingRecords != 1 {
+		t.Fatalf("unexpected stats after drain: %+v", stats)
+	}
+}
+
+func TestQuarantineLimitAndReplay(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, 64, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Quarantine([][]byte{[]byte("bad-0"), []byte("bad-1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Quarantine([][]byte{[]byte(strings.Repeat("bad-2", 12))}); err != ErrQuarantineFull {
+		t.Fatalf("the quarantine file should be full: %v", err)
+	}
+	if stats := s.Stats(); stats.Quarantined != 2 || stats.QuarantineDropped != 1 || stats.QuarantineBytes != 12 {
+		t.Fatalf("unexpected stats after quarantine: %+v", stats)
+	}
+	// the size of the quarantine file is kept after reopening
+	s.Close()
+	if s, err = Open(dir, 64, 64); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if stats := s.Stats(); stats.QuarantineBytes != 12 {
+		t.Fatalf("unexpected quarantine size after reopening: %+v", stats)
+	}
+	count, err := s.Replay()
+	if err != nil || count != 2 {
+		t.Fatalf("unexpected result of replay: %d, %v", count, err)
+	}
+	records, _, err := s.Peek(10)
+	if err != nil || len(records) != 2 || string(records[0]) != "bad-0" || string(records[1]) != "bad-1" {
+		t.Fatalf("unexpected records after replay: %q, %v", records, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, quarantineFile)); !os.IsNotExist(err) {
+		t.Fatalf("the quarantine file should be removed after replay: %v", err)
+	}
+	if count, err := s.Replay(); err != nil || count != 0 {
+		t.Fatalf("unexpected result of replay without quarantine file: %d, %v", count, err)
+	}
+}
@@ -0,0 +1,191 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package syslog sends RFC5424 messages over udp, tcp or tls,
+// the messages on tcp and tls are framed with octet counting (RFC6587, RFC5425)
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SeverityEmergency = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+const (
+	nilValue     = "-"
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+type Writer struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	facility  int
+	hostname  string
+	appName   string
+	procId    string
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// NewWriter creates the writer for the url like tcp://127.0.0.1:514, udp://127.0.0.1:514 or tls://127.0.0.1:6514,
+// the connection is established lazily and re-established after failures
+func NewWriter(rawUrl string, tlsConfig *tls.Config, facility int, appName string) (*Writer, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "tcp" && u.Scheme != "udp" && u.Scheme != "tls" {
+		return nil, errors.New("unsupported syslog protocol: " + u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("the syslog address can not be empty")
+	}
+	if facility < 0 || facility > 23 {
+		return nil, errors.New("the syslog facility must be between [0, 23]")
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = nilValue
+	}
+	if appName == "" {
+		appName = nilValue
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	return &Writer{
+		network:   u.Scheme,
+		addr:      u.Host,
+		tlsConfig: tlsConfig,
+		facility:  facility,
+		hostname:  hostname,
+		appName:   appName,
+		procId:    strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+// Format formats the message as RFC5424 without structured data
+func Format(facility int, severity int, timestamp time.Time, hostname string, appName string, procId string,
+	msgId string, msg []byte) []byte {
+	header := "<" + strconv.Itoa(facility*8+severity) + ">1 " + timestamp.Format(time.RFC3339Nano) + " " +
+		headerField(hostname, 255) + " " + headerField(appName, 48) + " " + headerField(procId, 128) + " " +
+		headerField(msgId, 32) + " " + nilValue + " "
+	return append([]byte(header), msg...)
+}
+
+// headerField replaces the characters which are not allowed in the header fields
+func headerField(value string, maxLength int) string {
+	if value == "" {
+		return nilValue
+	}
+	result := []byte(value)
+	for i, c := range result {
+		if c < 33 || c > 126 {
+			result[i] = '_'
+		}
+	}
+	if len(result) > maxLength {
+		result = result[:maxLength]
+	}
+	return string(result)
+}
+
+func (w *Writer) connect() (err error) {
+	if w.conn != nil {
+		return nil
+	}
+	switch w.network {
+	case "tls":
+		dialer := &net.Dialer{Timeout: dialTimeout}
+		config := w.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = strings.Split(w.addr, ":")[0]
+		}
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, config)
+	default:
+		w.conn, err = net.DialTimeout(w.network, w.addr, dialTimeout)
+	}
+	return
+}
+
+// Write sends the messages, it reconnects and retries once if the connection is broken
+func (w *Writer) Write(severity int, msgId string, msgs ...[]byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var buf []byte
+	now := time.Now()
+	frames := make([][]byte, 0, len(msgs))
+	for _, msg := range msgs {
+		frame := Format(w.facility, severity, now, w.hostname, w.appName, w.procId, msgId, msg)
+		if w.network != "udp" {
+			frame = append([]byte(strconv.Itoa(len(frame))+" "), frame...)
+			buf = append(buf, frame...)
+		}
+		frames = append(frames, frame)
+	}
+	var err error
+	for i := 0; i < 2; i++ {
+		if err = w.connect(); err != nil {
+			continue
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if w.network == "udp" {
+			// every datagram is a message
+			for _, frame := range frames {
+				if _, err = w.conn.Write(frame); err != nil {
+					break
+				}
+			}
+		} else {
+			_, err = w.conn.Write(buf)
+		}
+		if err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
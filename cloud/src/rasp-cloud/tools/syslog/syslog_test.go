@@ -0,0 +1,249 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrames reads the octet counting frames from the stream server
+func readFrames(t *testing.T, listener net.Listener, count int, result chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Error(err)
+		close(result)
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var frames []string
+	for len(frames) < count {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Error(err)
+			break
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Error(err)
+			break
+		}
+		frame := make([]byte, size)
+		if _, err = io.ReadFull(reader, frame); err != nil {
+			t.Error(err)
+			break
+		}
+		frames = append(frames, string(frame))
+	}
+	result <- frames
+}
+
+func checkFrame(t *testing.T, frame string, msg string) {
+	if !strings.HasPrefix(frame, "<132>1 ") {
+		t.Errorf("unexpected priority of the frame: %q", frame)
+	}
+	fields := strings.SplitN(frame, " ", 8)
+	if len(fields) != 8 {
+		t.Fatalf("unexpected frame: %q", frame)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+		t.Errorf("unexpected timestamp: %v", err)
+	}
+	if fields[3] != "openrasp" || fields[5] != "attack-alarm" || fields[6] != "-" || fields[7] != msg {
+		t.Errorf("unexpected frame: %q", frame)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	timestamp := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	frame := string(Format(16, SeverityWarning, timestamp, "host name", "", "123", "attack-alarm", []byte("msg")))
+	expected := "<132>1 2019-01-02T03:04:05Z host_name - 123 attack-alarm - msg"
+	if frame != expected {
+		t.Fatalf("expect %q, got %q", expected, frame)
+	}
+}
+
+func TestWriteTcp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	result := make(chan []string, 1)
+	go readFrames(t, listener, 3, result)
+
+	writer, err := NewWriter("tcp://"+listener.Addr().String(), nil, 16, "openrasp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err = writer.Write(SeverityWarning, "attack-alarm", []byte(`{"a":1}`), []byte("line 1\nline 2")); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Write(SeverityWarning, "attack-alarm", []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	frames := <-result
+	if len(frames) != 3 {
+		t.Fatalf("expect 3 frames, got %q", frames)
+	}
+	checkFrame(t, frames[0], `{"a":1}`)
+	checkFrame(t, frames[1], "line 1\nline 2")
+	checkFrame(t, frames[2], "third")
+}
+
+func TestWriteUdp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	writer, err := NewWriter("udp://"+conn.LocalAddr().String(), nil, 16, "openrasp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err = writer.Write(SeverityWarning, "attack-alarm", []byte("first"), []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	for _, msg := range []string{"first", "second"} {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFrame(t, string(buf[:n]), msg)
+	}
+}
+
+func TestWriteTls(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	result := make(chan []string, 1)
+	go readFrames(t, listener, 1, result)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	writer, err := NewWriter("tls://"+listener.Addr().String(), &tls.Config{RootCAs: pool}, 16, "openrasp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err = writer.Write(SeverityWarning, "attack-alarm", []byte("secure")); err != nil {
+		t.Fatal(err)
+	}
+	frames := <-result
+	if len(frames) != 1 {
+		t.Fatalf("expect 1 frame, got %q", frames)
+	}
+	checkFrame(t, frames[0], "secure")
+}
+
+func TestReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	writer, err := NewWriter("tcp://"+listener.Addr().String(), nil, 16, "openrasp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// the server closes the first connection
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	writer.Write(SeverityWarning, "attack-alarm", []byte("lost"))
+	time.Sleep(100 * time.Millisecond)
+
+	result := make(chan []string, 1)
+	go readFrames(t, listener, 1, result)
+	var lastErr error
+	for i := 0; i < 3; i++ {
+		// the write on the closed connection may succeed once before the reset is noticed
+		if lastErr = writer.Write(SeverityWarning, "attack-alarm", []byte("again")); lastErr != nil {
+			continue
+		}
+		select {
+		case frames := <-result:
+			if len(frames) != 1 {
+				t.Fatalf("expect 1 frame, got %q", frames)
+			}
+			checkFrame(t, frames[0], "again")
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	t.Fatalf("the writer did not reconnect: %v", lastErr)
+}
+
+func TestNewWriterInvalidUrl(t *testing.T) {
+	for _, rawUrl := range []string{"http://127.0.0.1:514", "tcp://", "://"} {
+		if _, err := NewWriter(rawUrl, nil, 16, "openrasp"); err == nil {
+			t.Errorf("expect an error for %q", rawUrl)
+		}
+	}
+	if _, err := NewWriter("tcp://127.0.0.1:514", nil, 24, "openrasp"); err == nil {
+		t.Error("expect an error for the invalid facility")
+	}
+}
@@ -0,0 +1,104 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package tokenscope maps the scopes of the api tokens to the paths they can access and the role
+// which the token acts as, the roles are the same as the roles of the users
+package tokenscope
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Scope is the role of the token user and the path prefixes that the scope is allowed to access,
+// the role is empty for the scope not used by the api
+type Scope struct {
+	Role  string
+	Paths []string
+}
+
+const (
+	ScopeAdmin        = "admin"
+	ScopeReadOnly     = "readonly"
+	ScopePluginDeploy = "plugin_deploy"
+	ScopeAlarmIngest  = "alarm_ingest"
+
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "readonly"
+
+	prefixSize = 8
+)
+
+var (
+	Scopes = map[string]Scope{
+		ScopeAdmin:    {Role: RoleAdmin, Paths: []string{"/v1/api/", "/v1/user/"}},
+		ScopeReadOnly: {Role: RoleReadOnly, Paths: []string{"/v1/api/", "/v1/user/"}},
+		ScopePluginDeploy: {Role: RoleOperator, Paths: []string{"/v1/api/plugin/",
+			"/v1/api/app/plugin/select/", "/v1/api/app/plugin/get/"}},
+		ScopeAlarmIngest: {Paths: []string{"/v1/agent/log/"}},
+	}
+	roleLevels = map[string]int{
+		RoleReadOnly: 1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+)
+
+func IsValid(scope string) bool {
+	_, ok := Scopes[scope]
+	return ok
+}
+
+// Allows checks whether the scope allows the path, the path matches the prefix by whole segments,
+// so that /v1/api/pluginX does not match /v1/api/plugin/
+func Allows(scope string, path string) bool {
+	path = strings.TrimSuffix(path, "/") + "/"
+	for _, prefix := range Scopes[scope].Paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Role returns the highest role of the scopes that allow the path, it is empty if none allows it,
+// the administrator of some apps is the operator of them since the users and tokens are managed globally
+func Role(scopes []string, path string, appScoped bool) string {
+	role := ""
+	for _, scope := range scopes {
+		if Allows(scope, path) && roleLevels[Scopes[scope].Role] > roleLevels[role] {
+			role = Scopes[scope].Role
+		}
+	}
+	if appScoped && role == RoleAdmin {
+		role = RoleOperator
+	}
+	return role
+}
+
+// Hash returns the id of the token, only the sha256 of the secret is stored
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prefix returns the prefix of the secret shown to identify the token
+func Prefix(secret string) string {
+	if len(secret) > prefixSize {
+		return secret[:prefixSize]
+	}
+	return secret
+}
@@ -0,0 +1,92 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package tokenscope
+
+import "testing"
+
+func TestAllows(t *testing.T) {
+	cases := []struct {
+		scope   string
+		path    string
+		allowed bool
+	}{
+		{ScopeAdmin, "/v1/api/app/get", true},
+		{ScopeAdmin, "/v1/user/update", true},
+		{ScopeAdmin, "/v1/agent/log/attack", false},
+		{ScopePluginDeploy, "/v1/api/plugin", true},
+		{ScopePluginDeploy, "/v1/api/plugin/", true},
+		{ScopePluginDeploy, "/v1/api/plugin/delete", true},
+		{ScopePluginDeploy, "/v1/api/pluginX", false},
+		{ScopePluginDeploy, "/v1/api/pluginX/delete", false},
+		{ScopePluginDeploy, "/v1/api/app/plugin/select", true},
+		{ScopePluginDeploy, "/v1/api/app/plugin/selectX", false},
+		{ScopePluginDeploy, "/v1/api/app/delete", false},
+		{ScopeAlarmIngest, "/v1/agent/log/attack", true},
+		{ScopeAlarmIngest, "/v1/agent/logX", false},
+		{ScopeAlarmIngest, "/v1/api/app/get", false},
+		{"unknown", "/v1/api/app/get", false},
+	}
+	for _, c := range cases {
+		if Allows(c.scope, c.path) != c.allowed {
+			t.Errorf("unexpected result of %s scope for %s, expected %v", c.scope, c.path, c.allowed)
+		}
+	}
+}
+
+func TestRole(t *testing.T) {
+	cases := []struct {
+		scopes    []string
+		path      string
+		appScoped bool
+		role      string
+	}{
+		{[]string{ScopeAdmin}, "/v1/api/app/get", false, RoleAdmin},
+		{[]string{ScopeReadOnly}, "/v1/api/app/get", false, RoleReadOnly},
+		{[]string{ScopeReadOnly, ScopeAdmin}, "/v1/api/app/get", false, RoleAdmin},
+		{[]string{ScopeReadOnly, ScopePluginDeploy}, "/v1/api/plugin/delete", false, RoleOperator},
+		{[]string{ScopeReadOnly, ScopePluginDeploy}, "/v1/api/app/delete", false, RoleReadOnly},
+		{[]string{ScopePluginDeploy}, "/v1/api/app/delete", false, ""},
+		{[]string{ScopeAlarmIngest}, "/v1/agent/log/attack", false, ""},
+		{[]string{ScopeAlarmIngest}, "/v1/api/app/get", false, ""},
+		{nil, "/v1/api/app/get", false, ""},
+		// the administrator of some apps is demoted to the operator
+		{[]string{ScopeAdmin}, "/v1/api/app/get", true, RoleOperator},
+		{[]string{ScopeReadOnly}, "/v1/api/app/get", true, RoleReadOnly},
+		{[]string{ScopePluginDeploy}, "/v1/api/plugin/delete", true, RoleOperator},
+	}
+	for _, c := range cases {
+		if role := Role(c.scopes, c.path, c.appScoped); role != c.role {
+			t.Errorf("unexpected role of %v for %s (app scoped: %v): %q, expected %q",
+				c.scopes, c.path, c.appScoped, role, c.role)
+		}
+	}
+}
+
+func TestHashAndPrefix(t *testing.T) {
+	// the tokens of the old version are migrated to the hash of the plaintext, so they keep working
+	secret := "0123456789abcdef"
+	if id := Hash(secret); id != "9f9f5111f7b27a781f1f1ddde5ebc2dd2b796bfc7365c9c28b548e564176929f" {
+		t.Errorf("unexpected hash of token: %s", id)
+	}
+	if Hash(secret) == Hash(secret+"0") {
+		t.Error("expected different hashes of different tokens")
+	}
+	if prefix := Prefix(secret); prefix != "01234567" {
+		t.Errorf("unexpected prefix of token: %s", prefix)
+	}
+	if prefix := Prefix("0123"); prefix != "0123" {
+		t.Errorf("unexpected prefix of short token: %s", prefix)
+	}
+}
@@ -0,0 +1,145 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+// Package totp implements the time-based one-time passwords of RFC 6238 used by the authenticator apps,
+// the codes are 6 digits of HMAC-SHA1 in 30 seconds steps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30
+	// the codes of the adjacent steps are accepted for the clock drift
+	skewSteps  = 1
+	secretSize = 20
+	// the recovery code is 10 base32 characters grouped by 5, such as abcde-fghij
+	recoveryCodeSize = 10
+)
+
+var (
+	encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// GenerateSecret returns a random base32 encoded secret of 160 bits
+func GenerateSecret() (string, error) {
+	data := make([]byte, secretSize)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(data), nil
+}
+
+// ProvisioningURI is the otpauth uri of the secret, it is shown as a QR code to the authenticator app
+func ProvisioningURI(issuer string, account string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", strconv.Itoa(Digits))
+	values.Set("period", strconv.Itoa(Period))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// Code returns the code of the secret at the time
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, counter(t), Digits), nil
+}
+
+// Verify checks the code at the time and returns its step counter, the caller rejects the codes whose counter
+// is not greater than the last accepted one so that a code can only be used once
+func Verify(secret string, passcode string, t time.Time) (int64, bool) {
+	key, err := decodeSecret(secret)
+	passcode = strings.TrimSpace(passcode)
+	if err != nil || len(passcode) != Digits {
+		return 0, false
+	}
+	current := counter(t)
+	for step := current - skewSteps; step <= current+skewSteps; step++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, step, Digits)), []byte(passcode)) == 1 {
+			return int64(step), true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns the one-time codes used when the authenticator app is lost
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		data := make([]byte, recoveryCodeSize*5/8)
+		if _, err := io.ReadFull(rand.Reader, data); err != nil {
+			return nil, err
+		}
+		text := strings.ToLower(encoding.EncodeToString(data))
+		codes = append(codes, text[:recoveryCodeSize/2]+"-"+text[recoveryCodeSize/2:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode is the stored form of the recovery code, the case and the separator are ignored
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(strings.Replace(secret, " ", "", -1), "=")))
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("invalid totp secret")
+	}
+	return key, nil
+}
+
+func counter(t time.Time) uint64 {
+	return uint64(t.Unix() / Period)
+}
+
+// code is the HOTP of RFC 4226
+func code(key []byte, counter uint64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	text := strconv.FormatUint(uint64(value%mod), 10)
+	return strings.Repeat("0", digits-len(text)) + text
+}
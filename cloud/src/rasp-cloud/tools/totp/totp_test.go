@@ -0,0 +1,112 @@
+//Copyright 2017-2019 Baidu Inc.
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//http: //www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the secret of the test vectors of RFC 4226 and RFC 6238
+var testKey = []byte("12345678901234567890")
+
+func TestHotp(t *testing.T) {
+	expected := []string{"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489"}
+	for i, value := range expected {
+		if result := code(testKey, uint64(i), 6); result != value {
+			t.Errorf("unexpected code of counter %d: %s, expected %s", i, result, value)
+		}
+	}
+}
+
+func TestTotp(t *testing.T) {
+	cases := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for timestamp, value := range cases {
+		if result := code(testKey, counter(time.Unix(timestamp, 0)), 8); result != value {
+			t.Errorf("unexpected code at %d: %s, expected %s", timestamp, result, value)
+		}
+	}
+	secret := encoding.EncodeToString(testKey)
+	if result, err := Code(secret, time.Unix(59, 0)); err != nil || result != "287082" {
+		t.Errorf("unexpected code: %s, %v", result, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("unexpected secret: %s, %v", secret, err)
+	}
+	now := time.Unix(1500000000, 0)
+	passcode, _ := Code(secret, now)
+	step, ok := Verify(secret, passcode, now)
+	if !ok || step != 1500000000/Period {
+		t.Errorf("unexpected result of verify: %d, %v", step, ok)
+	}
+	// the code of the last step is accepted for the clock drift
+	if _, ok = Verify(secret, passcode, now.Add(Period*time.Second)); !ok {
+		t.Error("expected the code of the last step to be accepted")
+	}
+	if _, ok = Verify(secret, passcode, now.Add(3*Period*time.Second)); ok {
+		t.Error("expected the expired code to be rejected")
+	}
+	for _, invalid := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok = Verify(secret, invalid, now); ok {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+	if _, ok = Verify("not base32!", passcode, now); ok {
+		t.Error("expected the invalid secret to be rejected")
+	}
+	// the secret shown with spaces and lower case is accepted
+	if _, ok = Verify(strings.ToLower(secret[:4]+" "+secret[4:]), passcode, now); !ok {
+		t.Error("expected the formatted secret to be accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("unexpected recovery codes: %v, %v", codes, err)
+	}
+	seen := make(map[string]bool)
+	for _, item := range codes {
+		if len(item) != 11 || item[5] != '-' || seen[item] {
+			t.Errorf("unexpected recovery code: %s", item)
+		}
+		seen[item] = true
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.Replace(codes[0], "-", "", 1))) {
+		t.Error("expected the hash to ignore the case and the separator")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("OpenRASP", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	expected := "otpauth://totp/OpenRASP:alice@example.com?algorithm=SHA1&digits=6&issuer=OpenRASP&period=30" +
+		"&secret=JBSWY3DPEHPK3PXP"
+	if uri != expected {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+}
@@ -0,0 +1,26 @@
+<h3>{{.Title}}</h3>
+<table border="1" cellspacing="0" cellpadding="5">
+    <thead>
+        <tr>
+            <th>主机名</th>
+            <th>注册 IP</th>
+            <th>RASP ID</th>
+            <th>RASP 版本</th>
+            <th>最后心跳时间</th>
+        </tr>
+    </thead>
+    <tbody>
+        {{range .Rasps}}
+            <tr>
+                <td>{{.HostName}}</td>
+                <td>{{.RegisterIp}}</td>
+                <td>{{.Id}}</td>
+                <td>{{.Version}}</td>
+                <td>{{.LastHeartbeat}}</td>
+            </tr>
+        {{end}}
+    </tbody>
+</table>
+<br>
+
+若要查看 "<b>{{.AppName}}</b>" 的所有主机，请点击这里 <a href="{{.DetailedLink}}">{{.DetailedLink}}</a>